@@ -1,20 +1,33 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yosadchyi/go-client-server/pkg/blob"
 	"github.com/yosadchyi/go-client-server/pkg/client"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/lineedit"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
 	"github.com/yosadchyi/go-client-server/pkg/util"
 )
 
+// historySize is a maximal number of entries kept in history file
+const historySize = 1000
+
+// maxLineLength is a maximal length of input line, values longer than SQS message are offloaded to blob store
+const maxLineLength = 64 * 1024 * 1024
+
 func main() {
 	awsEndpoint := os.Getenv("AWS_ENDPOINT")
 	awsRegion := os.Getenv("AWS_REGION")
@@ -30,8 +43,123 @@ func main() {
 		"",
 		"input file to read commands from, otherwise stdin will be used",
 	)
+	namespace := flag.String(
+		"namespace",
+		"",
+		"namespace for keys which are not prefixed with NAMESPACE/, server's default namespace is used if empty",
+	)
+	replyQueueUrl := flag.String(
+		"reply-queue-url",
+		os.Getenv("REPLY_QUEUE_URL"),
+		"SQS queue for server's replies, it must not be shared with other clients; replies aren't requested if empty",
+	)
+	replyTimeout := flag.Duration(
+		"reply-timeout",
+		10*time.Second,
+		"time to wait for server's reply",
+	)
+	failFast := flag.Bool(
+		"fail-fast",
+		false,
+		"stop batch processing after the first failed command, same as -max-errors=1",
+	)
+	maxErrors := flag.Int(
+		"max-errors",
+		0,
+		"stop batch processing after given number of failed commands, 0 means no limit",
+	)
+	summaryFile := flag.String(
+		"summary-file",
+		"",
+		"file to write JSON summary of batch processing to, - writes it to stdout",
+	)
+	codecName := flag.String(
+		"codec",
+		"json",
+		"encoding of messages, one of json, msgpack, protobuf",
+	)
+	blobStore := flag.String(
+		"blob-store",
+		os.Getenv("BLOB_STORE_URL"),
+		"store for values longer than -offload-threshold, file:///path/to/dir or s3://bucket/prefix, values aren't offloaded if empty",
+	)
+	offloadThreshold := flag.Int(
+		"offload-threshold",
+		64*1024,
+		"length of value in bytes above which it's stored in -blob-store and message carries its key",
+	)
+	compressThreshold := flag.Int(
+		"compress-threshold",
+		0,
+		"length of encoded message in bytes above which it's sent compressed with gzip, 0 disables compression",
+	)
+	retryAttempts := flag.Int(
+		"retry-attempts",
+		retry.DefaultPolicy.MaxAttempts,
+		"number of attempts to send message failing with transient or throttling errors, 1 disables retries",
+	)
+	retryDelay := flag.Duration(
+		"retry-delay",
+		retry.DefaultPolicy.BaseDelay,
+		"longest delay before the first retry of send or receive of replies, doubled for every next one, with random jitter",
+	)
+	principal := flag.String(
+		"principal",
+		os.Getenv("PRINCIPAL"),
+		"name of client in server's authorization policy, authenticated by -api-key or signature",
+	)
+	apiKey := flag.String(
+		"api-key",
+		os.Getenv("API_KEY"),
+		"API key authenticating client, it's readable to anyone with access to the queue, so prefer signatures",
+	)
+	signingKeys := flag.String(
+		"signing-keys",
+		os.Getenv("SIGNING_KEYS"),
+		"file with keys to sign messages with, one ID=BASE64_SECRET per line, messages aren't signed if empty",
+	)
+	signingKeyId := flag.String(
+		"signing-key-id",
+		os.Getenv("SIGNING_KEY_ID"),
+		"ID of key in -signing-keys to sign messages with, may be omitted if the file has the only key",
+	)
+	keyringFile := flag.String(
+		"keyring",
+		os.Getenv("KEYRING_FILE"),
+		"keyring to encrypt values with, one ID=BASE64_KEY per line, the last key is used; values aren't encrypted if empty",
+	)
+	protocolVersion := flag.String(
+		"protocol-version",
+		message.ProtocolVersion,
+		"protocol version of sent messages; with -reply-queue-url it's lowered to the latest version supported by server",
+	)
+	output := flag.String(
+		"output",
+		client.TextOutput,
+		"format of command results, one of text, json, csv, table; table is written once all commands are executed",
+	)
+	historyFile := flag.String(
+		"history-file",
+		defaultHistoryFile(),
+		"file to keep history of interactive session in, history isn't kept if empty",
+	)
+	logFormat := flag.String(
+		"log-format",
+		"text",
+		"log format, text or json",
+	)
+	logLevel := flag.String(
+		"log-level",
+		"info",
+		"minimal level of log entries, one of debug, info, warn, error",
+	)
 	flag.Parse()
 
+	if err := logging.Setup(*logFormat, *logLevel); err != nil {
+		logging.Default().Fatal("invalid logging options", "error", err)
+	}
+	logger := logging.Default()
+
 	ctx, cancelFn := context.WithCancel(context.Background())
 
 	cfg, err := config.LoadDefaultConfig(
@@ -39,16 +167,16 @@ func main() {
 		config.WithEndpointResolverWithOptions(resolver),
 	)
 	if err != nil {
-		log.Fatalf("failed to load default config %e", err)
+		logger.Fatal("failed to load default config", "error", err)
 	}
 
-	svc := sqs.NewFromConfig(cfg)
+	svc := sqs.NewFromConfig(cfg, util.WithoutRetries)
 	file := os.Stdin
 
 	if *inputFile != "" {
 		file, err = os.OpenFile(*inputFile, os.O_RDONLY, 0)
 		if err != nil {
-			log.Fatalf("can't open input file %s", *inputFile)
+			logger.Fatal("can't open input file", "file", *inputFile, "error", err)
 		}
 	}
 
@@ -61,29 +189,154 @@ func main() {
 		cancelFn()
 	}()
 
-	lines := make(chan string, 1)
+	var outputResponder client.Responder
+	if *output != client.TextOutput {
+		if outputResponder, err = client.NewOutputResponder(*output, os.Stdout); err != nil {
+			logger.Fatal("invalid -output", "error", err)
+		}
+	}
+
+	codec, err := message.CodecByName(*codecName)
+	if err != nil {
+		logger.Fatal("invalid -codec", "error", err)
+	}
+
+	if err := message.CheckVersion(*protocolVersion); err != nil {
+		logger.Fatal("invalid -protocol-version", "error", err)
+	}
+
+	executor := client.NewExecutor(file, svc, *queueUrl, *namespace)
+	executor.UseCodec(codec)
+	executor.UseVersion(*protocolVersion)
+	executor.UseCompression(*compressThreshold)
+	retryPolicy := retry.Policy{MaxAttempts: *retryAttempts, BaseDelay: *retryDelay, MaxDelay: retry.DefaultPolicy.MaxDelay}
+	executor.UseRetry(retryPolicy)
+	executor.UseCredentials(message.Credentials{Principal: *principal, ApiKey: *apiKey})
+	if *keyringFile != "" {
+		keyring, err := envelope.LoadKeyring(*keyringFile)
+		if err != nil {
+			logger.Fatal("invalid -keyring", "error", err)
+		}
+		executor.UseKeyring(keyring)
+	}
+	if *signingKeys != "" {
+		keys, err := message.LoadSigningKeys(*signingKeys)
+		if err != nil {
+			logger.Fatal("invalid -signing-keys", "error", err)
+		}
+		signer, err := message.NewSigner(keys, *signingKeyId)
+		if err != nil {
+			logger.Fatal("invalid -signing-key-id", "error", err)
+		}
+		executor.UseSigner(signer)
+	}
+	if *blobStore != "" {
+		store, err := blob.Open(*blobStore, cfg)
+		if err != nil {
+			logger.Fatal("invalid -blob-store", "error", err)
+		}
+		executor.UseBlobStore(store, *offloadThreshold)
+	}
+	if *replyQueueUrl != "" {
+		replies := client.NewReplies(svc, *replyQueueUrl)
+		replies.UseRetry(retryPolicy)
+		go replies.Run(ctx)
+		executor.UseReplies(replies, *replyTimeout)
+
+		protocol, err := executor.Negotiate(ctx)
+		if err != nil {
+			logger.Fatal("can't negotiate protocol version", "error", err)
+		}
+		logger.Debug("protocol negotiated", "version", executor.Version(), "serverVersion", protocol.Version)
+	}
 	isInteractive := file == os.Stdin
 
-	go func() {
-		s := bufio.NewScanner(file)
-		for s.Scan() {
-			lines <- s.Text()
+	if isInteractive && lineedit.IsTerminal(int(os.Stdin.Fd())) {
+		var history *lineedit.History
+		if *historyFile != "" {
+			if history, err = lineedit.OpenHistory(*historyFile, historySize); err != nil {
+				logger.Warn("can't open history file", "file", *historyFile, "error", err)
+			} else {
+				defer history.Close()
+			}
 		}
-		if !isInteractive {
-			lines <- "EOF"
+		colored := lineedit.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+		responder := outputResponder
+		if responder == nil {
+			responder = client.NewInteractiveResponder(colored)
 		}
+		client.NewREPL(os.Stdin, os.Stdout, history, executor, responder, colored).Run(ctx)
+		return
+	}
+
+	lines := make(chan string, 1)
+	inputErr := make(chan error, 1)
+
+	go func() {
+		// error is sent before lines are closed, so it's known once processor runs out of lines
+		inputErr <- client.ReadLines(file, maxLineLength, lines)
+		close(lines)
 	}()
 
-	executor := client.NewExecutor(file, svc, *queueUrl)
-	var responder client.Responder
+	responder := outputResponder
 
-	if isInteractive {
-		responder = client.NewInteractiveResponder()
-	} else {
-		responder = client.NewBatchResponder()
+	if responder == nil {
+		if isInteractive {
+			responder = client.NewInteractiveResponder(false)
+		} else {
+			responder = client.NewBatchResponder(os.Stdout)
+		}
+	}
+
+	if *failFast {
+		*maxErrors = 1
+	}
+	processor := client.NewProcessor(lines, executor, responder, *maxErrors)
+
+	summary := processor.Run(ctx)
+	select {
+	case err := <-inputErr:
+		if err != nil {
+			logger.Error("can't read input", "error", err)
+			summary.FailInput()
+		}
+	default:
+	}
+	if summary.Failed() > 0 {
+		logger.Warn(
+			"some commands failed",
+			"total", summary.Total,
+			"failed", summary.Failed(),
+			"stopped", summary.Stopped,
+		)
 	}
+	if *summaryFile != "" {
+		if err := writeSummary(*summaryFile, summary); err != nil {
+			logger.Error("can't write summary", "file", *summaryFile, "error", err)
+		}
+	}
+	os.Exit(summary.ExitCode)
+}
 
-	processor := client.NewProcessor(lines, executor, responder)
+// writeSummary writes summary as JSON to file at path, or to stdout if path is -
+func writeSummary(path string, summary client.Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
 
-	processor.Run(ctx)
+// defaultHistoryFile returns path of history file in user's home directory
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".go-client-server_history")
 }
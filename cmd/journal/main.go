@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+)
+
+// filter selects journal records, empty fields match any value
+type filter struct {
+	operation     string
+	namespace     string
+	keyPattern    string
+	processor     string
+	messageId     string
+	correlationId string
+	result        string
+	since         time.Time
+	until         time.Time
+}
+
+func (f *filter) match(r journal.Record) bool {
+	if f.operation != "" && f.operation != r.Operation {
+		return false
+	}
+	if f.namespace != "" && f.namespace != r.Namespace {
+		return false
+	}
+	if f.keyPattern != "" {
+		if ok, _ := path.Match(f.keyPattern, r.Key); !ok {
+			return false
+		}
+	}
+	if f.processor != "" && f.processor != r.Processor {
+		return false
+	}
+	if f.messageId != "" && f.messageId != r.MessageId {
+		return false
+	}
+	if f.correlationId != "" && f.correlationId != r.CorrelationId {
+		return false
+	}
+	if f.result != "" && f.result != r.Result {
+		return false
+	}
+	if !f.since.IsZero() && r.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !r.Time.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+func main() {
+	logFileName := flag.String(
+		"log-file",
+		"/tmp/log.txt",
+		"server's log file, rotated segments are read as well",
+	)
+	f := filter{}
+	flag.StringVar(&f.operation, "operation", "", "show only records of given operation, e.g. Add")
+	flag.StringVar(&f.namespace, "namespace", "", "show only records in given namespace")
+	flag.StringVar(&f.keyPattern, "key", "", "show only records with key matching given pattern, e.g. user-*")
+	flag.StringVar(&f.processor, "processor", "", "show only records of given processor, e.g. processor-1 or http")
+	flag.StringVar(&f.messageId, "message-id", "", "show only records of given SQS message id")
+	flag.StringVar(&f.correlationId, "correlation-id", "", "show only records with given correlation id")
+	flag.StringVar(&f.result, "result", "", "show only records with given result, ok or error")
+	since := flag.String("since", "", "show only records at or after given RFC3339 time")
+	until := flag.String("until", "", "show only records before given RFC3339 time")
+	format := flag.String("format", "json", "output format, json or text")
+	flag.Parse()
+
+	logger := logging.Default()
+
+	var err error
+	if *since != "" {
+		if f.since, err = time.Parse(time.RFC3339, *since); err != nil {
+			logger.Fatal("invalid -since", "error", err)
+		}
+	}
+	if *until != "" {
+		if f.until, err = time.Parse(time.RFC3339, *until); err != nil {
+			logger.Fatal("invalid -until", "error", err)
+		}
+	}
+
+	var write func(journal.Record) error
+	var flush func() error
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		write = func(r journal.Record) error {
+			return encoder.Encode(r)
+		}
+		flush = func() error {
+			return nil
+		}
+	case "text":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tOPERATION\tNAMESPACE\tKEY\tVALUE\tRESULT\tERROR\tPROCESSOR\tMESSAGE ID\tCORRELATION ID")
+		write = func(r journal.Record) error {
+			_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%q\t%q\t%s\t%s\t%s\t%s\t%s\n",
+				r.Time.Format(time.RFC3339Nano), r.Operation, r.Namespace, r.Key, r.Value,
+				r.Result, r.Error, r.Processor, r.MessageId, r.CorrelationId)
+			return err
+		}
+		flush = tw.Flush
+	default:
+		logger.Fatal("unknown output format", "format", *format)
+	}
+
+	segments, err := journal.Segments(*logFileName)
+	if err != nil {
+		logger.Fatal("can't list log file segments", "error", err)
+	}
+
+	for _, segment := range segments {
+		if err := query(segment, &f, write); err != nil {
+			logger.Fatal("can't read log file segment", "segment", segment, "error", err)
+		}
+	}
+
+	if err := flush(); err != nil {
+		logger.Fatal("can't write output", "error", err)
+	}
+}
+
+// query writes matching records of segment, corrupted records are reported and skipped
+func query(segment string, f *filter, write func(journal.Record) error) error {
+	file, err := journal.OpenSegment(segment)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := journal.NewReader(file)
+	for {
+		record, err := reader.Next()
+		var corrupted *journal.CorruptedRecordError
+		switch {
+		case err == io.EOF:
+			return nil
+		case errors.As(err, &corrupted):
+			logging.Default().Warn("skipping corrupted record", "segment", segment, "line", corrupted.Line, "error", corrupted.Err)
+			continue
+		case err != nil:
+			return err
+		}
+
+		if f.match(record) {
+			if err := write(record); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+	"github.com/yosadchyi/go-client-server/pkg/client"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+	"github.com/yosadchyi/go-client-server/pkg/util"
+)
+
+func main() {
+	logFileName := flag.String(
+		"log-file",
+		"/tmp/log.txt",
+		"server's log file to replay, rotated segments are replayed as well",
+	)
+	until := flag.String(
+		"until",
+		"",
+		"replay only records before given RFC3339 time",
+	)
+	untilEntry := flag.Int(
+		"until-entry",
+		0,
+		"replay only given number of records, 0 replays all",
+	)
+	printAll := flag.Bool(
+		"print",
+		false,
+		"print reconstructed items as JSON lines",
+	)
+	diffUrl := flag.String(
+		"diff-url",
+		"",
+		"admin API of live server to compare reconstructed items with, e.g. http://localhost:8080",
+	)
+	blobStore := flag.String(
+		"blob-store",
+		os.Getenv("BLOB_STORE_URL"),
+		"store of values offloaded by clients, file:///path/to/dir or s3://bucket/prefix, such records fail if empty",
+	)
+	keyringFile := flag.String(
+		"keyring",
+		os.Getenv("KEYRING_FILE"),
+		"keyring to decrypt values with, one ID=BASE64_KEY per line, encrypted values are restored as is if empty",
+	)
+	allowTrimmed := flag.Bool(
+		"allow-trimmed",
+		false,
+		"replay log file whose oldest segments were removed by retention, items added before them are missing",
+	)
+	flag.Parse()
+
+	logger := logging.Default()
+
+	opts := server.ReplayOptions{UntilEntry: *untilEntry, AllowTrimmed: *allowTrimmed}
+	if *blobStore != "" {
+		cfg, err := config.LoadDefaultConfig(
+			context.Background(),
+			config.WithEndpointResolverWithOptions(util.LocalResolver(os.Getenv("AWS_ENDPOINT"), os.Getenv("AWS_REGION"))),
+		)
+		if err != nil {
+			logger.Fatal("failed to load default config", "error", err)
+		}
+		store, err := blob.Open(*blobStore, cfg)
+		if err != nil {
+			logger.Fatal("invalid -blob-store", "error", err)
+		}
+		// blobs aren't released, since replayed namespaces don't use them
+		opts.Blobs = server.NewBlobs(store)
+	}
+	if *keyringFile != "" {
+		keyring, err := envelope.LoadKeyring(*keyringFile)
+		if err != nil {
+			logger.Fatal("invalid -keyring", "error", err)
+		}
+		opts.Keyring = keyring
+	}
+	if *until != "" {
+		t, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			logger.Fatal("invalid -until", "error", err)
+		}
+		opts.Until = t
+	}
+
+	namespaces := server.NewNamespaces(0, nil)
+	result, err := server.Replay(*logFileName, namespaces, opts)
+	if err != nil {
+		logger.Fatal("failed to replay log file", "error", err)
+	}
+
+	for _, corrupted := range result.Corrupted {
+		logger.Warn(
+			"corrupted record",
+			"segment", corrupted.Segment,
+			"line", corrupted.Line,
+			"trailing", corrupted.Trailing,
+			"error", corrupted.Err,
+		)
+	}
+	logger.Info(
+		"log file replayed",
+		"entries", result.Entries,
+		"applied", result.Applied,
+		"failed", result.Failed,
+		"corrupted", len(result.Corrupted),
+		"lastTime", result.LastTime.Format(time.RFC3339Nano),
+	)
+
+	if *printAll {
+		printItems(namespaces)
+	}
+
+	if *diffUrl != "" {
+		admin := client.NewAdminClient(*diffUrl, &http.Client{Timeout: 30 * time.Second})
+		differences, err := diff(context.Background(), namespaces, admin)
+		if err != nil {
+			logger.Fatal("failed to compare with live server", "error", err)
+		}
+		if differences > 0 {
+			logger.Warn("reconstructed items differ from live server", "differences", differences)
+			os.Exit(1)
+		}
+		logger.Info("reconstructed items match live server")
+	}
+}
+
+func printItems(namespaces *server.Namespaces) {
+	encoder := json.NewEncoder(os.Stdout)
+	for _, namespace := range namespaces.List() {
+		storage, _ := namespaces.Lookup(namespace)
+		storage.Iterate(func(item server.Item) {
+			_ = encoder.Encode(map[string]string{
+				"namespace": namespace,
+				"key":       item.K,
+				"value":     item.V,
+			})
+		})
+	}
+}
+
+// diff prints differences between reconstructed and live items and returns their number:
+// "-" marks items present only in journal, "+" marks items present only on server, "~" marks different values
+func diff(ctx context.Context, namespaces *server.Namespaces, admin *client.AdminClient) (int, error) {
+	liveNamespaces, err := admin.Namespaces(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	all := make(map[string]bool)
+	for _, namespace := range namespaces.List() {
+		all[namespace] = true
+	}
+	for _, namespace := range liveNamespaces {
+		all[namespace] = true
+	}
+	names := make([]string, 0, len(all))
+	for namespace := range all {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+
+	differences := 0
+	for _, namespace := range names {
+		live := make(map[string]string)
+		var liveKeys []string
+		if err := admin.Items(ctx, namespace, func(item client.Item) error {
+			live[item.Key] = item.Value
+			liveKeys = append(liveKeys, item.Key)
+			return nil
+		}); err != nil {
+			return differences, err
+		}
+
+		replayed := make(map[string]bool)
+		if storage, ok := namespaces.Lookup(namespace); ok {
+			storage.Iterate(func(item server.Item) {
+				replayed[item.K] = true
+				value, ok := live[item.K]
+				switch {
+				case !ok:
+					fmt.Printf("- %s/%s: %q\n", namespace, item.K, item.V)
+					differences++
+				case value != item.V:
+					fmt.Printf("~ %s/%s: %q -> %q\n", namespace, item.K, item.V, value)
+					differences++
+				}
+			})
+		}
+		for _, key := range liveKeys {
+			if !replayed[key] {
+				fmt.Printf("+ %s/%s: %q\n", namespace, key, live[key])
+				differences++
+			}
+		}
+	}
+
+	return differences, nil
+}
@@ -2,15 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
 	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/metrics"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
 	"github.com/yosadchyi/go-client-server/pkg/server"
 	"github.com/yosadchyi/go-client-server/pkg/util"
 )
@@ -25,11 +37,56 @@ func main() {
 		runtime.NumCPU(),
 		"number of processors to be run concurrently, by default equal to system's number of CPU",
 	)
+	autoscale := flag.Bool(
+		"autoscale",
+		false,
+		"grow and shrink numbers of processors and receivers within bounds, according to buffered messages, processing latency and SQS backlog; -paralellism-degree is the initial number of processors",
+	)
+	minProcessors := flag.Int(
+		"min-processors",
+		1,
+		"minimal number of processors with -autoscale",
+	)
+	maxProcessors := flag.Int(
+		"max-processors",
+		4*runtime.NumCPU(),
+		"maximal number of processors with -autoscale",
+	)
+	minReceivers := flag.Int(
+		"min-receivers",
+		1,
+		"minimal number of concurrent SQS receivers with -autoscale",
+	)
+	maxReceivers := flag.Int(
+		"max-receivers",
+		4,
+		"maximal number of concurrent SQS receivers with -autoscale",
+	)
+	scalingInterval := flag.Duration(
+		"scaling-interval",
+		10*time.Second,
+		"interval of scaling decisions with -autoscale",
+	)
+	backlogPerReceiver := flag.Int(
+		"backlog-per-receiver",
+		100,
+		"number of messages waiting in SQS queue per receiver above which receivers are added with -autoscale",
+	)
 	queueUrl := flag.String(
 		"queue-url",
 		os.Getenv("QUEUE_URL"),
 		"SQS queue",
 	)
+	replyQueuePrefixes := flag.String(
+		"reply-queue-prefixes",
+		"",
+		"comma separated prefixes of URLs of queues replies can be sent to; if empty, queues next to -queue-url are allowed",
+	)
+	dlqUrl := flag.String(
+		"dlq-url",
+		os.Getenv("DLQ_URL"),
+		"SQS dead-letter queue for messages which can't be processed, they are left in queue if empty",
+	)
 	waitTimeSeconds := flag.Int(
 		"wait-time-seconds",
 		1,
@@ -38,10 +95,210 @@ func main() {
 	logFileName := flag.String(
 		"log-file",
 		"/tmp/log.txt",
-		"log file to store server log",
+		"log file to store server's audit journal of processed operations",
+	)
+	logFileSync := flag.String(
+		"log-file-sync",
+		string(journal.SyncInterval),
+		"when log file is synced to disk, one of always, interval, never",
+	)
+	logFileSyncInterval := flag.Duration(
+		"log-file-sync-interval",
+		time.Second,
+		"interval of log file syncing, used with -log-file-sync=interval",
+	)
+	logFileMaxSize := flag.Int64(
+		"log-file-max-size",
+		0,
+		"size in bytes after which log file is rotated, 0 disables size based rotation",
+	)
+	logFileMaxAge := flag.Duration(
+		"log-file-max-age",
+		0,
+		"age after which log file is rotated, e.g. 24h, 0 disables time based rotation",
+	)
+	logFileMaxSegments := flag.Int(
+		"log-file-max-segments",
+		0,
+		"number of rotated log file segments to retain, 0 retains all",
+	)
+	logFileCompress := flag.Bool(
+		"log-file-compress",
+		false,
+		"compress rotated log file segments with gzip",
+	)
+	namespaceMaxItems := flag.Int(
+		"namespace-max-items",
+		0,
+		"maximal number of items per namespace, 0 means unlimited",
+	)
+	namespaceLimits := flag.String(
+		"namespace-limits",
+		"",
+		"comma separated per-namespace item limits overriding -namespace-max-items, e.g. teamA=100,teamB=1000",
+	)
+	blobStore := flag.String(
+		"blob-store",
+		os.Getenv("BLOB_STORE_URL"),
+		"store of values offloaded by clients, file:///path/to/dir or s3://bucket/prefix, offloaded values are rejected if empty",
+	)
+	compressValues := flag.Int(
+		"compress-values-above",
+		0,
+		"length of value in bytes above which it's kept compressed in storage, 0 disables compression",
+	)
+	signingKeys := flag.String(
+		"signing-keys",
+		os.Getenv("SIGNING_KEYS"),
+		"file with active keys messages must be signed with, one ID=BASE64_SECRET per line, signatures aren't checked if empty",
+	)
+	signatureMaxAge := flag.Duration(
+		"signature-max-age",
+		5*time.Minute,
+		"maximal difference between signature timestamp and server time, 0 disables timestamp and replay checks",
+	)
+	keyringFile := flag.String(
+		"keyring",
+		os.Getenv("KEYRING_FILE"),
+		"keyring to decrypt values with, one ID=BASE64_KEY per line; values are stored decrypted, while journal and replies carry them encrypted; values are stored as sent if empty",
+	)
+	policyFile := flag.String(
+		"policy",
+		os.Getenv("POLICY_FILE"),
+		"JSON file granting operations to principals, reloaded on SIGHUP; all operations are allowed if empty",
+	)
+	limitsFile := flag.String(
+		"limits",
+		os.Getenv("LIMITS_FILE"),
+		"JSON file with rate limits and daily quotas per principal and namespace, messages aren't limited if empty",
+	)
+	overLimit := flag.String(
+		"over-limit",
+		string(server.OverLimitDelay),
+		"what to do with messages over limit, one of delay, reject, dead-letter",
+	)
+	maxAttempts := flag.Int(
+		"max-attempts",
+		3,
+		"number of times message failing because of panic is received before it's moved to dead-letter queue; with 0 messages are deleted before they are processed",
+	)
+	retryAttempts := flag.Int(
+		"retry-attempts",
+		retry.DefaultPolicy.MaxAttempts,
+		"number of attempts of SQS calls failing with transient or throttling errors, 1 disables retries",
+	)
+	retryDelay := flag.Duration(
+		"retry-delay",
+		retry.DefaultPolicy.BaseDelay,
+		"longest delay before the first retry of SQS call or receive, doubled for every next one, with random jitter",
+	)
+	retryMaxDelay := flag.Duration(
+		"retry-max-delay",
+		retry.DefaultPolicy.MaxDelay,
+		"longest delay between retries of SQS calls or failed receives",
+	)
+	breakerFailures := flag.Int(
+		"breaker-failures",
+		5,
+		"number of consecutive failed receives after which receiving is paused, 0 disables pausing",
+	)
+	breakerCooldown := flag.Duration(
+		"breaker-cooldown",
+		30*time.Second,
+		"time receiving is paused for once SQS keeps failing",
+	)
+	middlewareNames := flag.String(
+		"middlewares",
+		"metrics,audit,timing,recovery,validation",
+		"comma separated chain of middlewares processing messages from the outermost one, any of audit, metrics, recovery, timing, validation; audit is the outermost one if it isn't listed",
+	)
+	slowOperation := flag.Duration(
+		"slow-operation",
+		time.Second,
+		"duration above which operation is logged as slow by timing middleware, 0 disables such warnings",
+	)
+	restoreFromLog := flag.Bool(
+		"restore-from-log",
+		false,
+		"restore storage by replaying log file before processing messages",
+	)
+	httpAddr := flag.String(
+		"http-addr",
+		"",
+		"address to serve admin HTTP API on, e.g. :8080, disabled if empty",
+	)
+	logFormat := flag.String(
+		"log-format",
+		"text",
+		"log format, text or json",
+	)
+	logLevel := flag.String(
+		"log-level",
+		"info",
+		"minimal level of log entries, one of debug, info, warn, error",
 	)
 	flag.Parse()
 
+	if err := logging.Setup(*logFormat, *logLevel); err != nil {
+		logging.Default().Fatal("invalid logging options", "error", err)
+	}
+	logger := logging.Default()
+
+	limits, err := parseNamespaceLimits(*namespaceLimits)
+	if err != nil {
+		logger.Fatal("invalid namespace limits", "error", err)
+	}
+	replyPrefixes, err := queuePrefixes(*replyQueuePrefixes, *queueUrl)
+	if err != nil {
+		logger.Fatal("invalid -reply-queue-prefixes", "error", err)
+	}
+
+	var keyring *envelope.Keyring
+	if *keyringFile != "" {
+		if keyring, err = envelope.LoadKeyring(*keyringFile); err != nil {
+			logger.Fatal("invalid -keyring", "error", err)
+		}
+		logger.Info("values are decrypted", "activeKeyId", keyring.ActiveKeyId())
+	}
+
+	var authorizer *server.Authorizer
+	if *policyFile != "" {
+		if authorizer, err = server.NewAuthorizer(*policyFile); err != nil {
+			logger.Fatal("invalid -policy", "error", err)
+		}
+		logger.Info("operations are authorized", "policy", *policyFile)
+	}
+
+	var limiter *server.Limiter
+	overLimitAction, err := server.ParseOverLimitAction(*overLimit)
+	if err != nil {
+		logger.Fatal("invalid -over-limit", "error", err)
+	}
+	if overLimitAction == server.OverLimitDeadLetter && *dlqUrl == "" {
+		logger.Fatal("-over-limit=dead-letter requires -dlq-url")
+	}
+	if *limitsFile != "" {
+		limits, err := server.LoadLimits(*limitsFile)
+		if err != nil {
+			logger.Fatal("invalid -limits", "error", err)
+		}
+		limiter = server.NewLimiter(limits)
+		if authorizer != nil {
+			limiter.UseAuthorizer(authorizer)
+		}
+		logger.Info("messages are limited", "limits", *limitsFile, "overLimit", overLimitAction)
+	}
+
+	var verifier *message.Verifier
+	if *signingKeys != "" {
+		keys, err := message.LoadSigningKeys(*signingKeys)
+		if err != nil {
+			logger.Fatal("invalid -signing-keys", "error", err)
+		}
+		verifier = message.NewVerifier(keys, *signatureMaxAge)
+		logger.Info("message signatures are verified", "keyIds", keys.IDs())
+	}
+
 	ctx, cancelFn := context.WithCancel(context.Background())
 
 	cfg, err := config.LoadDefaultConfig(
@@ -49,38 +306,278 @@ func main() {
 		config.WithEndpointResolverWithOptions(resolver),
 	)
 	if err != nil {
-		log.Fatalf("failed to load default config %s", err)
+		logger.Fatal("failed to load default config", "error", err)
+	}
+
+	var blobs *server.Blobs
+	if *blobStore != "" {
+		store, err := blob.Open(*blobStore, cfg)
+		if err != nil {
+			logger.Fatal("invalid -blob-store", "error", err)
+		}
+		blobs = server.NewBlobs(store)
+		go blobs.Run(ctx)
 	}
 
-	logFile, err := os.OpenFile(*logFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, os.ModeAppend)
+	namespaces := server.NewNamespaces(*namespaceMaxItems, limits)
+	namespaces.UseBlobs(blobs)
+	namespaces.UseCompression(*compressValues)
+	if *restoreFromLog {
+		result, err := server.Replay(*logFileName, namespaces, server.ReplayOptions{Blobs: blobs, Keyring: keyring})
+		if errors.Is(err, server.ErrJournalTrimmed) {
+			logger.Fatal("can't restore from log file, its oldest segments were removed by -log-file-max-segments", "error", err)
+		}
+		if err != nil {
+			logger.Fatal("failed to restore from log file", "error", err)
+		}
+		for _, corrupted := range result.Corrupted {
+			logger.Warn("corrupted record in log file", "segment", corrupted.Segment, "line", corrupted.Line, "trailing", corrupted.Trailing, "error", corrupted.Err)
+		}
+		logger.Info("restored from log file", "entries", result.Entries, "applied", result.Applied, "failed", result.Failed)
+	}
+
+	syncPolicy, err := journal.ParseSyncPolicy(*logFileSync)
+	if err != nil {
+		logger.Fatal("invalid log file sync policy", "error", err)
+	}
+	logFile, err := journal.OpenRotatingFile(*logFileName, journal.RotateOptions{
+		MaxSize:     *logFileMaxSize,
+		MaxAge:      *logFileMaxAge,
+		MaxSegments: *logFileMaxSegments,
+		Compress:    *logFileCompress,
+	})
 	if err != nil {
-		log.Fatalf("failed to open log file %s", err)
+		logger.Fatal("failed to open log file", "error", err)
+	}
+	auditJournal := journal.NewWriter(logFile, syncPolicy, *logFileSyncInterval)
+	if keyring != nil {
+		auditJournal.UseKeyring(keyring)
+	} else {
+		logger.Warn("journal records added values as sent, use -keyring to keep them encrypted", "log", *logFileName)
 	}
 
-	sqsSvc := sqs.NewFromConfig(cfg)
+	retryPolicy := retry.Policy{MaxAttempts: *retryAttempts, BaseDelay: *retryDelay, MaxDelay: *retryMaxDelay}
+	sqsSvc := sqs.NewFromConfig(cfg, util.WithoutRetries)
 	messages := make(chan *message.Any, 128)
 	reader := server.NewReader(sqsSvc, *queueUrl, messages)
-	storage := server.NewRWLockedStorage(server.NewMemoryStorage())
+	reader.UseRetry(retryPolicy)
+	if *breakerFailures > 0 {
+		reader.UseBreaker(retry.NewBreaker(*breakerFailures, *breakerCooldown))
+	}
+	if *dlqUrl != "" {
+		deadLetters := server.NewDeadLetters(sqsSvc, *dlqUrl)
+		deadLetters.UseRetry(retryPolicy)
+		reader.UseDeadLetters(deadLetters)
+	}
 	processor := server.NewProcessor(messages)
+	replier := server.NewReplier(sqsSvc)
+	replier.UseRetry(retryPolicy)
+	replier.UseQueuePrefixes(replyPrefixes)
+	reader.UseReplier(replier)
+	if verifier != nil {
+		reader.UseVerifier(verifier)
+	}
+	if limiter != nil {
+		reader.UseLimiter(limiter, overLimitAction)
+	}
+	if *maxAttempts > 0 {
+		reader.UseAcknowledgements(*maxAttempts)
+		processor.UseAcknowledger(reader)
+		go reader.KeepPending(ctx)
+	}
+	server.RegisterGauges(metrics.DefaultRegistry, namespaces, messages)
 
-	for i := 1; i <= *parallelismDegree; i++ {
-		go processor.Run(ctx, server.NewProcessFn(i, storage, logFile))
+	middlewares, err := buildMiddlewares(*middlewareNames, middlewareOptions{
+		replier:       replier,
+		auditJournal:  auditJournal,
+		slowOperation: *slowOperation,
+		authorizer:    authorizer,
+	})
+	if err != nil {
+		logger.Fatal("invalid -middlewares", "error", err)
+	}
+	if err := server.CheckOperations(); err != nil {
+		logger.Fatal("invalid operations", "error", err)
+	}
+	handler := server.Chain(server.NewHandler(namespaces, server.HandlerOptions{Blobs: blobs, Keyring: keyring}), middlewares...)
+	// processors aren't stopped by ctx, they drain messages buffer once receivers stop, see shutdown below
+	processors := server.NewPool(context.Background(), func(ctx context.Context, id int) {
+		processor.Run(ctx, server.NewProcessFn(id, handler))
+	})
+	processors.Resize(*parallelismDegree)
+	receivers := server.NewPool(ctx, func(ctx context.Context, id int) {
+		reader.Run(ctx, int32(*waitTimeSeconds))
+	})
+	if *autoscale {
+		scaler, err := server.NewScaler(server.ScalingOptions{
+			MinProcessors:      *minProcessors,
+			MaxProcessors:      *maxProcessors,
+			MinReceivers:       *minReceivers,
+			MaxReceivers:       *maxReceivers,
+			Interval:           *scalingInterval,
+			BacklogPerReceiver: *backlogPerReceiver,
+		}, reader, processor, processors, receivers)
+		if err != nil {
+			logger.Fatal("invalid scaling options", "error", err)
+		}
+		go scaler.Run(ctx)
+		logger.Info("scaling processors and receivers", "processors", fmt.Sprintf("%d..%d", *minProcessors, *maxProcessors),
+			"receivers", fmt.Sprintf("%d..%d", *minReceivers, *maxReceivers))
 	}
 
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
+	signal.Notify(sig, os.Interrupt, syscall.SIGHUP)
 
 	go func() {
-		s := <-sig
-		log.Printf("system signal: %+v", s)
-		cancelFn()
+		for s := range sig {
+			logger.Info("system signal", "signal", s)
+			if s == syscall.SIGHUP {
+				// log file could be moved by logrotate, flush pending records to the old file and reopen it
+				if err := auditJournal.Sync(); err != nil {
+					logger.Error("error syncing log file", "error", err)
+				}
+				if err := logFile.Reopen(); err != nil {
+					logger.Error("error reopening log file", "error", err)
+				}
+				if authorizer != nil {
+					if err := authorizer.Reload(); err != nil {
+						logger.Error("error reloading policy, previous policy is kept", "policy", *policyFile, "error", err)
+					} else {
+						logger.Info("policy reloaded", "policy", *policyFile)
+					}
+				}
+				continue
+			}
+			cancelFn()
+			return
+		}
 	}()
 
-	log.Printf("waiting for messages on %s...", *queueUrl)
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		handler := server.NewAdminHandler(namespaces, reader, processor, auditJournal)
+		if authorizer != nil {
+			handler.UseAuthorizer(authorizer)
+		}
+		httpServer = &http.Server{
+			Addr:    *httpAddr,
+			Handler: handler,
+		}
+		go func() {
+			logger.Info("serving admin API", "addr", *httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("failed to serve admin API", "error", err)
+			}
+		}()
+	}
+
+	logger.Info("waiting for messages", "queueUrl", *queueUrl)
+
+	receivers.Resize(1)
+	<-ctx.Done()
+	receivers.Wait()
+	// receivers are the only senders, so buffer can be closed; processors apply and journal buffered messages
+	// before journal is closed, so that journal doesn't miss operations applied to storage
+	close(messages)
+	processors.Wait()
+
+	if httpServer != nil {
+		if err := httpServer.Shutdown(context.Background()); err != nil {
+			logger.Error("error shutting down admin API", "error", err)
+		}
+	}
+
+	if err := auditJournal.Close(); err != nil {
+		logger.Fatal("error closing log file", "error", err)
+	}
+}
 
-	reader.Run(ctx, int32(*waitTimeSeconds))
+type middlewareOptions struct {
+	replier       *server.Replier
+	auditJournal  *journal.Writer
+	slowOperation time.Duration
+	authorizer    *server.Authorizer
+}
 
-	if err := logFile.Close(); err != nil {
-		log.Fatalf("error closing log file %s", err.Error())
+// buildMiddlewares creates middlewares named in comma separated list in the same order; reply middleware is
+// always the outermost one, so failures of other middlewares are replied, and authorization is always the innermost
+// one if policy is used, so it can't be left out by mistake. Audit is added right inside reply unless it's listed,
+// since journal is needed to restore storage
+func buildMiddlewares(names string, opts middlewareOptions) ([]server.Middleware, error) {
+	middlewares := []server.Middleware{server.Reply(opts.replier)}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("middleware %s is listed twice", name)
+		}
+		seen[name] = true
+		switch name {
+		case "audit":
+			middlewares = append(middlewares, server.Audit(opts.auditJournal))
+		case "metrics":
+			middlewares = append(middlewares, server.Metrics())
+		case "recovery":
+			middlewares = append(middlewares, server.Recovery())
+		case "timing":
+			middlewares = append(middlewares, server.Timing(opts.slowOperation))
+		case "validation":
+			middlewares = append(middlewares, server.Validation())
+		default:
+			return nil, fmt.Errorf("unknown middleware %q", name)
+		}
+	}
+	if !seen["audit"] {
+		middlewares = append(middlewares[:1], append([]server.Middleware{server.Audit(opts.auditJournal)}, middlewares[1:]...)...)
+	}
+	if opts.authorizer != nil {
+		middlewares = append(middlewares, server.Authorization(opts.authorizer))
 	}
+	return middlewares, nil
+}
+
+// queuePrefixes returns prefixes of reply queues listed in value, or prefix of queues of the same account
+// and region as queueUrl if value is empty; it fails if there is no prefix, since empty one allows every queue
+func queuePrefixes(value, queueUrl string) ([]string, error) {
+	if value == "" {
+		prefix := queueUrl[:strings.LastIndex(queueUrl, "/")+1]
+		if prefix == "" {
+			return nil, fmt.Errorf("can't derive prefix from queue URL %q, list prefixes explicitly", queueUrl)
+		}
+		return []string{prefix}, nil
+	}
+	var prefixes []string
+	for _, prefix := range strings.Split(value, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("non-empty prefix expected, got %q", value)
+	}
+	return prefixes, nil
+}
+
+func parseNamespaceLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if value == "" {
+		return limits, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		namespace, limit, ok := strings.Cut(pair, "=")
+		if !ok || namespace == "" {
+			return nil, fmt.Errorf("namespace=limit expected, got %q", pair)
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("non-negative limit expected for namespace %s, got %q", namespace, limit)
+		}
+		limits[namespace] = n
+	}
+
+	return limits, nil
 }
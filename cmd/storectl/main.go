@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yosadchyi/go-client-server/pkg/client"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+	"github.com/yosadchyi/go-client-server/pkg/util"
+)
+
+// progressInterval is a number of records between progress log entries
+const progressInterval = 1000
+
+const usage = `usage: storectl COMMAND [FLAGS]
+
+commands:
+    export    write items from server's admin HTTP API to a file
+    import    send items from a file to server's SQS queue
+
+run storectl COMMAND -h to see command flags
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancelFn()
+	}()
+
+	switch os.Args[1] {
+	case "export":
+		runExport(ctx, os.Args[2:])
+	case "import":
+		runImport(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runExport(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	adminUrl := flags.String(
+		"admin-url",
+		"http://localhost:8080",
+		"server's admin API",
+	)
+	format := flags.String(
+		"format",
+		client.JSONLinesFormat,
+		"output format, jsonl or csv",
+	)
+	namespaces := flags.String(
+		"namespace",
+		"",
+		"comma separated namespaces to export, all namespaces are exported if empty",
+	)
+	outputFile := flags.String(
+		"output",
+		"",
+		"file to write items to, otherwise stdout will be used",
+	)
+	setupLogging := loggingFlags(flags)
+	_ = flags.Parse(args)
+	setupLogging()
+	logger := logging.Default()
+
+	admin := client.NewAdminClient(*adminUrl, &http.Client{Timeout: 30 * time.Second})
+
+	var names []string
+	if *namespaces != "" {
+		names = strings.Split(*namespaces, ",")
+	} else {
+		var err error
+		if names, err = admin.Namespaces(ctx); err != nil {
+			logger.Fatal("can't list namespaces", "error", err)
+		}
+	}
+
+	output := os.Stdout
+	if *outputFile != "" {
+		var err error
+		if output, err = os.Create(*outputFile); err != nil {
+			logger.Fatal("can't create output file", "file", *outputFile, "error", err)
+		}
+	}
+	buffered := bufio.NewWriter(output)
+	writer, err := client.NewRecordWriter(buffered, *format)
+	if err != nil {
+		logger.Fatal("invalid -format", "error", err)
+	}
+
+	exported := 0
+	for _, namespace := range names {
+		err := admin.Items(ctx, namespace, func(item client.Item) error {
+			exported++
+			if exported%progressInterval == 0 {
+				logger.Info("export progress", "exported", exported, "namespace", namespace)
+			}
+			return writer.Write(client.Record{Namespace: namespace, Key: item.Key, Value: item.Value})
+		})
+		if err != nil {
+			logger.Fatal("can't export namespace", "namespace", namespace, "error", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		logger.Fatal("can't write output", "error", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		logger.Fatal("can't write output", "error", err)
+	}
+	if err := output.Close(); err != nil {
+		logger.Fatal("can't write output", "error", err)
+	}
+	logger.Info("export finished", "exported", exported, "namespaces", len(names))
+}
+
+func runImport(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	queueUrl := flags.String(
+		"queue-url",
+		os.Getenv("QUEUE_URL"),
+		"SQS queue",
+	)
+	inputFile := flags.String(
+		"input",
+		"",
+		"file to read items from, otherwise stdin will be used",
+	)
+	format := flags.String(
+		"format",
+		client.JSONLinesFormat,
+		"input format, jsonl or csv",
+	)
+	conflict := flags.String(
+		"conflict",
+		string(message.ConflictOverwrite),
+		"how server handles existing keys: overwrite, skip or fail",
+	)
+	namespace := flags.String(
+		"namespace",
+		"",
+		"namespace for records without one, server's default namespace is used if empty",
+	)
+	stateFile := flags.String(
+		"state",
+		"",
+		"file to keep number of imported records in, import is resumed from it if the file exists",
+	)
+	adminUrl := flags.String(
+		"admin-url",
+		"",
+		"server's admin API, used with -conflict=fail to stop import before the first existing key",
+	)
+	keyringFile := flags.String(
+		"keyring",
+		os.Getenv("KEYRING_FILE"),
+		"keyring to encrypt values with, one ID=BASE64_KEY per line, the last key is used; values aren't encrypted if empty",
+	)
+	principal := flags.String(
+		"principal",
+		os.Getenv("PRINCIPAL"),
+		"name of client in server's authorization policy, authenticated by -api-key or signature",
+	)
+	apiKey := flags.String(
+		"api-key",
+		os.Getenv("API_KEY"),
+		"API key authenticating client, it's readable to anyone with access to the queue, so prefer signatures",
+	)
+	signingKeys := flags.String(
+		"signing-keys",
+		os.Getenv("SIGNING_KEYS"),
+		"file with keys to sign messages with, one ID=BASE64_SECRET per line, messages aren't signed if empty",
+	)
+	signingKeyId := flags.String(
+		"signing-key-id",
+		os.Getenv("SIGNING_KEY_ID"),
+		"ID of key in -signing-keys to sign messages with, may be omitted if the file has the only key",
+	)
+	retryAttempts := flags.Int(
+		"retry-attempts",
+		retry.DefaultPolicy.MaxAttempts,
+		"number of attempts to send batch failing with transient or throttling errors, and its failed messages",
+	)
+	retryDelay := flags.Duration(
+		"retry-delay",
+		retry.DefaultPolicy.BaseDelay,
+		"longest delay before the first retry of batch, doubled for every next one, with random jitter",
+	)
+	setupLogging := loggingFlags(flags)
+	_ = flags.Parse(args)
+	setupLogging()
+	logger := logging.Default()
+
+	onConflict, err := message.ParseConflictMode(*conflict)
+	if err != nil {
+		logger.Fatal("invalid -conflict", "error", err)
+	}
+
+	input := os.Stdin
+	if *inputFile != "" {
+		if input, err = os.Open(*inputFile); err != nil {
+			logger.Fatal("can't open input file", "file", *inputFile, "error", err)
+		}
+		defer input.Close()
+	}
+	reader, err := client.NewRecordReader(bufio.NewReader(input), *format)
+	if err != nil {
+		logger.Fatal("invalid -format", "error", err)
+	}
+
+	opts := client.ImportOptions{
+		Namespace:  *namespace,
+		OnConflict: onConflict,
+	}
+	if *stateFile != "" {
+		if opts.Skip, err = readState(*stateFile); err != nil {
+			logger.Fatal("can't read state file", "file", *stateFile, "error", err)
+		}
+		if opts.Skip > 0 {
+			logger.Info("resuming import", "skip", opts.Skip)
+		}
+	}
+	lastReported := opts.Skip
+	opts.Checkpoint = func(imported int) error {
+		if imported-lastReported >= progressInterval {
+			logger.Info("import progress", "imported", imported)
+			lastReported = imported
+		}
+		if *stateFile != "" {
+			return writeState(*stateFile, imported)
+		}
+		return nil
+	}
+	if *adminUrl != "" {
+		admin := client.NewAdminClient(*adminUrl, &http.Client{Timeout: 30 * time.Second})
+		opts.Exists = admin.Exists
+	}
+
+	resolver := util.LocalResolver(os.Getenv("AWS_ENDPOINT"), os.Getenv("AWS_REGION"))
+	cfg, err := config.LoadDefaultConfig(
+		ctx,
+		config.WithEndpointResolverWithOptions(resolver),
+	)
+	if err != nil {
+		logger.Fatal("failed to load default config", "error", err)
+	}
+
+	importer := client.NewImporter(sqs.NewFromConfig(cfg, util.WithoutRetries), *queueUrl)
+	importer.UseCredentials(message.Credentials{Principal: *principal, ApiKey: *apiKey})
+	importer.UseRetry(retry.Policy{MaxAttempts: *retryAttempts, BaseDelay: *retryDelay, MaxDelay: retry.DefaultPolicy.MaxDelay})
+	if *signingKeys != "" {
+		keys, err := message.LoadSigningKeys(*signingKeys)
+		if err != nil {
+			logger.Fatal("invalid -signing-keys", "error", err)
+		}
+		signer, err := message.NewSigner(keys, *signingKeyId)
+		if err != nil {
+			logger.Fatal("invalid -signing-key-id", "error", err)
+		}
+		importer.UseSigner(signer)
+	}
+	if *keyringFile != "" {
+		keyring, err := envelope.LoadKeyring(*keyringFile)
+		if err != nil {
+			logger.Fatal("invalid -keyring", "error", err)
+		}
+		importer.UseKeyring(keyring)
+	}
+	imported, err := importer.Import(ctx, reader, opts)
+	if err != nil {
+		logger.Fatal("import failed", "imported", imported, "error", err)
+	}
+
+	if *stateFile != "" {
+		if err := os.Remove(*stateFile); err != nil && !os.IsNotExist(err) {
+			logger.Warn("can't remove state file", "file", *stateFile, "error", err)
+		}
+	}
+	logger.Info("import finished", "imported", imported)
+}
+
+// loggingFlags defines logging flags and returns function which sets up logging once flags are parsed
+func loggingFlags(flags *flag.FlagSet) func() {
+	logFormat := flags.String(
+		"log-format",
+		"text",
+		"log format, text or json",
+	)
+	logLevel := flags.String(
+		"log-level",
+		"info",
+		"minimal level of log entries, one of debug, info, warn, error",
+	)
+	return func() {
+		if err := logging.Setup(*logFormat, *logLevel); err != nil {
+			logging.Default().Fatal("invalid logging options", "error", err)
+		}
+	}
+}
+
+// readState returns number of records imported before, 0 if state file doesn't exist
+func readState(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// writeState replaces state file atomically, so it is never left half-written
+func writeState(path string, imported int) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := fmt.Fprintf(tmp, "%d\n", imported); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -14,4 +14,10 @@ create_queue() {
 }
 
 create_queue "queue"
+create_queue "replies"
+create_queue "dlq"
+
+echo "configuring s3"
+echo "==================="
+awslocal --endpoint-url=http://${LOCALSTACK_HOST}:4566 s3 mb s3://values --region ${AWS_REGION}
 echo "done"
\ No newline at end of file
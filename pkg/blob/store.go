@@ -0,0 +1,84 @@
+// Package blob keeps values which are too large to be sent in SQS messages, messages carry keys of blobs instead
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ErrNotFound is returned by Get when there is no blob with given key
+var ErrNotFound = errors.New("blob not found")
+
+// Store stores blobs by keys, keys consist of letters, digits, '.', '_', '-' and '/' separating path segments
+type Store interface {
+	// Put stores blob, replacing existing blob with the same key
+	Put(ctx context.Context, key string, value []byte) error
+	// Get returns blob or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete deletes blob, deleting missing blob isn't an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewKey returns random key for new blob
+func NewKey() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return "values/" + hex.EncodeToString(id)
+}
+
+// Open opens store by URL: file:///path/to/dir for directory on local filesystem or s3://bucket/prefix for S3 bucket
+func Open(rawUrl string, cfg aws.Config) (Store, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		dir := u.Path
+		if dir == "" {
+			dir = u.Opaque
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("directory expected in %q", rawUrl)
+		}
+		return NewFileStore(dir), nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("bucket expected in %q", rawUrl)
+		}
+		prefix := strings.TrimPrefix(u.Path, "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		return NewS3Store(cfg, u.Host, prefix), nil
+	}
+	return nil, fmt.Errorf("unsupported blob store %q, file:// or s3:// expected", rawUrl)
+}
+
+// checkKey checks that key is relative path without references to parent directories
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-' || r == '/') {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package blob_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store := blob.NewFileStore(t.TempDir())
+	key := blob.NewKey()
+
+	_, err := store.Get(ctx, key)
+	assert.Equal(t, blob.ErrNotFound, err)
+
+	assert.NoError(t, store.Put(ctx, key, []byte("value")))
+	assert.NoError(t, store.Put(ctx, key, []byte("new value")))
+	value, err := store.Get(ctx, key)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "new value", string(value))
+	}
+
+	assert.NoError(t, store.Delete(ctx, key))
+	assert.NoError(t, store.Delete(ctx, key), "deleting missing blob")
+	_, err = store.Get(ctx, key)
+	assert.Equal(t, blob.ErrNotFound, err)
+
+	for _, invalid := range []string{"", "/etc/passwd", "values/../../etc/passwd", "values//1", "a b"} {
+		assert.Error(t, store.Put(ctx, invalid, []byte("value")), invalid)
+		_, err := store.Get(ctx, invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := map[string]struct {
+		url      string
+		expected interface{}
+		wantErr  bool
+	}{
+		"absolute directory": {url: "file:///tmp/blobs", expected: &blob.FileStore{}},
+		"relative directory": {url: "file:blobs", expected: &blob.FileStore{}},
+		"bucket":             {url: "s3://values/prefix", expected: &blob.S3Store{}},
+		"no directory":       {url: "file://", wantErr: true},
+		"no bucket":          {url: "s3:///prefix", wantErr: true},
+		"unknown scheme":     {url: "ftp://host/dir", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			store, err := blob.Open(tt.url, aws.Config{})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.IsType(t, tt.expected, store)
+			}
+		})
+	}
+}
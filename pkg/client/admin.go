@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// adminPageSize is a number of items requested from admin API at once
+const adminPageSize = 1000
+
+// Item is an item as returned by server's admin API
+type Item struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type itemsPage struct {
+	Total int    `json:"total"`
+	Items []Item `json:"items"`
+}
+
+var errNotFound = errors.New("not found")
+
+// AdminClient is a client of server's admin HTTP API
+type AdminClient struct {
+	baseUrl    string
+	httpClient *http.Client
+}
+
+// NewAdminClient creates new admin API client for server at baseUrl, e.g. http://localhost:8080
+func NewAdminClient(baseUrl string, httpClient *http.Client) *AdminClient {
+	return &AdminClient{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Namespaces returns names of namespaces existing on server
+func (c *AdminClient) Namespaces(ctx context.Context) ([]string, error) {
+	var namespaces []string
+	if err := c.get(ctx, "/namespaces", &namespaces); err != nil {
+		return nil, err
+	}
+	return namespaces, nil
+}
+
+// Exists reports whether item with given key exists in namespace
+func (c *AdminClient) Exists(ctx context.Context, namespace, key string) (bool, error) {
+	query := url.Values{}
+	query.Set("namespace", namespace)
+
+	var item Item
+	err := c.get(ctx, "/items/"+url.PathEscape(key)+"?"+query.Encode(), &item)
+	if err == errNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Items calls accept for every item in namespace in insertion order, fetching items page by page
+func (c *AdminClient) Items(ctx context.Context, namespace string, accept func(Item) error) error {
+	for offset := 0; ; offset += adminPageSize {
+		query := url.Values{}
+		query.Set("namespace", namespace)
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("limit", strconv.Itoa(adminPageSize))
+
+		var page itemsPage
+		if err := c.get(ctx, "/items?"+query.Encode(), &page); err != nil {
+			return err
+		}
+		for _, item := range page.Items {
+			if err := accept(item); err != nil {
+				return err
+			}
+		}
+		if len(page.Items) < adminPageSize || offset+len(page.Items) >= page.Total {
+			return nil
+		}
+	}
+}
+
+func (c *AdminClient) get(ctx context.Context, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("admin API %s returned %s: %s", path, resp.Status, body.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// commandSigils are first characters of commands, they are offered for completion of empty line
+var commandSigils = []string{"+", "-", "<", "*", "~", "!"}
+
+// commandVerbs are names of long form commands
+var commandVerbs = []string{"add", "del", "drop", "get", "list", "namespaces"}
+
+// KeySet keeps keys and namespaces used in the session or returned by server, they are offered for completion
+type KeySet struct {
+	// namespace is executor's namespace, its keys are completed without namespace prefix
+	namespace string
+	keys      map[string]map[string]struct{}
+}
+
+// NewKeySet creates new empty key set, namespace is the one used for keys which are not prefixed with namespace
+func NewKeySet(namespace string) *KeySet {
+	return &KeySet{
+		namespace: namespace,
+		keys:      make(map[string]map[string]struct{}),
+	}
+}
+
+// Learn updates set with message sent to server: added and requested keys are remembered,
+// removed keys and dropped namespaces are forgotten
+func (s *KeySet) Learn(msg message.Message) {
+	switch m := msg.(type) {
+	case message.Add:
+		s.add(m.Namespace, m.Key)
+	case message.Get:
+		s.add(m.Namespace, m.Key)
+	case message.GetAll:
+		s.add(m.Namespace, "")
+	case message.Remove:
+		delete(s.keys[m.Namespace], m.Key)
+	case message.DropNamespace:
+		delete(s.keys, m.Namespace)
+	}
+}
+
+// LearnReply remembers keys and namespaces returned by server, reply can be nil
+func (s *KeySet) LearnReply(reply *message.Reply) {
+	if reply == nil {
+		return
+	}
+	for _, item := range reply.Items {
+		s.add(reply.Namespace, item.Key)
+	}
+	for _, namespace := range reply.Namespaces {
+		s.add(namespace, "")
+	}
+}
+
+// Complete returns candidates to replace text before cursor with, it completes commands, keys and namespaces
+func (s *KeySet) Complete(head string) []string {
+	if head == "" {
+		return append(append([]string(nil), commandSigils...), commandVerbs...)
+	}
+	if verb, arg, ok := strings.Cut(head, " "); ok || isLetter(head[0]) {
+		return s.completeVerb(verb, arg, ok)
+	}
+
+	sigil, arg := head[:1], head[1:]
+	var words []string
+	switch sigil {
+	case "+":
+		if strings.Contains(arg, ":") {
+			return nil
+		}
+		words = s.qualifiedKeys()
+	case "-", "<":
+		words = s.qualifiedKeys()
+	case "*", "!":
+		words = s.namespaces()
+	}
+
+	var candidates []string
+	for _, word := range words {
+		if strings.HasPrefix(word, arg) {
+			candidates = append(candidates, sigil+word)
+		}
+	}
+	return candidates
+}
+
+// completeVerb completes verb, or its argument if verb is followed by space
+func (s *KeySet) completeVerb(verb, arg string, hasArg bool) []string {
+	var candidates []string
+	if !hasArg {
+		for _, candidate := range commandVerbs {
+			if strings.HasPrefix(candidate, verb) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		return candidates
+	}
+
+	var words []string
+	switch verb {
+	case "add", "del", "get":
+		words = s.qualifiedKeys()
+	case "drop", "list":
+		words = s.namespaces()
+	}
+	if strings.Contains(arg, " ") {
+		return nil
+	}
+	for _, word := range words {
+		if strings.HasPrefix(word, arg) {
+			candidates = append(candidates, verb+" "+word)
+		}
+	}
+	return candidates
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func (s *KeySet) add(namespace, key string) {
+	keys, ok := s.keys[namespace]
+	if !ok {
+		keys = make(map[string]struct{})
+		s.keys[namespace] = keys
+	}
+	if key != "" {
+		keys[key] = struct{}{}
+	}
+}
+
+// qualifiedKeys returns sorted keys, prefixed with namespace unless they are in executor's namespace
+func (s *KeySet) qualifiedKeys() []string {
+	var words []string
+	for namespace, keys := range s.keys {
+		for key := range keys {
+			if namespace == s.namespace {
+				words = append(words, quoteArg(key))
+			} else {
+				words = append(words, quoteArg(namespace)+"/"+quoteArg(key))
+			}
+		}
+	}
+	sort.Strings(words)
+	return words
+}
+
+// namespaces returns sorted names of namespaces, executor's namespace is omitted if it's server's default one
+func (s *KeySet) namespaces() []string {
+	var words []string
+	for namespace := range s.keys {
+		if namespace != "" {
+			words = append(words, quoteArg(namespace))
+		}
+	}
+	sort.Strings(words)
+	return words
+}
+
+// quoteArg quotes argument which is parsed differently unquoted: it contains quotes, / or : which split keys,
+// or starts with # which starts a comment after a space
+func quoteArg(arg string) string {
+	if !strings.ContainsAny(arg, `"'/:`) && !strings.HasPrefix(arg, "#") {
+		return arg
+	}
+	if !strings.Contains(arg, "'") {
+		return "'" + arg + "'"
+	}
+	return strconv.Quote(arg)
+}
@@ -0,0 +1,58 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/client"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+func TestKeySet_Complete(t *testing.T) {
+	keys := client.NewKeySet("teamA")
+	keys.Learn(message.NewAdd("teamA", "user-1", "A"))
+	keys.Learn(message.NewAdd("teamA", "user-2", "B"))
+	keys.Learn(message.NewAdd("teamA", "order-1", "C"))
+	keys.Learn(message.NewGet("teamB", "user-3"))
+	keys.Learn(message.NewAdd("teamC", "1", "D"))
+	keys.Learn(message.NewRemove("teamA", "order-1"))
+	keys.Learn(message.NewDropNamespace("teamC"))
+
+	cases := map[string][]string{
+		"":       {"+", "-", "<", "*", "~", "!", "add", "del", "drop", "get", "list", "namespaces"},
+		"d":      {"del", "drop"},
+		"get u":  {"get user-1", "get user-2"},
+		"add u ": nil,
+		"list ":  {"list teamA", "list teamB"},
+		"<":      {"<teamB/user-3", "<user-1", "<user-2"},
+		"-user":  {"-user-1", "-user-2"},
+		"+team":  {"+teamB/user-3"},
+		"+user:": nil,
+		"<x":     nil,
+		"*":      {"*teamA", "*teamB"},
+		"!teamB": {"!teamB"},
+		"~":      nil,
+	}
+
+	for head, expected := range cases {
+		assert.Equal(t, expected, keys.Complete(head), head)
+	}
+}
+
+func TestKeySet_CompleteQuoted(t *testing.T) {
+	keys := client.NewKeySet("teamA")
+	keys.Learn(message.NewAdd("teamA", "#tag", "A"))
+	keys.Learn(message.NewAdd("teamA", "a/b", "B"))
+	keys.Learn(message.NewAdd("teamA", `it's`, "C"))
+	keys.Learn(message.NewGet("#team", "1"))
+
+	candidates := keys.Complete("get ")
+	assert.Equal(t, []string{`get "it's"`, `get '#tag'`, `get '#team'/1`, `get 'a/b'`}, candidates)
+	for _, candidate := range candidates {
+		msg, err := client.Parse(candidate, "teamA")
+		if assert.NoError(t, err, candidate) {
+			assert.Contains(t, []string{"#tag", "a/b", "it's", "1"}, msg.(message.Get).Key, candidate)
+		}
+	}
+	assert.Equal(t, []string{"*'#team'", "*teamA"}, keys.Complete("*"))
+}
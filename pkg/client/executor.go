@@ -3,18 +3,26 @@ package client
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
 	"github.com/yosadchyi/go-client-server/pkg/message"
-	"github.com/yosadchyi/go-client-server/pkg/util"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
 )
 
 var (
-	KeyValueExpected = errors.New("key/value expected")
-	UnknownCommand   = errors.New("unknown command")
+	KeyValueExpected  = errors.New("key/value expected")
+	NamespaceExpected = errors.New("namespace expected")
+	UnknownCommand    = errors.New("unknown command")
+	ReplyTimeout      = errors.New("no reply from server")
+	Unsupported       = errors.New("operation isn't supported by server")
 )
 
 // Executor is and executor of the commands, provided as text
@@ -22,51 +30,384 @@ type Executor struct {
 	inputFile *os.File
 	sqsClient *sqs.Client
 	queueUrl  string
+	namespace string
+	// replies are used to wait for server's reply, if set
+	replies      *Replies
+	replyTimeout time.Duration
+	codec        message.Codec
+	// version is a protocol version of sent messages
+	version string
+	// protocol is a protocol supported by server, if negotiated
+	protocol *message.Protocol
+	// blobs store values longer than offloadThreshold, if set
+	blobs            blob.Store
+	offloadThreshold int
+	// compressThreshold is a length of encoded message in bytes above which it's compressed, 0 disables compression
+	compressThreshold int
+	// signer signs sent messages, if set
+	signer *message.Signer
+	// keyring encrypts values of sent messages and decrypts values in replies, if set
+	keyring *envelope.Keyring
+	// credentials identify client to server
+	credentials message.Credentials
+	// retry defines how failed sends are retried
+	retry retry.Policy
 }
 
-// NewExecutor creates new executor
-func NewExecutor(inputFile *os.File, sqsClient *sqs.Client, queueUrl string) *Executor {
+// NewExecutor creates new executor, namespace is used for keys which are not prefixed with namespace
+func NewExecutor(inputFile *os.File, sqsClient *sqs.Client, queueUrl string, namespace string) *Executor {
 	return &Executor{
 		inputFile: inputFile,
 		sqsClient: sqsClient,
 		queueUrl:  queueUrl,
+		namespace: namespace,
+		codec:     message.JSONCodec,
+		version:   message.ProtocolVersion,
+		retry:     retry.DefaultPolicy,
 	}
 }
 
-// ExecuteCmd executes command
-func (e *Executor) ExecuteCmd(ctx context.Context, line string) error {
-	var msg util.JSONEr
+// UseBlobStore makes executor store values longer than threshold in blob store and send their keys instead,
+// values returned by server as blob keys are read from the store too
+func (e *Executor) UseBlobStore(store blob.Store, threshold int) {
+	e.blobs = store
+	e.offloadThreshold = threshold
+}
+
+// UseCompression makes executor compress encoded messages longer than threshold, if server supports it
+func (e *Executor) UseCompression(threshold int) {
+	e.compressThreshold = threshold
+}
+
+// UseSigner makes executor sign sent messages
+func (e *Executor) UseSigner(signer *message.Signer) {
+	e.signer = signer
+}
+
+// UseCredentials makes executor send principal and API key with messages
+func (e *Executor) UseCredentials(credentials message.Credentials) {
+	e.credentials = credentials
+}
+
+// UseKeyring makes executor encrypt values before they are sent or offloaded, and decrypt encrypted values in replies
+func (e *Executor) UseKeyring(keyring *envelope.Keyring) {
+	e.keyring = keyring
+}
+
+// UseRetry makes executor retry sends failing with transient or throttling errors according to policy,
+// retry.DefaultPolicy is used by default
+func (e *Executor) UseRetry(policy retry.Policy) {
+	e.retry = policy
+}
+
+// UseVersion makes executor send messages with given protocol version, the latest one is used by default
+func (e *Executor) UseVersion(version string) {
+	e.version = version
+}
+
+// Negotiate requests server's capabilities and switches to the latest protocol version supported by both sides,
+// server which doesn't reply is assumed to support protocol version 1 only; replies must be used
+func (e *Executor) Negotiate(ctx context.Context) (message.Protocol, error) {
+	protocol := message.Protocol{
+		Version:       message.Version1,
+		MajorVersions: []int{1},
+		Operations:    message.Operations(message.Version1),
+	}
+
+	if e.replies == nil {
+		return protocol, errors.New("replies are required to negotiate protocol version")
+	}
+
+	reply, err := e.Send(ctx, message.NewCapabilities())
+	switch {
+	case err == ReplyTimeout:
+		logging.Default().Warn("no reply to capabilities request, assuming protocol version " + message.Version1)
+	case err != nil:
+		return protocol, err
+	case reply.Protocol == nil:
+		return protocol, errors.New("server didn't report its capabilities")
+	default:
+		protocol = *reply.Protocol
+	}
+
+	version, err := protocol.Negotiate(e.version)
+	if err != nil {
+		return protocol, err
+	}
+	e.version = version
+	e.protocol = &protocol
+	return protocol, nil
+}
+
+// Version returns protocol version of sent messages
+func (e *Executor) Version() string {
+	return e.version
+}
 
-	cmd := line[0]
-	data := line[1:]
+// UseCodec makes executor encode messages with given codec, JSON is used by default
+func (e *Executor) UseCodec(codec message.Codec) {
+	e.codec = codec
+}
+
+// UseReplies makes executor request replies from server and wait for them at most timeout
+func (e *Executor) UseReplies(replies *Replies, timeout time.Duration) {
+	e.replies = replies
+	e.replyTimeout = timeout
+}
+
+// Execute parses and executes command
+func (e *Executor) Execute(ctx context.Context, line string) Result {
+	result := Result{Command: line}
 
-	switch cmd {
-	case '+':
-		if idx := strings.Index(data, ":"); idx >= 0 {
-			msg = message.NewAdd(data[:idx], data[idx+1:])
-		} else {
-			return KeyValueExpected
+	msg, err := e.ParseCmd(line)
+	if err != nil {
+		result.Status = StatusParseError
+		result.Err = err
+		return result
+	}
+	if msg, err = e.encrypt(msg); err != nil {
+		result.Status = StatusParseError
+		result.Err = err
+		return result
+	}
+	msg, value := e.offload(msg)
+	result.Message = msg
+	if err := message.Validate(message.WithVersion(msg, e.version)); err != nil {
+		result.Status = StatusParseError
+		result.Err = err
+		return result
+	}
+	if e.protocol != nil && !e.protocol.Supports(msg.Meta().Operation) {
+		result.Status = StatusSendError
+		result.Err = Unsupported
+		return result
+	}
+	if value != "" {
+		if err := e.blobs.Put(ctx, msg.(message.Add).DataRef, []byte(value)); err != nil {
+			result.Status = StatusSendError
+			result.Err = fmt.Errorf("can't store value: %w", err)
+			return result
 		}
-	case '-':
-		msg = message.NewRemove(data)
-	case '<':
-		msg = message.NewGet(data)
-	case '*':
-		msg = message.NewGetAll()
 	}
 
-	if msg == nil {
-		return UnknownCommand
+	reply, err := e.Send(ctx, msg)
+	if err == nil && reply != nil {
+		err = e.resolveReply(ctx, reply)
+	}
+	if err == nil && reply != nil {
+		err = e.decryptReply(reply)
 	}
+	result.Reply = reply
+	switch {
+	case err != nil:
+		result.Status = StatusSendError
+		result.Err = err
+	case reply != nil && reply.Status == message.StatusError:
+		result.Status = StatusServerError
+		result.Err = &ServerError{Message: reply.Error, Code: reply.Code}
+	default:
+		result.Status = StatusOk
+	}
+	return result
+}
 
-	_, err := e.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    aws.String(e.queueUrl),
-		MessageBody: msg.ToJSON(),
-	})
+// encrypt encrypts value of Add if keyring is used
+func (e *Executor) encrypt(msg message.Message) (message.Message, error) {
+	add, ok := msg.(message.Add)
+	if !ok || e.keyring == nil {
+		return msg, nil
+	}
+	data, err := e.keyring.Encrypt(add.Data, add.Key)
+	if err != nil {
+		return nil, fmt.Errorf("can't encrypt value: %w", err)
+	}
+	add.Data = data
+	return add, nil
+}
+
+// decryptReply decrypts encrypted values in reply, values which aren't encrypted are left as is
+func (e *Executor) decryptReply(reply *message.Reply) error {
+	if reply.Value != nil {
+		value, err := e.decrypt(*reply.Value, reply.Key)
+		if err != nil {
+			return err
+		}
+		reply.Value = &value
+	}
+	for i, item := range reply.Items {
+		value, err := e.decrypt(item.Value, item.Key)
+		if err != nil {
+			return err
+		}
+		reply.Items[i].Value = value
+	}
+	return nil
+}
+
+func (e *Executor) decrypt(value string, key string) (string, error) {
+	if !envelope.IsEncrypted(value) {
+		return value, nil
+	}
+	if e.keyring == nil {
+		return "", fmt.Errorf("value of %s is encrypted, keyring is required to read it", key)
+	}
+	plaintext, err := e.keyring.Decrypt(value, key)
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt value of %s: %w", key, err)
+	}
+	return plaintext, nil
+}
+
+// offload moves value of Add longer than threshold to blob with new key, it returns modified message and value
+// to be stored; values are offloaded only if blob store is used and protocol version supports it. Blob isn't deleted
+// if message can't be sent, since error doesn't guarantee that server didn't receive it
+func (e *Executor) offload(msg message.Message) (message.Message, string) {
+	add, ok := msg.(message.Add)
+	if !ok || e.blobs == nil || len(add.Data) <= e.offloadThreshold || !message.AtLeast(e.version, message.Version21) {
+		return msg, ""
+	}
+	value := add.Data
+	add.Data = ""
+	add.DataRef = blob.NewKey()
+	return add, value
+}
+
+// resolveReply reads values returned by server as blob keys
+func (e *Executor) resolveReply(ctx context.Context, reply *message.Reply) error {
+	if reply.ValueRef != "" {
+		value, err := e.readBlob(ctx, reply.ValueRef)
+		if err != nil {
+			return err
+		}
+		reply.Value = &value
+		reply.ValueRef = ""
+	}
+	for i, item := range reply.Items {
+		if item.Ref == "" {
+			continue
+		}
+		value, err := e.readBlob(ctx, item.Ref)
+		if err != nil {
+			return err
+		}
+		reply.Items[i] = message.Item{Key: item.Key, Value: value}
+	}
+	return nil
+}
+
+func (e *Executor) readBlob(ctx context.Context, ref string) (string, error) {
+	if e.blobs == nil {
+		return "", fmt.Errorf("value is stored in blob %s, blob store is required to read it", ref)
+	}
+	value, err := e.blobs.Get(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("can't read value from blob %s: %w", ref, err)
+	}
+	return string(value), nil
+}
+
+// ParseCmd parses command into message, see Parse for syntax
+func (e *Executor) ParseCmd(line string) (message.Message, error) {
+	return Parse(line, e.namespace)
+}
+
+// Send sends message to server and waits for reply if replies are used, otherwise returned reply is nil
+func (e *Executor) Send(ctx context.Context, msg message.Message) (*message.Reply, error) {
+	msg = message.WithVersion(msg, e.version)
+
+	var replies <-chan *message.Reply
+	if e.replies != nil {
+		msg = message.WithReplyTo(msg, e.replies.QueueUrl())
+		replies = e.replies.Expect(msg.Meta().CorrelationId)
+		defer e.replies.Forget(msg.Meta().CorrelationId)
+	}
+
+	meta := msg.Meta()
+	logger := logging.Default().With(
+		"operation", meta.Operation,
+		"namespace", meta.Namespace,
+		"correlationId", meta.CorrelationId,
+	)
 
+	body, err := e.codec.Encode(msg)
 	if err != nil {
+		return nil, err
+	}
+	attributes := map[string]string{message.ContentTypeAttribute: e.codec.ContentType()}
+	if compressed, ok := e.compress(body); ok {
+		logger.Debug("message compressed", "size", len(body), "compressedSize", len(compressed))
+		body = compressed
+		attributes[message.ContentEncodingAttribute] = message.GzipEncoding
+	}
+	e.credentials.SetAttributes(attributes)
+	if e.signer != nil {
+		e.signer.Sign(attributes, body, time.Now())
+	}
+	var out *sqs.SendMessageOutput
+	err = loggedRetries(e.retry, logger).Do(ctx, func(ctx context.Context) error {
+		out, err = e.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:          aws.String(e.queueUrl),
+			MessageBody:       aws.String(body),
+			MessageAttributes: messageAttributes(attributes),
+		})
 		return err
+	})
+
+	if err != nil {
+		logger.Debug("error sending message", "error", err)
+		return nil, err
 	}
 
-	return nil
+	logger.Debug("message sent", "messageId", aws.ToString(out.MessageId))
+
+	if replies == nil {
+		return nil, nil
+	}
+	select {
+	case reply := <-replies:
+		logger.Debug("reply received", "status", reply.Status)
+		return reply, nil
+	case <-time.After(e.replyTimeout):
+		return nil, ReplyTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// compress compresses body longer than compressThreshold if server supports compression,
+// body which doesn't become shorter is sent as is
+func (e *Executor) compress(body string) (string, bool) {
+	if e.compressThreshold <= 0 || len(body) <= e.compressThreshold || !message.AtLeast(e.version, message.Version22) {
+		return "", false
+	}
+	compressed, err := message.CompressBody(body)
+	if err != nil || len(compressed) >= len(body) {
+		return "", false
+	}
+	return compressed, true
+}
+
+// messageAttributes converts attributes to SQS string attributes
+func messageAttributes(attributes map[string]string) map[string]types.MessageAttributeValue {
+	result := make(map[string]types.MessageAttributeValue, len(attributes))
+	for name, value := range attributes {
+		result[name] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	return result
+}
+
+// Namespace returns namespace used for keys which are not prefixed with namespace
+func (e *Executor) Namespace() string {
+	return e.namespace
+}
+
+// loggedRetries returns policy which logs retries with logger
+func loggedRetries(policy retry.Policy, logger *logging.Logger) retry.Policy {
+	policy.OnRetry = func(attempt int, class retry.Class, delay time.Duration, err error) {
+		logger.Debug("retrying send", "attempt", attempt, "class", class, "delay", delay, "error", err)
+	}
+	return policy
 }
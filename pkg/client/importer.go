@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+)
+
+// importBatchSize is a maximal number of messages SQS accepts in one batch
+const importBatchSize = 10
+
+var KeyExists = errors.New("key already exists")
+
+// ImportOptions defines how records are imported
+type ImportOptions struct {
+	// Namespace is used for records without namespace
+	Namespace string
+	// OnConflict defines how server handles records with existing keys
+	OnConflict message.ConflictMode
+	// Skip is a number of records imported before, they are read but not sent, which allows to resume failed import
+	Skip int
+	// Checkpoint is called with number of records imported so far after every sent batch
+	Checkpoint func(imported int) error
+	// Exists, if set, is used in fail conflict mode to stop import before sending record with existing key
+	Exists func(ctx context.Context, namespace, key string) (bool, error)
+}
+
+// Importer sends records to server as Add messages
+type Importer struct {
+	sqsClient *sqs.Client
+	queueUrl  string
+	// signer signs sent messages, if set
+	signer *message.Signer
+	// keyring encrypts values of records, if set
+	keyring *envelope.Keyring
+	// credentials identify importer to server
+	credentials message.Credentials
+	// retry defines how failed batches and their failed entries are retried
+	retry retry.Policy
+}
+
+// NewImporter creates new importer
+func NewImporter(sqsClient *sqs.Client, queueUrl string) *Importer {
+	return &Importer{
+		sqsClient: sqsClient,
+		queueUrl:  queueUrl,
+		retry:     retry.DefaultPolicy,
+	}
+}
+
+// UseSigner makes importer sign sent messages
+func (i *Importer) UseSigner(signer *message.Signer) {
+	i.signer = signer
+}
+
+// UseCredentials makes importer send principal and API key with messages
+func (i *Importer) UseCredentials(credentials message.Credentials) {
+	i.credentials = credentials
+}
+
+// UseRetry makes importer retry batches failing with transient or throttling errors, and failed entries of
+// batches, according to policy; retry.DefaultPolicy is used by default
+func (i *Importer) UseRetry(policy retry.Policy) {
+	i.retry = policy
+}
+
+// UseKeyring makes importer encrypt values of records, values which are encrypted already, e.g. exported
+// from server which stores ciphertext, are sent as is
+func (i *Importer) UseKeyring(keyring *envelope.Keyring) {
+	i.keyring = keyring
+}
+
+// Import sends records in batches and returns number of records imported, including skipped ones;
+// in case of error the number can be used as ImportOptions.Skip to resume import
+func (i *Importer) Import(ctx context.Context, reader RecordReader, opts ImportOptions) (int, error) {
+	imported := 0
+	batch := make([]importEntry, 0, importBatchSize)
+	batchSize := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := i.sendBatch(ctx, batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		batchSize = 0
+		if opts.Checkpoint != nil {
+			return opts.Checkpoint(imported)
+		}
+		return nil
+	}
+
+	for n := 1; ; n++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, fmt.Errorf("record %d: %w", n, err)
+		}
+		if n <= opts.Skip {
+			imported++
+			continue
+		}
+
+		namespace := record.Namespace
+		if namespace == "" {
+			namespace = opts.Namespace
+		}
+		if opts.OnConflict == message.ConflictFail && opts.Exists != nil {
+			exists, err := opts.Exists(ctx, namespace, record.Key)
+			if err != nil {
+				return imported, fmt.Errorf("record %d: %w", n, err)
+			}
+			if exists {
+				if err := flush(); err != nil {
+					return imported, err
+				}
+				return imported, fmt.Errorf("record %d: %w: %s/%s", n, KeyExists, namespace, record.Key)
+			}
+		}
+
+		value := record.Value
+		if i.keyring != nil && !envelope.IsEncrypted(value) {
+			if value, err = i.keyring.Encrypt(value, record.Key); err != nil {
+				return imported, fmt.Errorf("record %d: can't encrypt value: %w", n, err)
+			}
+		}
+		add := message.NewAdd(namespace, record.Key, value)
+		add.OnConflict = opts.OnConflict
+		body, err := message.JSONCodec.Encode(add)
+		if err != nil {
+			return imported, fmt.Errorf("record %d: %w", n, err)
+		}
+		// total size of batch is limited by size of one message
+		if batchSize+len(body) > message.MaxBodySize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+		batch = append(batch, importEntry{add: add, body: body})
+		batchSize += len(body)
+
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+
+	return imported, flush()
+}
+
+// importEntry is a message to be sent in batch along with its encoded body
+type importEntry struct {
+	add  message.Add
+	body string
+}
+
+// sendBatch sends messages in one SQS batch, retrying failed entries; if batch fails partially, messages
+// which were sent are sent again on resume, so they are processed by server twice
+func (i *Importer) sendBatch(ctx context.Context, batch []importEntry) error {
+	pending := make(map[string]importEntry, len(batch))
+	for idx, entry := range batch {
+		pending[strconv.Itoa(idx)] = entry
+	}
+
+	for attempt := 1; ; attempt++ {
+		entries := make([]types.SendMessageBatchRequestEntry, 0, len(pending))
+		for id, entry := range pending {
+			request := types.SendMessageBatchRequestEntry{
+				Id:          aws.String(id),
+				MessageBody: aws.String(entry.body),
+			}
+			attributes := map[string]string{}
+			i.credentials.SetAttributes(attributes)
+			if i.signer != nil {
+				i.signer.Sign(attributes, entry.body, time.Now())
+			}
+			if len(attributes) > 0 {
+				request.MessageAttributes = messageAttributes(attributes)
+			}
+			entries = append(entries, request)
+		}
+
+		var out *sqs.SendMessageBatchOutput
+		err := loggedRetries(i.retry, logging.Default()).Do(ctx, func(ctx context.Context) error {
+			var err error
+			out, err = i.sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+				QueueUrl: aws.String(i.queueUrl),
+				Entries:  entries,
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range out.Successful {
+			id := aws.ToString(entry.Id)
+			logging.Default().Debug(
+				"message sent",
+				"operation", message.AddOp,
+				"key", pending[id].add.Key,
+				"correlationId", pending[id].add.CorrelationId,
+				"messageId", aws.ToString(entry.MessageId),
+			)
+			delete(pending, id)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		reason := "unknown reason"
+		if len(out.Failed) > 0 {
+			reason = aws.ToString(out.Failed[0].Message)
+		}
+		if attempt >= i.retry.MaxAttempts {
+			return fmt.Errorf("can't send %d of %d messages: %s", len(pending), len(batch), reason)
+		}
+		delay := i.retry.Delay(attempt, retry.Transient)
+		logging.Default().Debug("retrying failed entries", "attempt", attempt, "failed", len(pending), "delay", delay, "reason", reason)
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
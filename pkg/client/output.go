@@ -0,0 +1,168 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// Output formats of command results
+const (
+	TextOutput  = "text"
+	JSONOutput  = "json"
+	CSVOutput   = "csv"
+	TableOutput = "table"
+)
+
+// ResultRecord is a structured representation of command result
+type ResultRecord struct {
+	// Line is a number of line in batch input, 0 in interactive mode
+	Line    int    `json:"line,omitempty"`
+	Command string `json:"command"`
+	Status  Status `json:"status"`
+	Error   string `json:"error,omitempty"`
+	// Code identifies kind of invalid message, see message.ErrorCode
+	Code message.ErrorCode `json:"code,omitempty"`
+	// Data is a value returned by Get, items returned by GetAll or namespaces returned by ListNamespaces
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Record returns structured representation of result
+func (r Result) Record() ResultRecord {
+	record := ResultRecord{
+		Line:    r.Line,
+		Command: r.Command,
+		Status:  r.Status,
+	}
+	if r.Err != nil {
+		record.Error = r.Err.Error()
+		record.Code = errorCode(r.Err)
+	}
+	if reply := r.Reply; reply != nil {
+		switch {
+		case reply.Value != nil:
+			record.Data = *reply.Value
+		case reply.Items != nil:
+			record.Data = reply.Items
+		case reply.Namespaces != nil:
+			record.Data = reply.Namespaces
+		}
+	}
+	return record
+}
+
+// errorCode returns code of validation error reported by client or server, or empty code for other errors
+func errorCode(err error) message.ErrorCode {
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.Code
+	}
+	var validationErr *message.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return ""
+}
+
+// NewOutputResponder returns responder writing results to w in given machine-readable format: json, csv or table;
+// text format is served by interactive and batch responders
+func NewOutputResponder(format string, w io.Writer) (Responder, error) {
+	switch format {
+	case JSONOutput:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return &jsonResponder{encoder: encoder}, nil
+	case CSVOutput:
+		return &csvResponder{writer: csv.NewWriter(w)}, nil
+	case TableOutput:
+		return &tableResponder{writer: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// jsonResponder writes every result as JSON object on a separate line
+type jsonResponder struct {
+	encoder *json.Encoder
+}
+
+func (r *jsonResponder) Respond(result Result) {
+	_ = r.encoder.Encode(result.Record())
+}
+
+func (r *jsonResponder) Bye() {
+}
+
+func (r *jsonResponder) Help() {
+}
+
+// csvResponder writes every result as CSV row, data other than item value is encoded as JSON;
+// code column is the last one to keep positions of other columns
+type csvResponder struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+var resultCSVHeader = []string{"line", "command", "status", "error", "data", "code"}
+
+func (r *csvResponder) Respond(result Result) {
+	if !r.headerWritten {
+		_ = r.writer.Write(resultCSVHeader)
+		r.headerWritten = true
+	}
+
+	record := result.Record()
+	var data string
+	switch value := record.Data.(type) {
+	case nil:
+	case string:
+		data = value
+	default:
+		encoded, _ := json.Marshal(value)
+		data = string(encoded)
+	}
+	_ = r.writer.Write([]string{strconv.Itoa(record.Line), record.Command, string(record.Status), record.Error, data, string(record.Code)})
+	r.writer.Flush()
+}
+
+func (r *csvResponder) Bye() {
+}
+
+func (r *csvResponder) Help() {
+}
+
+// tableResponder writes results as a table with aligned columns, table is written once all results are known
+type tableResponder struct {
+	writer        *tabwriter.Writer
+	headerWritten bool
+}
+
+func (r *tableResponder) Respond(result Result) {
+	if !r.headerWritten {
+		fmt.Fprintln(r.writer, "LINE\tCOMMAND\tSTATUS\tERROR\tDATA")
+		r.headerWritten = true
+	}
+
+	record := result.Record()
+	fmt.Fprintf(
+		r.writer,
+		"%d\t%s\t%s\t%s\t%s\n",
+		record.Line,
+		reportEscaper.Replace(record.Command),
+		record.Status,
+		reportEscaper.Replace(record.Error),
+		reportEscaper.Replace(replyData(result.Reply)),
+	)
+}
+
+func (r *tableResponder) Bye() {
+	_ = r.writer.Flush()
+}
+
+func (r *tableResponder) Help() {
+}
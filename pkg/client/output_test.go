@@ -0,0 +1,67 @@
+package client_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/client"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+func TestOutputResponder(t *testing.T) {
+	value := "A"
+	results := []client.Result{
+		{Line: 1, Command: "<1", Status: client.StatusOk, Reply: &message.Reply{Status: message.StatusOk, Value: &value}},
+		{Line: 2, Command: "*", Status: client.StatusOk, Reply: &message.Reply{Status: message.StatusOk, Items: []message.Item{{Key: "1", Value: "A"}}}},
+		{Line: 3, Command: "+1", Status: client.StatusParseError, Err: errors.New("column 3: key/value expected")},
+		{Line: 4, Command: "-1", Status: client.StatusOk},
+		{Line: 5, Command: "+ns/:A", Status: client.StatusServerError, Err: &client.ServerError{Message: "key is required", Code: message.CodeRequired}},
+	}
+
+	cases := map[string][]string{
+		client.JSONOutput: {
+			`{"line":1,"command":"<1","status":"ok","data":"A"}`,
+			`{"line":2,"command":"*","status":"ok","data":[{"key":"1","value":"A"}]}`,
+			`{"line":3,"command":"+1","status":"parse_error","error":"column 3: key/value expected"}`,
+			`{"line":4,"command":"-1","status":"ok"}`,
+			`{"line":5,"command":"+ns/:A","status":"server_error","error":"server error: key is required","code":"required"}`,
+		},
+		client.CSVOutput: {
+			"line,command,status,error,data,code",
+			"1,<1,ok,,A,",
+			`2,*,ok,,"[{""key"":""1"",""value"":""A""}]",`,
+			"3,+1,parse_error,column 3: key/value expected,,",
+			"4,-1,ok,,,",
+			"5,+ns/:A,server_error,server error: key is required,,required",
+		},
+		client.TableOutput: {
+			"LINE  COMMAND  STATUS        ERROR                          DATA",
+			"1     <1       ok                                           A",
+			"2     *        ok                                           1=A",
+			"3     +1       parse_error   column 3: key/value expected   ",
+			"4     -1       ok                                           ",
+			"5     +ns/:A   server_error  server error: key is required  ",
+		},
+	}
+
+	for format, expected := range cases {
+		t.Run(format, func(t *testing.T) {
+			var out strings.Builder
+			responder, err := client.NewOutputResponder(format, &out)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, result := range results {
+				responder.Respond(result)
+			}
+			responder.Bye()
+
+			assert.Equal(t, strings.Join(expected, "\n")+"\n", out.String())
+		})
+	}
+
+	_, err := client.NewOutputResponder("xml", &strings.Builder{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+var (
+	EmptyCommand       = errors.New("empty command")
+	KeyExpected        = errors.New("key expected")
+	UnexpectedArgument = errors.New("unexpected argument")
+	UnterminatedQuote  = errors.New("unterminated quoted string")
+	InvalidEscape      = errors.New("invalid escape sequence")
+)
+
+// ParseError is an error of parsing command at given position, line and column are counted from 1
+type ParseError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 1 {
+		return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("column %d: %v", e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Parse parses command into message, namespace is used for keys which are not prefixed with namespace.
+//
+// Command is either a sigil followed by arguments, e.g. +KEY:VALUE, or a verb followed by arguments
+// separated by spaces, e.g. add KEY VALUE. Arguments can be quoted: double quoted strings support
+// Go escape sequences like \n or \", single quoted strings are taken as is. Text starting with # at the
+// beginning of the line or after a space is a comment, # elsewhere, e.g. in <#tag, is a part of an argument.
+// Unquoted value of +KEY:VALUE is the rest of the line without comment and surrounding spaces.
+func Parse(line, namespace string) (message.Message, error) {
+	p := &parser{src: []rune(line), namespace: namespace}
+	if p.done() {
+		return nil, EmptyCommand
+	}
+
+	start := p.pos
+	switch sigil := p.src[p.pos]; sigil {
+	case '+', '-', '<', '*', '~', '!':
+		p.pos++
+		return p.sigilCommand(sigil)
+	}
+
+	verb, err := p.word("")
+	if err != nil {
+		return nil, err
+	}
+	switch verb.text {
+	case "add":
+		return p.addCommand()
+	case "get":
+		return p.keyCommand(message.GetItemOp)
+	case "del":
+		return p.keyCommand(message.RemoveOp)
+	case "list":
+		return p.listCommand()
+	case "namespaces":
+		return message.NewListNamespaces(), p.end()
+	case "drop":
+		return p.dropCommand()
+	}
+	return nil, p.fail(start, UnknownCommand)
+}
+
+// parser is a state of command parsing, positions are indexes in src
+type parser struct {
+	src       []rune
+	pos       int
+	namespace string
+}
+
+// word is an argument of command, slash is a byte index of the first unquoted / in text or -1
+type word struct {
+	text  string
+	pos   int
+	slash int
+}
+
+func (p *parser) sigilCommand(sigil rune) (message.Message, error) {
+	switch sigil {
+	case '+':
+		key, err := p.word(":")
+		if err != nil {
+			return nil, err
+		}
+		if p.pos == len(p.src) || p.src[p.pos] != ':' {
+			return nil, p.fail(p.pos, KeyValueExpected)
+		}
+		namespace, k, err := p.splitKey(key)
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return message.NewAdd(namespace, k, value), nil
+	case '-':
+		return p.keyCommand(message.RemoveOp)
+	case '<':
+		return p.keyCommand(message.GetItemOp)
+	case '*':
+		return p.listCommand()
+	case '~':
+		return message.NewListNamespaces(), p.end()
+	default:
+		return p.dropCommand()
+	}
+}
+
+// addCommand parses arguments of add KEY VALUE
+func (p *parser) addCommand() (message.Message, error) {
+	namespace, key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if p.done() {
+		return nil, p.fail(p.pos, KeyValueExpected)
+	}
+	value, err := p.word("")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return message.NewAdd(namespace, key, value.text), nil
+}
+
+// keyCommand parses key argument of get or remove command
+func (p *parser) keyCommand(operation message.Operation) (message.Message, error) {
+	namespace, key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	if operation == message.RemoveOp {
+		return message.NewRemove(namespace, key), nil
+	}
+	return message.NewGet(namespace, key), nil
+}
+
+// listCommand parses optional namespace argument of list command
+func (p *parser) listCommand() (message.Message, error) {
+	if p.done() {
+		return message.NewGetAll(p.namespace), nil
+	}
+	namespace, err := p.word("")
+	if err != nil {
+		return nil, err
+	}
+	return message.NewGetAll(namespace.text), p.end()
+}
+
+// dropCommand parses namespace argument of drop command
+func (p *parser) dropCommand() (message.Message, error) {
+	if p.done() {
+		return nil, p.fail(p.pos, NamespaceExpected)
+	}
+	namespace, err := p.word("")
+	if err != nil {
+		return nil, err
+	}
+	if namespace.text == "" {
+		return nil, p.fail(namespace.pos, NamespaceExpected)
+	}
+	return message.NewDropNamespace(namespace.text), p.end()
+}
+
+// key parses key argument in form [NAMESPACE/]KEY
+func (p *parser) key() (string, string, error) {
+	if p.done() {
+		return "", "", p.fail(p.pos, KeyExpected)
+	}
+	w, err := p.word("")
+	if err != nil {
+		return "", "", err
+	}
+	return p.splitKey(w)
+}
+
+// splitKey splits key at the first unquoted /, parser's namespace is used if there is no /
+func (p *parser) splitKey(w word) (string, string, error) {
+	namespace, key := p.namespace, w.text
+	if w.slash >= 0 {
+		namespace, key = w.text[:w.slash], w.text[w.slash+1:]
+	}
+	if key == "" {
+		return "", "", p.fail(w.pos, KeyExpected)
+	}
+	return namespace, key, nil
+}
+
+// value parses value of +KEY:VALUE, which is either a quoted word or the rest of the line
+func (p *parser) value() (string, error) {
+	p.skipSpaces()
+	if p.pos < len(p.src) && (p.src[p.pos] == '"' || p.src[p.pos] == '\'') {
+		w, err := p.word("")
+		if err != nil {
+			return "", err
+		}
+		return w.text, p.end()
+	}
+
+	end := p.pos
+	for end < len(p.src) && !(p.src[end] == '#' && unicode.IsSpace(p.src[end-1])) {
+		end++
+	}
+	value := strings.TrimRightFunc(string(p.src[p.pos:end]), unicode.IsSpace)
+	p.pos = len(p.src)
+	return value, nil
+}
+
+// word parses word made of unquoted characters and quoted strings, it ends with space or one of stop characters
+func (p *parser) word(stop string) (word, error) {
+	p.skipSpaces()
+	w := word{pos: p.pos, slash: -1}
+
+	var text strings.Builder
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		switch {
+		case unicode.IsSpace(r) || strings.ContainsRune(stop, r):
+			w.text = text.String()
+			return w, nil
+		case r == '"':
+			if err := p.doubleQuoted(&text); err != nil {
+				return w, err
+			}
+		case r == '\'':
+			if err := p.singleQuoted(&text); err != nil {
+				return w, err
+			}
+		default:
+			if r == '/' && w.slash < 0 {
+				w.slash = text.Len()
+			}
+			text.WriteRune(r)
+			p.pos++
+		}
+	}
+	w.text = text.String()
+	return w, nil
+}
+
+func (p *parser) doubleQuoted(text *strings.Builder) error {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		switch r := p.src[p.pos]; r {
+		case '"':
+			p.pos++
+			return nil
+		case '\\':
+			tail := string(p.src[p.pos:])
+			value, _, rest, err := strconv.UnquoteChar(tail, '"')
+			if err != nil {
+				return p.fail(p.pos, InvalidEscape)
+			}
+			text.WriteRune(value)
+			p.pos += len([]rune(tail)) - len([]rune(rest))
+		default:
+			text.WriteRune(r)
+			p.pos++
+		}
+	}
+	return p.fail(start, UnterminatedQuote)
+}
+
+func (p *parser) singleQuoted(text *strings.Builder) error {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.src) {
+		r := p.src[p.pos]
+		p.pos++
+		if r == '\'' {
+			return nil
+		}
+		text.WriteRune(r)
+	}
+	return p.fail(start, UnterminatedQuote)
+}
+
+// end checks that there are no arguments left
+func (p *parser) end() error {
+	if !p.done() {
+		return p.fail(p.pos, UnexpectedArgument)
+	}
+	return nil
+}
+
+// done skips spaces and reports whether only comment, if any, is left
+func (p *parser) done() bool {
+	p.skipSpaces()
+	return p.pos == len(p.src) || p.src[p.pos] == '#' && (p.pos == 0 || unicode.IsSpace(p.src[p.pos-1]))
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// fail returns error at position pos
+func (p *parser) fail(pos int, err error) error {
+	line, column := 1, 1
+	for _, r := range p.src[:pos] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return &ParseError{Line: line, Column: column, Err: err}
+}
@@ -0,0 +1,91 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/client"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]struct {
+		line     string
+		expected message.Message
+		err      error
+	}{
+		"Empty line":                {line: "", err: client.EmptyCommand},
+		"Comment":                   {line: "  # nothing to do", err: client.EmptyCommand},
+		"Add":                       {line: "+1:A", expected: message.NewAdd("ns", "1", "A")},
+		"Add with spaces in value":  {line: "+1: hello  world  # greeting", expected: message.NewAdd("ns", "1", "hello  world")},
+		"Add with hash in value":    {line: "+1:a#b", expected: message.NewAdd("ns", "1", "a#b")},
+		"Add with quoted value":     {line: `+1:" two\nlines "`, expected: message.NewAdd("ns", "1", " two\nlines ")},
+		"Add with quoted key":       {line: `+"k:1":v:2`, expected: message.NewAdd("ns", "k:1", "v:2")},
+		"Add with namespace":        {line: "+teamA/1:A", expected: message.NewAdd("teamA", "1", "A")},
+		"Add with quoted slash":     {line: `+"a/b":A`, expected: message.NewAdd("ns", "a/b", "A")},
+		"Add with empty value":      {line: "+1:", expected: message.NewAdd("ns", "1", "")},
+		"Remove":                    {line: "-1", expected: message.NewRemove("ns", "1")},
+		"Get":                       {line: "<teamA/1 # comment", expected: message.NewGet("teamA", "1")},
+		"Get with hash key":         {line: "<#tag #comment", expected: message.NewGet("ns", "#tag")},
+		"Get all":                   {line: "*", expected: message.NewGetAll("ns")},
+		"Get all in namespace":      {line: "*teamA", expected: message.NewGetAll("teamA")},
+		"List namespaces":           {line: "~", expected: message.NewListNamespaces()},
+		"Drop namespace":            {line: "!teamA", expected: message.NewDropNamespace("teamA")},
+		"Verb add":                  {line: `add "k:1" "v"`, expected: message.NewAdd("ns", "k:1", "v")},
+		"Verb add single quoted":    {line: `add k 'a "b" \n'`, expected: message.NewAdd("ns", "k", `a "b" \n`)},
+		"Verb add concatenated":     {line: `add k a"  "b`, expected: message.NewAdd("ns", "k", "a  b")},
+		"Verb get":                  {line: "get teamA/1", expected: message.NewGet("teamA", "1")},
+		"Verb get with hash in key": {line: "get a#b # comment", expected: message.NewGet("ns", "a#b")},
+		"Verb get quoted hash key":  {line: "get '#tag'", expected: message.NewGet("ns", "#tag")},
+		"Verb del":                  {line: "del 1", expected: message.NewRemove("ns", "1")},
+		"Verb list":                 {line: "list", expected: message.NewGetAll("ns")},
+		"Verb list namespace":       {line: "list teamA", expected: message.NewGetAll("teamA")},
+		"Verb namespaces":           {line: "namespaces", expected: message.NewListNamespaces()},
+		"Verb drop":                 {line: "drop teamA", expected: message.NewDropNamespace("teamA")},
+		"Multi-line value":          {line: "+1:line 1\nline 2", expected: message.NewAdd("ns", "1", "line 1\nline 2")},
+		"Unknown command":           {line: "  put 1 A", err: &client.ParseError{Line: 1, Column: 3, Err: client.UnknownCommand}},
+		"Missing value":             {line: "+1", err: &client.ParseError{Line: 1, Column: 3, Err: client.KeyValueExpected}},
+		"Missing verb value":        {line: "add 1", err: &client.ParseError{Line: 1, Column: 6, Err: client.KeyValueExpected}},
+		"Missing key":               {line: "-", err: &client.ParseError{Line: 1, Column: 2, Err: client.KeyExpected}},
+		"Empty key":                 {line: "+teamA/:A", err: &client.ParseError{Line: 1, Column: 2, Err: client.KeyExpected}},
+		"Comment instead of key":    {line: "get #tag", err: &client.ParseError{Line: 1, Column: 5, Err: client.KeyExpected}},
+		"Missing namespace":         {line: "drop", err: &client.ParseError{Line: 1, Column: 5, Err: client.NamespaceExpected}},
+		"Unexpected argument":       {line: "get 1 2", err: &client.ParseError{Line: 1, Column: 7, Err: client.UnexpectedArgument}},
+		"Unexpected after quote":    {line: `+1:"A" B`, err: &client.ParseError{Line: 1, Column: 8, Err: client.UnexpectedArgument}},
+		"Unterminated quote":        {line: `add 1 "A`, err: &client.ParseError{Line: 1, Column: 7, Err: client.UnterminatedQuote}},
+		"Invalid escape":            {line: `add 1 "\q"`, err: &client.ParseError{Line: 1, Column: 8, Err: client.InvalidEscape}},
+		"Error in second line":      {line: "add 1\n  \"A", err: &client.ParseError{Line: 2, Column: 3, Err: client.UnterminatedQuote}},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			msg, err := client.Parse(tc.line, "ns")
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, withoutCorrelationId(tc.expected), withoutCorrelationId(msg))
+		})
+	}
+}
+
+func withoutCorrelationId(msg message.Message) message.Message {
+	switch m := msg.(type) {
+	case message.Add:
+		m.CorrelationId = ""
+		return m
+	case message.Remove:
+		m.CorrelationId = ""
+		return m
+	case message.Get:
+		m.CorrelationId = ""
+		return m
+	case message.GetAll:
+		m.CorrelationId = ""
+		return m
+	case message.ListNamespaces:
+		m.CorrelationId = ""
+		return m
+	case message.DropNamespace:
+		m.CorrelationId = ""
+		return m
+	}
+	return msg
+}
@@ -1,49 +1,79 @@
 package client
 
-import "context"
+import (
+	"bufio"
+	"context"
+	"io"
+)
 
-// Processor processes stream of incoming commands
+// ReadLines sends lines read from r to lines, it returns error if r can't be read or line is longer than
+// maxLineLength; lines isn't closed, so reading error can be reported before input ends
+func ReadLines(r io.Reader, maxLineLength int, lines chan<- string) error {
+	initial := 64 * 1024
+	if initial > maxLineLength {
+		initial = maxLineLength
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, initial), maxLineLength)
+	for s.Scan() {
+		lines <- s.Text()
+	}
+	return s.Err()
+}
+
+// Processor processes stream of incoming commands until lines channel is closed
 type Processor struct {
-	lines     chan string
+	lines     <-chan string
 	executor  *Executor
 	responder Responder
+	maxErrors int
 }
 
-// NewProcessor creates new Processor
-func NewProcessor(lines chan string, executor *Executor, responder Responder) *Processor {
+// NewProcessor creates new Processor, processing stops after maxErrors failed commands, 0 means no limit
+func NewProcessor(lines <-chan string, executor *Executor, responder Responder, maxErrors int) *Processor {
 	return &Processor{
 		lines:     lines,
 		executor:  executor,
 		responder: responder,
+		maxErrors: maxErrors,
 	}
 }
 
-// Run starts processing loop
-func (p *Processor) Run(ctx context.Context) {
+// Run starts processing loop and returns summary of executed commands
+func (p *Processor) Run(ctx context.Context) Summary {
+	var summary Summary
 	p.responder.Help()
+	defer p.responder.Bye()
 
-	for {
+	for lineNo := 1; ; lineNo++ {
 		select {
 		case <-ctx.Done():
-			p.responder.Bye()
-			return
+			return summary
 
-		case line := <-p.lines:
-			if line == "EOF" {
-				return
+		case line, ok := <-p.lines:
+			if !ok {
+				return summary
 			}
-			switch err := p.executor.ExecuteCmd(ctx, line); err {
-			case UnknownCommand:
-				p.responder.Error(err)
-				p.responder.Help()
-			case KeyValueExpected:
-				p.responder.Error(err)
-				p.responder.Help()
-			case nil:
-				p.responder.Ok()
-			default:
-				p.responder.Error(err)
+			result := p.executor.Execute(ctx, line)
+			if result.Empty() {
+				continue
+			}
+			result.Line = lineNo
+			summary.Add(result)
+			respond(p.responder, result)
+
+			if p.maxErrors > 0 && summary.Failed() >= p.maxErrors {
+				summary.Stopped = true
+				return summary
 			}
 		}
 	}
 }
+
+// respond reports result of command execution, help is shown for malformed commands
+func respond(responder Responder, result Result) {
+	responder.Respond(result)
+	if result.Status == StatusParseError {
+		responder.Help()
+	}
+}
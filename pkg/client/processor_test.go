@@ -0,0 +1,114 @@
+package client_test
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/client"
+)
+
+func TestProcessor_Run(t *testing.T) {
+	input := []string{"# parse and validation errors only, so nothing is sent", "", "put 1 A", "+1", "get 1 2", "<'a b'", "EOF"}
+
+	cases := map[string]struct {
+		maxErrors int
+		expected  client.Summary
+		report    []string
+	}{
+		"Processing all lines": {
+			expected: client.Summary{Total: 5, ParseErrors: 5, ExitCode: client.ExitParseError},
+			report: []string{
+				"3\tput 1 A\tparse_error\tcolumn 1: unknown command",
+				"4\t+1\tparse_error\tcolumn 3: key/value expected",
+				"5\tget 1 2\tparse_error\tcolumn 7: unexpected argument",
+				"6\t<'a b'\tparse_error\tkey: key contains ' ', only printable characters other than spaces are allowed [invalid_characters]",
+				"7\tEOF\tparse_error\tcolumn 1: unknown command",
+			},
+		},
+		"Stopping after max errors": {
+			maxErrors: 2,
+			expected:  client.Summary{Total: 2, ParseErrors: 2, Stopped: true, ExitCode: client.ExitParseError},
+			report: []string{
+				"3\tput 1 A\tparse_error\tcolumn 1: unknown command",
+				"4\t+1\tparse_error\tcolumn 3: key/value expected",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			lines := make(chan string, len(input))
+			for _, line := range input {
+				lines <- line
+			}
+			close(lines)
+			var report strings.Builder
+			executor := client.NewExecutor(nil, nil, "", "")
+			processor := client.NewProcessor(lines, executor, client.NewBatchResponder(&report), tc.maxErrors)
+
+			summary := processor.Run(context.Background())
+
+			assert.Equal(t, tc.expected, summary)
+			assert.Equal(t, strings.Join(tc.report, "\n")+"\n", report.String())
+		})
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	cases := map[string]struct {
+		input         string
+		expectedLines []string
+		expectedErr   error
+	}{
+		"Reading all lines": {
+			input:         "+1 A\nEOF\n<1",
+			expectedLines: []string{"+1 A", "EOF", "<1"},
+		},
+		"Failing on too long line": {
+			input:         "+1 A\n+2 " + strings.Repeat("B", 16) + "\n<1\n",
+			expectedLines: []string{"+1 A"},
+			expectedErr:   bufio.ErrTooLong,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			lines := make(chan string, 8)
+			err := client.ReadLines(strings.NewReader(tc.input), 16, lines)
+			close(lines)
+
+			var actual []string
+			for line := range lines {
+				actual = append(actual, line)
+			}
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedLines, actual)
+		})
+	}
+}
+
+func TestSummary_FailInput(t *testing.T) {
+	var summary client.Summary
+	summary.Add(client.Result{Status: client.StatusOk})
+	summary.FailInput()
+	assert.Equal(t, client.Summary{Total: 1, Succeeded: 1, InputFailed: true, ExitCode: client.ExitInputError}, summary)
+
+	// exit code of the first failed command is kept
+	summary = client.Summary{}
+	summary.Add(client.Result{Status: client.StatusServerError})
+	summary.FailInput()
+	assert.Equal(t, client.ExitServerError, summary.ExitCode)
+}
+
+func TestSummary_Add(t *testing.T) {
+	var summary client.Summary
+	for _, status := range []client.Status{client.StatusOk, client.StatusServerError, client.StatusParseError, client.StatusOk} {
+		summary.Add(client.Result{Status: status})
+	}
+
+	assert.Equal(t, client.Summary{Total: 4, Succeeded: 2, ParseErrors: 1, ServerErrors: 1, ExitCode: client.ExitServerError}, summary)
+	assert.Equal(t, 2, summary.Failed())
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Record is an exported item with its namespace
+type Record struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+}
+
+const (
+	JSONLinesFormat = "jsonl"
+	CSVFormat       = "csv"
+)
+
+var csvHeader = []string{"namespace", "key", "value"}
+
+// RecordWriter writes records in one of supported formats
+type RecordWriter interface {
+	Write(record Record) error
+	// Flush writes buffered records
+	Flush() error
+}
+
+// RecordReader reads records in one of supported formats
+type RecordReader interface {
+	// Read returns next record or io.EOF
+	Read() (Record, error)
+}
+
+// NewRecordWriter creates new writer for given format, jsonl or csv
+func NewRecordWriter(w io.Writer, format string) (RecordWriter, error) {
+	switch format {
+	case JSONLinesFormat:
+		return &jsonLinesWriter{encoder: json.NewEncoder(w)}, nil
+	case CSVFormat:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// NewRecordReader creates new reader for given format, jsonl or csv
+func NewRecordReader(r io.Reader, format string) (RecordReader, error) {
+	switch format {
+	case JSONLinesFormat:
+		return &jsonLinesReader{decoder: json.NewDecoder(r)}, nil
+	case CSVFormat:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(csvHeader)
+		return &csvReader{reader: reader}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type jsonLinesWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonLinesWriter) Write(record Record) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *jsonLinesWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvWriter) Write(record Record) error {
+	if !w.headerWritten {
+		if err := w.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	return w.writer.Write([]string{record.Namespace, record.Key, record.Value})
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type jsonLinesReader struct {
+	decoder *json.Decoder
+}
+
+func (r *jsonLinesReader) Read() (Record, error) {
+	var record Record
+	err := r.decoder.Decode(&record)
+	return record, err
+}
+
+type csvReader struct {
+	reader     *csv.Reader
+	headerRead bool
+}
+
+func (r *csvReader) Read() (Record, error) {
+	if !r.headerRead {
+		header, err := r.reader.Read()
+		if err != nil {
+			return Record{}, err
+		}
+		for i, name := range csvHeader {
+			if header[i] != name {
+				return Record{}, fmt.Errorf("csv header %v expected, got %v", csvHeader, header)
+			}
+		}
+		r.headerRead = true
+	}
+
+	fields, err := r.reader.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Namespace: fields[0], Key: fields[1], Value: fields[2]}, nil
+}
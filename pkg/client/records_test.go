@@ -0,0 +1,52 @@
+package client_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/client"
+)
+
+func TestRecords(t *testing.T) {
+	records := []client.Record{
+		{Namespace: "default", Key: "1", Value: "A"},
+		{Namespace: "teamA", Key: "a,b", Value: "line 1\nline \"2\""},
+		{Namespace: "teamA", Key: "2", Value: ""},
+	}
+
+	for _, format := range []string{client.JSONLinesFormat, client.CSVFormat} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := client.NewRecordWriter(&buf, format)
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, record := range records {
+				assert.NoError(t, writer.Write(record))
+			}
+			assert.NoError(t, writer.Flush())
+
+			reader, err := client.NewRecordReader(&buf, format)
+			if !assert.NoError(t, err) {
+				return
+			}
+			var read []client.Record
+			for {
+				record, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				read = append(read, record)
+			}
+			assert.Equal(t, records, read)
+		})
+	}
+
+	_, err := client.NewRecordReader(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/yosadchyi/go-client-server/pkg/lineedit"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+// REPL reads commands from terminal with line editing, history and completion and executes them one by one
+type REPL struct {
+	editor    *lineedit.Editor
+	history   *lineedit.History
+	executor  *Executor
+	responder Responder
+	keys      *KeySet
+	prompt    string
+}
+
+// NewREPL creates new REPL reading from in and echoing to out, history is optional
+func NewREPL(in io.Reader, out io.Writer, history *lineedit.History, executor *Executor, responder Responder, colored bool) *REPL {
+	if history == nil {
+		history = lineedit.NewHistory(0)
+	}
+	keys := NewKeySet(executor.Namespace())
+	return &REPL{
+		editor:    lineedit.NewEditor(in, out, history, keys.Complete),
+		history:   history,
+		executor:  executor,
+		responder: responder,
+		keys:      keys,
+		prompt:    paint(colored, colorCyan, prompt),
+	}
+}
+
+// Run reads and executes commands until EOF, ^C, ^D or context cancellation
+func (r *REPL) Run(ctx context.Context) {
+	r.responder.Help()
+	defer r.responder.Bye()
+
+	for ctx.Err() == nil {
+		line, err := r.readCommand()
+		if err != nil {
+			if err != io.EOF && err != lineedit.ErrInterrupted {
+				logging.Default().Error("can't read command", "error", err)
+			}
+			return
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := r.history.Add(line); err != nil {
+			logging.Default().Warn("can't save history", "error", err)
+		}
+
+		result := r.executor.Execute(ctx, line)
+		if result.Empty() {
+			continue
+		}
+		if result.Status == StatusOk {
+			r.keys.Learn(result.Message)
+			r.keys.LearnReply(result.Reply)
+		}
+		respond(r.responder, result)
+	}
+}
+
+// readCommand reads command, lines ending with \ are joined with the following ones by newline
+func (r *REPL) readCommand() (string, error) {
+	var lines []string
+	linePrompt := r.prompt
+	for {
+		line, err := r.editor.ReadLine(linePrompt)
+		if err != nil {
+			return "", err
+		}
+		if !strings.HasSuffix(line, `\`) {
+			return strings.Join(append(lines, line), "\n"), nil
+		}
+		lines = append(lines, strings.TrimSuffix(line, `\`))
+		linePrompt = continuationPrompt
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+)
+
+// repliesWaitTimeSeconds is a number of seconds to wait for replies in one receive call
+const repliesWaitTimeSeconds = 5
+
+// Replies receives server's replies from client's reply queue and passes them to commands waiting for them;
+// every reply is deleted from the queue once received, so the queue must not be shared with other clients
+type Replies struct {
+	sqsClient *sqs.Client
+	queueUrl  string
+	retry     retry.Policy
+	mu        sync.Mutex
+	waiting   map[string]chan *message.Reply
+}
+
+// NewReplies creates new receiver of replies sent to queue at queueUrl
+func NewReplies(sqsClient *sqs.Client, queueUrl string) *Replies {
+	return &Replies{
+		sqsClient: sqsClient,
+		queueUrl:  queueUrl,
+		retry:     retry.DefaultPolicy,
+		waiting:   make(map[string]chan *message.Reply),
+	}
+}
+
+// UseRetry makes failed receives followed by policy's growing delays; retry.DefaultPolicy is used by default
+func (r *Replies) UseRetry(policy retry.Policy) {
+	r.retry = policy
+}
+
+// QueueUrl returns URL of reply queue
+func (r *Replies) QueueUrl() string {
+	return r.queueUrl
+}
+
+// Expect registers command waiting for reply with given correlation id, it must be called before message is sent
+func (r *Replies) Expect(correlationId string) <-chan *message.Reply {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan *message.Reply, 1)
+	r.waiting[correlationId] = ch
+	return ch
+}
+
+// Forget unregisters command waiting for reply, replies received later are dropped
+func (r *Replies) Forget(correlationId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.waiting, correlationId)
+}
+
+// Run receives replies until context is cancelled, failed receives are followed by growing delays
+func (r *Replies) Run(ctx context.Context) {
+	logger := logging.Default().With("replyQueueUrl", r.queueUrl)
+
+	failures := 0
+	for ctx.Err() == nil {
+		out, err := r.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(r.queueUrl),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     repliesWaitTimeSeconds,
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				failures++
+				class := retry.Classify(err)
+				delay := r.retry.Delay(failures, class)
+				logger.Warn("error receiving replies", "class", class, "failures", failures, "delay", delay, "error", err)
+				_ = retry.Sleep(ctx, delay)
+			}
+			continue
+		}
+		failures = 0
+
+		for _, m := range out.Messages {
+			r.deliver(aws.ToString(m.Body), logger)
+			_, err := r.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(r.queueUrl),
+				ReceiptHandle: m.ReceiptHandle,
+			})
+			if err != nil {
+				logger.Warn("error deleting reply", "messageId", aws.ToString(m.MessageId), "error", err)
+			}
+		}
+	}
+}
+
+func (r *Replies) deliver(body string, logger *logging.Logger) {
+	reply, err := message.ReplyFromJSON(body)
+	if err != nil {
+		logger.Warn("error parsing reply", "error", err)
+		return
+	}
+
+	r.mu.Lock()
+	ch, ok := r.waiting[reply.CorrelationId]
+	delete(r.waiting, reply.CorrelationId)
+	r.mu.Unlock()
+
+	if !ok {
+		logger.Debug("dropping unexpected reply", "correlationId", reply.CorrelationId)
+		return
+	}
+	ch <- reply
+}
@@ -1,70 +1,148 @@
 package client
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
 
 // Responder is responsible for providing feedback on command execution
 type Responder interface {
-	// Error reports an error
-	Error(err error)
-	// Ok reports success
-	Ok()
+	// Respond reports result of command
+	Respond(result Result)
 	// Bye reports shutdown
 	Bye()
 	// Help shows help
 	Help()
 }
 
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+	colorDim   = "\x1b[2m"
+)
+
 type interactiveResponder struct {
+	colored bool
 }
 
-// NewInteractiveResponder returns new interactive responder, used when input taken from stdin
-func NewInteractiveResponder() Responder {
-	return &interactiveResponder{}
+// NewInteractiveResponder returns new interactive responder, used when input taken from stdin;
+// colored responder highlights results with ANSI escape sequences
+func NewInteractiveResponder(colored bool) Responder {
+	return &interactiveResponder{colored: colored}
 }
 
-func (r *interactiveResponder) Error(err error) {
-	println(err.Error())
-}
+func (r *interactiveResponder) Respond(result Result) {
+	if result.Err != nil {
+		fmt.Fprintln(os.Stderr, paint(r.colored, colorRed, result.Err.Error()))
+		return
+	}
 
-func (r *interactiveResponder) Ok() {
-	println("OK")
+	if result.Reply != nil && result.Reply.Status == message.StatusSkipped {
+		fmt.Println(paint(r.colored, colorGreen, "OK (skipped)"))
+	} else {
+		fmt.Println(paint(r.colored, colorGreen, "OK"))
+	}
+	if result.Reply == nil {
+		return
+	}
+	if result.Reply.Value != nil {
+		fmt.Println(*result.Reply.Value)
+	}
+	for _, item := range result.Reply.Items {
+		fmt.Printf("%s: %s\n", paint(r.colored, colorCyan, item.Key), item.Value)
+	}
+	for _, namespace := range result.Reply.Namespaces {
+		fmt.Println(namespace)
+	}
 }
 
 func (r *interactiveResponder) Bye() {
-	println("Bye")
+	fmt.Println("Bye")
 }
 
 func (r *interactiveResponder) Help() {
-	fmt.Println(`Commands:
-	+KEY:VALUE
-		add item with key KEY and data DATA
-	-KEY
-		remove item with index KEY, where index is an integer number
-	<KEY
-		get item with index KEY, where index is an integer number
-	*
-		list all items
-	^C
-		quit`)
+	fmt.Println(paint(r.colored, colorDim, `Commands (KEY can be prefixed with namespace as NAMESPACE/KEY):
+	+KEY:VALUE or add KEY VALUE
+		add item with key KEY and data VALUE
+	-KEY or del KEY
+		remove item with key KEY
+	<KEY or get KEY
+		get item with key KEY
+	*[NAMESPACE] or list [NAMESPACE]
+		list all items, in current namespace if NAMESPACE is omitted
+	~ or namespaces
+		list namespaces
+	!NAMESPACE or drop NAMESPACE
+		drop namespace NAMESPACE with all its items
+	^C or ^D
+		quit
+Arguments can be quoted as "a \"b\"\n" with escapes or as 'a "b"' without them, # after a space starts a comment.
+In terminal, Tab completes commands and keys, arrows browse history and line ending with \ continues on the next line`))
 }
 
-type batchResponder struct {
+// paint wraps s with color escape sequences if colored is true
+func paint(colored bool, color, s string) string {
+	if !colored {
+		return s
+	}
+	return color + s + colorReset
 }
 
-// NewBatchResponder returns new batch responder, used when input taken from file
-func NewBatchResponder() Responder {
-	return &batchResponder{}
+type batchResponder struct {
+	w io.Writer
 }
 
-func (r *batchResponder) Error(err error) {
-	println(err.Error())
+// NewBatchResponder returns new batch responder, used when input taken from file;
+// it writes report line with tab separated line number, command, status and error or reply data for every command
+func NewBatchResponder(w io.Writer) Responder {
+	return &batchResponder{w: w}
 }
 
-func (r *batchResponder) Ok() {
+func (r *batchResponder) Respond(result Result) {
+	fields := []string{fmt.Sprint(result.Line), result.Command, string(result.Status)}
+	if result.Err != nil {
+		fields = append(fields, result.Err.Error())
+	} else if data := replyData(result.Reply); data != "" {
+		fields = append(fields, data)
+	}
+	for i := range fields {
+		fields[i] = reportEscaper.Replace(fields[i])
+	}
+	fmt.Fprintln(r.w, strings.Join(fields, "\t"))
 }
 
+// reportEscaper escapes characters which would break report line
+var reportEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
 func (r *batchResponder) Bye() {
 }
 
 func (r *batchResponder) Help() {
 }
+
+// replyData formats data returned in reply as a single line: value, key=value pairs or namespaces
+func replyData(reply *message.Reply) string {
+	switch {
+	case reply == nil:
+		return ""
+	case reply.Value != nil:
+		return *reply.Value
+	case reply.Items != nil:
+		pairs := make([]string, 0, len(reply.Items))
+		for _, item := range reply.Items {
+			pairs = append(pairs, item.Key+"="+item.Value)
+		}
+		return strings.Join(pairs, " ")
+	case reply.Namespaces != nil:
+		return strings.Join(reply.Namespaces, ",")
+	case reply.Status == message.StatusSkipped:
+		return string(reply.Status)
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// Status is an outcome of command execution
+type Status string
+
+const (
+	StatusOk          = Status("ok")
+	StatusParseError  = Status("parse_error")
+	StatusSendError   = Status("send_error")
+	StatusServerError = Status("server_error")
+)
+
+// Exit codes of client in batch mode, the code is chosen by the first failed command or input error
+const (
+	ExitOk          = 0
+	ExitParseError  = 2
+	ExitSendError   = 3
+	ExitServerError = 4
+	ExitInputError  = 5
+)
+
+// ServerError is an error reported by server in reply
+type ServerError struct {
+	Message string
+	// Code is set if server rejected invalid message
+	Code message.ErrorCode
+}
+
+func (e *ServerError) Error() string {
+	return "server error: " + e.Message
+}
+
+// Result is a result of command execution
+type Result struct {
+	// Line is a number of line in batch input, 0 in interactive mode
+	Line    int
+	Command string
+	Status  Status
+	Err     error
+	// Message is a message sent to server, nil if command can't be parsed
+	Message message.Message
+	// Reply is server's reply, nil if replies aren't requested or command failed before reply was received
+	Reply *message.Reply
+}
+
+// Empty reports whether command was empty or contained only comment, such commands aren't reported
+func (r Result) Empty() bool {
+	return r.Err == EmptyCommand
+}
+
+// Summary summarizes results of commands executed in batch mode
+type Summary struct {
+	Total        int `json:"total"`
+	Succeeded    int `json:"succeeded"`
+	ParseErrors  int `json:"parseErrors"`
+	SendErrors   int `json:"sendErrors"`
+	ServerErrors int `json:"serverErrors"`
+	// Stopped is set when processing was stopped because maximal number of errors was reached
+	Stopped bool `json:"stopped"`
+	// InputFailed is set when input couldn't be read to the end, so the rest of commands wasn't executed
+	InputFailed bool `json:"inputFailed"`
+	ExitCode    int  `json:"exitCode"`
+}
+
+// Add accounts result in summary
+func (s *Summary) Add(result Result) {
+	s.Total++
+
+	exitCode := ExitOk
+	switch result.Status {
+	case StatusOk:
+		s.Succeeded++
+	case StatusParseError:
+		s.ParseErrors++
+		exitCode = ExitParseError
+	case StatusSendError:
+		s.SendErrors++
+		exitCode = ExitSendError
+	case StatusServerError:
+		s.ServerErrors++
+		exitCode = ExitServerError
+	}
+	if s.ExitCode == ExitOk {
+		s.ExitCode = exitCode
+	}
+}
+
+// FailInput accounts input which couldn't be read to the end
+func (s *Summary) FailInput() {
+	s.InputFailed = true
+	if s.ExitCode == ExitOk {
+		s.ExitCode = ExitInputError
+	}
+}
+
+// Failed returns number of failed commands
+func (s *Summary) Failed() int {
+	return s.Total - s.Succeeded
+}
@@ -0,0 +1,183 @@
+// Package envelope implements envelope encryption of item values: every value is encrypted with its own random
+// data key using AES-256-GCM, and the data key is encrypted with a key from keyring, so keys in keyring
+// encrypt only small data keys and can be rotated without re-encrypting values.
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Prefix marks encrypted values, which have form enc:v1:KEY_ID:BASE64_DATA_KEY:BASE64_CIPHERTEXT,
+// where data key and ciphertext are prefixed with their GCM nonces
+const Prefix = "enc:v1:"
+
+// KeyLength is a length of keys in bytes, keys are used with AES-256
+const KeyLength = 32
+
+var (
+	ErrUnknownKey   = errors.New("unknown key")
+	ErrInvalidValue = errors.New("invalid encrypted value")
+)
+
+// IsEncrypted reports whether value is encrypted, i.e. has Prefix
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Keyring holds keys encrypting data keys, the last key is used for encryption and all keys for decryption
+type Keyring struct {
+	keys map[string]cipher.AEAD
+	// active is ID of key used for encryption
+	active string
+}
+
+// LoadKeyring reads keyring from file, see ParseKeyring for format
+func LoadKeyring(path string) (*Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseKeyring(f)
+}
+
+// ParseKeyring parses keys, one per line as ID=KEY, where KEY is base64 encoded 32 bytes key; empty lines and lines
+// starting with # are ignored. Keys are rotated by appending new key, old keys are kept to decrypt existing values
+func ParseKeyring(r io.Reader) (*Keyring, error) {
+	keyring := &Keyring{keys: make(map[string]cipher.AEAD)}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, secret, ok := strings.Cut(line, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("line %d: ID=KEY expected, ID can't contain ':'", n)
+		}
+		if _, exists := keyring.keys[id]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key ID %q", n, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secret))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid key %q: %w", n, id, err)
+		}
+		if len(key) != KeyLength {
+			return nil, fmt.Errorf("line %d: key %q is %d bytes long, %d bytes are required", n, id, len(key), KeyLength)
+		}
+		if keyring.keys[id], err = newGCM(key); err != nil {
+			return nil, err
+		}
+		keyring.active = id
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(keyring.keys) == 0 {
+		return nil, fmt.Errorf("no keys found")
+	}
+	return keyring, nil
+}
+
+// ActiveKeyId returns ID of key used for encryption
+func (k *Keyring) ActiveKeyId() string {
+	return k.active
+}
+
+// Encrypt encrypts value of item with given key; the key is authenticated along with value,
+// so encrypted value can't be moved to another item
+func (k *Keyring) Encrypt(value string, itemKey string) (string, error) {
+	dataKey := make([]byte, KeyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(data, []byte(value), []byte(itemKey))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(k.keys[k.active], dataKey, []byte(k.active))
+	if err != nil {
+		return "", err
+	}
+	return Prefix + k.active + ":" + base64.StdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts value of item with given key, it fails with ErrUnknownKey if value is encrypted with key
+// missing in keyring and with ErrInvalidValue if value isn't encrypted or is modified
+func (k *Keyring) Decrypt(value string, itemKey string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", ErrInvalidValue
+	}
+	parts := strings.Split(strings.TrimPrefix(value, Prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrInvalidValue
+	}
+	keyId := parts[0]
+	kek, ok := k.keys[keyId]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, keyId)
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	dataKey, err := open(kek, wrappedKey, []byte(keyId))
+	if err != nil || len(dataKey) != KeyLength {
+		return "", ErrInvalidValue
+	}
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(data, ciphertext, []byte(itemKey))
+	if err != nil {
+		return "", ErrInvalidValue
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with random nonce, which is prepended to ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts ciphertext produced by seal
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrInvalidValue
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
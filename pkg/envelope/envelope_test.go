@@ -0,0 +1,89 @@
+package envelope_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+)
+
+const (
+	oldKey = "old=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	newKey = "new=ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func TestParseKeyring(t *testing.T) {
+	keyring, err := envelope.ParseKeyring(strings.NewReader("# keys\n" + oldKey + "\n\n" + newKey + "\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "new", keyring.ActiveKeyId())
+	}
+
+	cases := map[string]string{
+		"empty":          "# no keys\n",
+		"no separator":   "old\n",
+		"colon in ID":    "a:b=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n",
+		"invalid base64": "old=!\n",
+		"short key":      "old=c2hvcnQ=\n",
+		"duplicate ID":   oldKey + "\n" + oldKey + "\n",
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := envelope.ParseKeyring(strings.NewReader(input))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	old, _ := envelope.ParseKeyring(strings.NewReader(oldKey))
+	rotated, _ := envelope.ParseKeyring(strings.NewReader(oldKey + "\n" + newKey))
+	other, _ := envelope.ParseKeyring(strings.NewReader(strings.Replace(newKey, "Z", "Y", 1)))
+
+	encrypted, err := old.Encrypt(`{"email":"user@example.com"}`, "user-1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, envelope.IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "user@example.com")
+	assert.True(t, strings.HasPrefix(encrypted, envelope.Prefix+"old:"))
+
+	again, _ := old.Encrypt(`{"email":"user@example.com"}`, "user-1")
+	assert.NotEqual(t, encrypted, again, "every value has its own data key and nonce")
+
+	// values encrypted with old key are readable after rotation, new values use new key
+	decrypted, err := rotated.Decrypt(encrypted, "user-1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"email":"user@example.com"}`, decrypted)
+	}
+	rotatedValue, _ := rotated.Encrypt("", "user-2")
+	assert.True(t, strings.HasPrefix(rotatedValue, envelope.Prefix+"new:"))
+	decrypted, err = rotated.Decrypt(rotatedValue, "user-2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", decrypted)
+	}
+
+	_, err = old.Decrypt(rotatedValue, "user-2")
+	assert.ErrorIs(t, err, envelope.ErrUnknownKey)
+
+	parts := strings.Split(encrypted, ":")
+	cases := map[string]struct {
+		keyring *envelope.Keyring
+		value   string
+		key     string
+	}{
+		"another item":     {keyring: old, value: encrypted, key: "user-2"},
+		"not encrypted":    {keyring: old, value: "plain", key: "user-1"},
+		"missing part":     {keyring: old, value: strings.Join(parts[:4], ":"), key: "user-1"},
+		"invalid base64":   {keyring: old, value: strings.Join(parts[:4], ":") + ":!", key: "user-1"},
+		"modified":         {keyring: old, value: encrypted[:len(encrypted)-4] + "AAA=", key: "user-1"},
+		"wrong key of ID":  {keyring: other, value: strings.Replace(encrypted, ":old:", ":new:", 1), key: "user-1"},
+		"swapped data key": {keyring: old, value: strings.Join([]string{parts[0], parts[1], parts[2], strings.Split(again, ":")[3], parts[4]}, ":"), key: "user-1"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := c.keyring.Decrypt(c.value, c.key)
+			assert.ErrorIs(t, err, envelope.ErrInvalidValue)
+		})
+	}
+}
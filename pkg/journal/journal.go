@@ -0,0 +1,259 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+)
+
+// Version is a version of journal record format
+const Version = 1
+
+const (
+	ResultOk    = "ok"
+	ResultError = "error"
+	// ResultSkipped is a result of operation which was accepted but did not modify storage
+	ResultSkipped = "skipped"
+)
+
+// Record is a single journal entry describing processed operation
+type Record struct {
+	Version   int       `json:"v"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Namespace string    `json:"namespace,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	Value     string    `json:"value,omitempty"`
+	// Ref is a key of blob holding value of Add, Value is empty then
+	Ref       string `json:"ref,omitempty"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+	Processor string `json:"processor,omitempty"`
+	// Principal is a sender of message authenticated by server, if authorization is used
+	Principal     string `json:"principal,omitempty"`
+	MessageId     string `json:"messageId,omitempty"`
+	CorrelationId string `json:"correlationId,omitempty"`
+}
+
+// SyncPolicy defines when journal is flushed and synced to disk
+type SyncPolicy string
+
+const (
+	// SyncAlways syncs after every record
+	SyncAlways = SyncPolicy("always")
+	// SyncInterval syncs periodically
+	SyncInterval = SyncPolicy("interval")
+	// SyncNever leaves syncing to operating system, buffer is flushed only when full or on close
+	SyncNever = SyncPolicy("never")
+)
+
+// ParseSyncPolicy parses sync policy name, one of always, interval or never
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(name); policy {
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown sync policy %q", name)
+}
+
+// File is a destination of journal records
+type File interface {
+	io.WriteCloser
+	Sync() error
+}
+
+// Writer writes records to file as JSON lines through a buffer, it's safe for concurrent use
+type Writer struct {
+	lock   sync.Mutex
+	file   File
+	buf    *bufio.Writer
+	policy SyncPolicy
+	done   chan struct{}
+	wg     sync.WaitGroup
+	// keyring encrypts values of records, if set
+	keyring *envelope.Keyring
+}
+
+// NewWriter creates new journal writer, interval is used only with SyncInterval policy
+func NewWriter(file File, policy SyncPolicy, interval time.Duration) *Writer {
+	w := &Writer{
+		file:   file,
+		buf:    bufio.NewWriter(file),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+
+	if policy == SyncInterval {
+		w.wg.Add(1)
+		go w.syncPeriodically(interval)
+	}
+
+	return w
+}
+
+// UseKeyring makes writer encrypt values of records which aren't encrypted yet, so journal never contains plaintext values
+func (w *Writer) UseKeyring(keyring *envelope.Keyring) {
+	w.keyring = keyring
+}
+
+// Write appends record to journal, records without version or time get current ones
+func (w *Writer) Write(record Record) error {
+	if w.keyring != nil && record.Value != "" && !envelope.IsEncrypted(record.Value) {
+		value, err := w.keyring.Encrypt(record.Value, record.Key)
+		if err != nil {
+			return err
+		}
+		record.Value = value
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if record.Version == 0 {
+		record.Version = Version
+	}
+	// time is taken under the lock, so records in journal are ordered by time
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// make sure underlying file always receives whole records, so rotation never splits a record
+	if len(line) > w.buf.Available() && w.buf.Buffered() > 0 {
+		if err := w.buf.Flush(); err != nil {
+			return err
+		}
+	}
+	if _, err := w.buf.Write(line); err != nil {
+		return err
+	}
+
+	if w.policy == SyncAlways {
+		return w.sync()
+	}
+	return nil
+}
+
+// Sync flushes buffered records and syncs file to disk
+func (w *Writer) Sync() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.sync()
+}
+
+// Close syncs buffered records and closes underlying file
+func (w *Writer) Close() error {
+	close(w.done)
+	w.wg.Wait()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.sync(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *Writer) sync() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *Writer) syncPeriodically(interval time.Duration) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			// errors are reported on next Write/Sync/Close as bufio.Writer keeps them
+			_ = w.Sync()
+		}
+	}
+}
+
+// CorruptedRecordError is returned by Reader when record can't be parsed
+type CorruptedRecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *CorruptedRecordError) Error() string {
+	return fmt.Sprintf("corrupted record at line %d: %s", e.Line, e.Err)
+}
+
+func (e *CorruptedRecordError) Unwrap() error {
+	return e.Err
+}
+
+// ErrTruncated is reported for the last record which is not terminated with new line
+var ErrTruncated = errors.New("record is truncated")
+
+// Reader reads records from journal
+type Reader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewReader creates new journal reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns next record, io.EOF when there are no more records or *CorruptedRecordError
+// when record can't be parsed, reading can be continued after corrupted record
+func (r *Reader) Next() (Record, error) {
+	for {
+		data, err := r.r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return Record{}, err
+		}
+		if len(data) == 0 && err == io.EOF {
+			return Record{}, io.EOF
+		}
+		r.line++
+
+		if err == io.EOF {
+			return Record{}, &CorruptedRecordError{Line: r.line, Err: ErrTruncated}
+		}
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return Record{}, &CorruptedRecordError{Line: r.line, Err: err}
+		}
+		if record.Version != Version {
+			return Record{}, &CorruptedRecordError{Line: r.line, Err: fmt.Errorf("unsupported record version %d", record.Version)}
+		}
+
+		return record, nil
+	}
+}
+
+// Line returns number of the line last record was read from
+func (r *Reader) Line() int {
+	return r.line
+}
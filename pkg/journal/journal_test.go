@@ -0,0 +1,182 @@
+package journal_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+)
+
+func readAll(t *testing.T, path string) ([]journal.Record, []error) {
+	segments, err := journal.Segments(path)
+	assert.NoError(t, err)
+
+	var records []journal.Record
+	var corrupted []error
+	for _, segment := range segments {
+		file, err := journal.OpenSegment(segment)
+		if !assert.NoError(t, err) {
+			return nil, nil
+		}
+		reader := journal.NewReader(file)
+		for {
+			record, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				corrupted = append(corrupted, err)
+				continue
+			}
+			records = append(records, record)
+		}
+		assert.NoError(t, file.Close())
+	}
+	return records, corrupted
+}
+
+func TestWriterAndReader(t *testing.T) {
+	cases := map[string]struct {
+		appendRaw         string
+		expectedCorrupted []error
+	}{
+		"Reading written records": {},
+		"Reading records with truncated tail": {
+			appendRaw: `{"v":1,"operation":"Add","ke`,
+			expectedCorrupted: []error{
+				&journal.CorruptedRecordError{Line: 3, Err: journal.ErrTruncated},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log.txt")
+			file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			w := journal.NewWriter(file, journal.SyncAlways, 0)
+			assert.NoError(t, w.Write(journal.Record{Operation: "Add", Key: "a:b", Value: "line\nbreak", Result: journal.ResultOk}))
+			assert.NoError(t, w.Write(journal.Record{Operation: "Remove", Key: "c", Result: journal.ResultError, Error: "key `c' not found"}))
+			assert.NoError(t, w.Close())
+
+			if tc.appendRaw != "" {
+				raw, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+				if assert.NoError(t, err) {
+					_, err = raw.WriteString(tc.appendRaw)
+					assert.NoError(t, err)
+					assert.NoError(t, raw.Close())
+				}
+			}
+
+			records, corrupted := readAll(t, path)
+			if assert.Len(t, records, 2) {
+				assert.Equal(t, journal.Version, records[0].Version)
+				assert.Equal(t, "a:b", records[0].Key)
+				assert.Equal(t, "line\nbreak", records[0].Value)
+				assert.False(t, records[0].Time.IsZero())
+				assert.Equal(t, "key `c' not found", records[1].Error)
+			}
+			assert.Equal(t, tc.expectedCorrupted, corrupted)
+		})
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.txt")
+	file, err := journal.OpenRotatingFile(path, journal.RotateOptions{
+		MaxSize:     512,
+		MaxSegments: 3,
+		Compress:    true,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// buffer is flushed in chunks bigger than MaxSize, so every flush rotates file while writers are active
+	w := journal.NewWriter(file, journal.SyncNever, 0)
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				err := w.Write(journal.Record{
+					Operation: "Add",
+					Key:       fmt.Sprintf("%d-%d", p, i),
+					Value:     strings.Repeat("x", 50),
+					Result:    journal.ResultOk,
+				})
+				assert.NoError(t, err)
+			}
+		}(p)
+	}
+	wg.Wait()
+	assert.NoError(t, w.Close())
+
+	segments, err := journal.Segments(path)
+	assert.NoError(t, err)
+	if assert.Len(t, segments, 4) {
+		for _, segment := range segments[:3] {
+			assert.True(t, strings.HasSuffix(segment, ".gz"), segment)
+		}
+		assert.Equal(t, path, segments[3])
+	}
+
+	records, corrupted := readAll(t, path)
+	assert.Empty(t, corrupted)
+	assert.NotEmpty(t, records)
+
+	trimmed, err := journal.Trimmed(path)
+	assert.NoError(t, err)
+	assert.True(t, trimmed)
+}
+
+func TestSegments(t *testing.T) {
+	cases := map[string]struct {
+		files    []string
+		expected []string
+	}{
+		"Listing plain and compressed segments": {
+			files:    []string{"log.txt", "log.txt.20261019T100000.000000000.gz", "log.txt.20261019T110000.000000000"},
+			expected: []string{"log.txt.20261019T100000.000000000.gz", "log.txt.20261019T110000.000000000", "log.txt"},
+		},
+		"Skipping segment which is being compressed": {
+			files:    []string{"log.txt", "log.txt.20261019T100000.000000000", "log.txt.20261019T100000.000000000.gz.tmp"},
+			expected: []string{"log.txt.20261019T100000.000000000", "log.txt"},
+		},
+		"Skipping plain segment which is already compressed": {
+			files:    []string{"log.txt", "log.txt.20261019T100000.000000000", "log.txt.20261019T100000.000000000.gz"},
+			expected: []string{"log.txt.20261019T100000.000000000.gz", "log.txt"},
+		},
+		"Skipping unrelated files": {
+			files:    []string{"log.txt.trimmed", "log.txt.bak", "log.txt.20261019T100000.000000000"},
+			expected: []string{"log.txt.20261019T100000.000000000"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range tc.files {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, file), nil, 0644))
+			}
+
+			segments, err := journal.Segments(filepath.Join(dir, "log.txt"))
+			assert.NoError(t, err)
+			expected := make([]string, 0, len(tc.expected))
+			for _, file := range tc.expected {
+				expected = append(expected, filepath.Join(dir, file))
+			}
+			assert.Equal(t, expected, segments)
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package journal
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+)
+
+// segmentTimeFormat is used as a suffix of rotated segments, it sorts in chronological order
+const segmentTimeFormat = "20060102T150405.000000000"
+
+const compressedSuffix = ".gz"
+
+// partialSuffix marks segment which is being compressed, it's renamed once compression is complete
+const partialSuffix = ".tmp"
+
+// trimmedSuffix marks journal whose oldest segments were removed by retention
+const trimmedSuffix = ".trimmed"
+
+// RotateOptions defines when file is rotated and how many rotated segments are retained
+type RotateOptions struct {
+	// MaxSize is a size in bytes after which file is rotated, 0 disables size based rotation
+	MaxSize int64
+	// MaxAge is a time after which file is rotated, 0 disables time based rotation
+	MaxAge time.Duration
+	// MaxSegments is a number of rotated segments to retain, 0 retains all segments
+	MaxSegments int
+	// Compress enables gzip compression of rotated segments
+	Compress bool
+}
+
+// RotatingFile is an append only file which is rotated by size and age, it's safe for concurrent use
+type RotatingFile struct {
+	lock     sync.Mutex
+	path     string
+	opts     RotateOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	// background serializes compression and retention of rotated segments
+	background sync.Mutex
+	wg         sync.WaitGroup
+}
+
+// OpenRotatingFile opens file for appending, creating it if necessary
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path: path,
+		opts: opts,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p to file, rotating file before the write if it's due
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.rotationDue(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Sync commits file contents to disk
+func (f *RotatingFile) Sync() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.file.Sync()
+}
+
+// Rotate rotates file immediately
+func (f *RotatingFile) Rotate() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.rotate()
+}
+
+// Reopen closes and reopens file by its path, should be called after file was moved by external tool like logrotate
+func (f *RotatingFile) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes file, waiting for compression of rotated segments to finish
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.wg.Wait()
+	return f.file.Close()
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+
+	// record truncated by crash must not swallow the next one
+	if err := f.terminateLastLine(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (f *RotatingFile) terminateLastLine() error {
+	if f.size == 0 {
+		return nil
+	}
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, f.size-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	n, err := f.file.Write([]byte{'\n'})
+	f.size += int64(n)
+
+	return err
+}
+
+func (f *RotatingFile) rotationDue(writeSize int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+writeSize > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && time.Since(f.openedAt) >= f.opts.MaxAge
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	segment := f.path + "." + time.Now().UTC().Format(segmentTimeFormat)
+	if err := os.Rename(f.path, segment); err != nil {
+		// keep writing to the old file rather than losing records
+		if openErr := f.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.background.Lock()
+		defer f.background.Unlock()
+
+		logger := logging.Default().With("segment", segment)
+		if f.opts.Compress {
+			if err := compress(segment); err != nil {
+				logger.Error("error compressing rotated segment", "error", err)
+			}
+		}
+		if err := f.removeOldSegments(); err != nil {
+			logger.Error("error removing old segments", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+func (f *RotatingFile) removeOldSegments() error {
+	if f.opts.MaxSegments <= 0 {
+		return nil
+	}
+
+	segments, err := rotatedSegments(f.path)
+	if err != nil {
+		return err
+	}
+	for len(segments) > f.opts.MaxSegments {
+		// mark journal before removing anything, so it's never seen as complete without its oldest records
+		if err := os.WriteFile(f.path+trimmedSuffix, []byte(filepath.Base(segments[0])+"\n"), 0644); err != nil {
+			return err
+		}
+		if err := os.Remove(segments[0]); err != nil {
+			return err
+		}
+		// plain segment is left behind if compression was interrupted before removing it
+		if err := os.Remove(strings.TrimSuffix(segments[0], compressedSuffix)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		segments = segments[1:]
+	}
+
+	return nil
+}
+
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	partial := path + compressedSuffix + partialSuffix
+	out, err := os.OpenFile(partial, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partial, path+compressedSuffix); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// rotatedSegments returns rotated segments of file at path, oldest first; segments which are still being compressed
+// are skipped, as well as plain segments which are already compressed but not removed yet
+func rotatedSegments(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	compressed := make(map[string]bool)
+	for _, match := range matches {
+		if strings.HasSuffix(match, compressedSuffix) {
+			compressed[strings.TrimSuffix(match, compressedSuffix)] = true
+		}
+	}
+
+	segments := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if compressed[match] {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, path+"."), compressedSuffix)
+		if _, err := time.Parse(segmentTimeFormat, suffix); err == nil {
+			segments = append(segments, match)
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return strings.TrimSuffix(segments[i], compressedSuffix) < strings.TrimSuffix(segments[j], compressedSuffix)
+	})
+
+	return segments, nil
+}
+
+// Segments returns rotated segments of journal at path oldest first, followed by the journal itself if it exists
+func Segments(path string) ([]string, error) {
+	segments, err := rotatedSegments(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		segments = append(segments, path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return segments, nil
+}
+
+// Trimmed reports whether oldest segments of journal at path were removed by retention, so journal doesn't start
+// with its first record
+func Trimmed(path string) (bool, error) {
+	_, err := os.Stat(path + trimmedSuffix)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// OpenSegment opens journal segment for reading, decompressing it if necessary
+func OpenSegment(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, compressedSuffix) {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: gz, file: file}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (f *gzipFile) Close() error {
+	if err := f.Reader.Close(); err != nil {
+		_ = f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
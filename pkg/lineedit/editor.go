@@ -0,0 +1,310 @@
+// Package lineedit implements minimal line editor for terminals: cursor movement, history navigation
+// and tab completion, understood escape sequences are the ones sent by xterm compatible terminals
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when ^C is pressed
+var ErrInterrupted = errors.New("interrupted")
+
+// Completer returns candidates to replace text before cursor with
+type Completer func(head string) []string
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// Editor reads lines from terminal, input is switched to raw mode only while ReadLine is running
+type Editor struct {
+	in        *bufio.Reader
+	out       io.Writer
+	fd        int
+	history   *History
+	completer Completer
+	lastCR    bool
+}
+
+// NewEditor creates new editor, history and completer are optional;
+// raw mode is used only if in is a terminal, so editor can be driven by any reader
+func NewEditor(in io.Reader, out io.Writer, history *History, completer Completer) *Editor {
+	fd := -1
+	if file, ok := in.(*os.File); ok && IsTerminal(int(file.Fd())) {
+		fd = int(file.Fd())
+	}
+	if history == nil {
+		history = NewHistory(0)
+	}
+	return &Editor{
+		in:        bufio.NewReader(in),
+		out:       out,
+		fd:        fd,
+		history:   history,
+		completer: completer,
+	}
+}
+
+// line is a state of line being edited
+type line struct {
+	prompt string
+	buf    []rune
+	pos    int
+	// history is a snapshot of history entries with the edited line at the end
+	history    []string
+	historyIdx int
+}
+
+// ReadLine shows prompt and reads one line, it returns io.EOF on ^D pressed in empty line
+// and ErrInterrupted on ^C; line isn't added to history, it's up to caller to do it
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		state, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore(e.fd, state)
+	}
+
+	l := &line{prompt: prompt, history: append(e.history.Entries(), "")}
+	l.historyIdx = len(l.history) - 1
+	e.refresh(l)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(l.buf) > 0 {
+				e.write("\n")
+				return string(l.buf), nil
+			}
+			return "", err
+		}
+		if r == keyLF && e.lastCR {
+			e.lastCR = false
+			continue
+		}
+		e.lastCR = r == keyCR
+
+		switch r {
+		case keyCR, keyLF:
+			e.write("\n")
+			return string(l.buf), nil
+		case keyCtrlC:
+			e.write("^C\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(l.buf) == 0 {
+				e.write("\n")
+				return "", io.EOF
+			}
+			l.delete()
+		case keyCtrlA:
+			l.pos = 0
+		case keyCtrlE:
+			l.pos = len(l.buf)
+		case keyCtrlB:
+			l.left()
+		case keyCtrlF:
+			l.right()
+		case keyCtrlP:
+			l.moveHistory(-1)
+		case keyCtrlN:
+			l.moveHistory(1)
+		case keyCtrlH, keyBackspace:
+			if l.pos > 0 {
+				l.pos--
+				l.delete()
+			}
+		case keyCtrlK:
+			l.buf = l.buf[:l.pos]
+		case keyCtrlU:
+			l.buf = append(l.buf[:0], l.buf[l.pos:]...)
+			l.pos = 0
+		case keyCtrlW:
+			l.deleteWord()
+		case keyCtrlL:
+			e.write("\x1b[H\x1b[2J")
+		case keyTab:
+			e.complete(l)
+		case keyEscape:
+			if err := e.escape(l); err != nil {
+				return "", err
+			}
+		default:
+			if unicode.IsPrint(r) {
+				l.insert(r)
+			}
+		}
+		e.refresh(l)
+	}
+}
+
+// escape handles escape sequence, e.g. ESC [ A for up arrow
+func (e *Editor) escape(l *line) error {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return err
+	}
+	if r != '[' && r != 'O' {
+		return nil
+	}
+
+	var param strings.Builder
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+		param.WriteRune(r)
+	}
+
+	switch r {
+	case 'A':
+		l.moveHistory(-1)
+	case 'B':
+		l.moveHistory(1)
+	case 'C':
+		l.right()
+	case 'D':
+		l.left()
+	case 'H':
+		l.pos = 0
+	case 'F':
+		l.pos = len(l.buf)
+	case '~':
+		switch param.String() {
+		case "1", "7":
+			l.pos = 0
+		case "4", "8":
+			l.pos = len(l.buf)
+		case "3":
+			l.delete()
+		}
+	}
+	return nil
+}
+
+// complete replaces text before cursor with completion candidate or with their common prefix,
+// candidates are listed if there is nothing to complete
+func (e *Editor) complete(l *line) {
+	if e.completer == nil {
+		return
+	}
+	head := string(l.buf[:l.pos])
+	candidates := e.completer(head)
+	if len(candidates) == 0 {
+		e.write("\a")
+		return
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 || (prefix != head && strings.HasPrefix(prefix, head)) {
+		tail := l.buf[l.pos:]
+		l.buf = append([]rune(prefix), tail...)
+		l.pos = len([]rune(prefix))
+		return
+	}
+	e.write("\n" + strings.Join(candidates, "  ") + "\n")
+}
+
+// refresh redraws prompt and line, then moves cursor to its position
+func (e *Editor) refresh(l *line) {
+	e.write(fmt.Sprintf("\r%s%s\x1b[K", l.prompt, string(l.buf)))
+	if back := len(l.buf) - l.pos; back > 0 {
+		e.write(fmt.Sprintf("\x1b[%dD", back))
+	}
+}
+
+func (e *Editor) write(s string) {
+	_, _ = io.WriteString(e.out, s)
+}
+
+func (l *line) insert(r rune) {
+	l.buf = append(l.buf, 0)
+	copy(l.buf[l.pos+1:], l.buf[l.pos:])
+	l.buf[l.pos] = r
+	l.pos++
+}
+
+// delete deletes rune under cursor
+func (l *line) delete() {
+	if l.pos < len(l.buf) {
+		l.buf = append(l.buf[:l.pos], l.buf[l.pos+1:]...)
+	}
+}
+
+// deleteWord deletes word before cursor together with spaces following it
+func (l *line) deleteWord() {
+	start := l.pos
+	for start > 0 && unicode.IsSpace(l.buf[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(l.buf[start-1]) {
+		start--
+	}
+	l.buf = append(l.buf[:start], l.buf[l.pos:]...)
+	l.pos = start
+}
+
+func (l *line) left() {
+	if l.pos > 0 {
+		l.pos--
+	}
+}
+
+func (l *line) right() {
+	if l.pos < len(l.buf) {
+		l.pos++
+	}
+}
+
+// moveHistory replaces line with previous (delta -1) or next (delta 1) history entry,
+// edits of entries are kept until line is returned
+func (l *line) moveHistory(delta int) {
+	idx := l.historyIdx + delta
+	if idx < 0 || idx >= len(l.history) {
+		return
+	}
+	l.history[l.historyIdx] = string(l.buf)
+	l.historyIdx = idx
+	l.buf = []rune(l.history[idx])
+	l.pos = len(l.buf)
+}
+
+func commonPrefix(candidates []string) string {
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,130 @@
+package lineedit_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/lineedit"
+)
+
+func TestEditor_ReadLine(t *testing.T) {
+	history := lineedit.NewHistory(10)
+	assert.NoError(t, history.Add("+1:A"))
+	assert.NoError(t, history.Add("<1"))
+	completer := func(head string) []string {
+		var candidates []string
+		for _, candidate := range []string{"<key1", "<key2", "<other"} {
+			if strings.HasPrefix(candidate, head) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		return candidates
+	}
+
+	cases := map[string]struct {
+		input    string
+		expected []string
+		err      error
+	}{
+		"Plain lines": {
+			input:    "+1:A\r-1\n<2\r\n*\r",
+			expected: []string{"+1:A", "-1", "<2", "*"},
+		},
+		"Cursor movement": {
+			input:    "+1A\x1b[D:\x01\x1b[C\x1b[C2\x05B\r",
+			expected: []string{"+12:AB"},
+		},
+		"Deleting": {
+			input:    "+1:AB\x7f\x7fC\r-12\x1b[D\x04\r<abc def\x17\x17x\r+1:ABC\x02\x02\x0b\r",
+			expected: []string{"+1:C", "-1", "x", "+1:A"},
+		},
+		"History navigation": {
+			input:    "\x1b[A\r\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[B\r",
+			expected: []string{"<1", "+1:A", "<1"},
+		},
+		"Completion": {
+			input:    "<k\t\r<o\t\r<x\t\r",
+			expected: []string{"<key", "<other", "<x"},
+		},
+		"Interrupt": {
+			input: "+1:A\x03",
+			err:   lineedit.ErrInterrupted,
+		},
+		"End of input": {
+			input:    "+1:A\r\x04",
+			expected: []string{"+1:A"},
+			err:      io.EOF,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var out strings.Builder
+			editor := lineedit.NewEditor(strings.NewReader(tc.input), &out, history, completer)
+
+			var lines []string
+			var err error
+			for {
+				var line string
+				if line, err = editor.ReadLine("> "); err != nil {
+					break
+				}
+				lines = append(lines, line)
+			}
+
+			assert.Equal(t, tc.expected, lines)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+			} else {
+				assert.Equal(t, io.EOF, err)
+			}
+		})
+	}
+}
+
+func TestOpenHistory(t *testing.T) {
+	path := t.TempDir() + "/history"
+
+	history, err := lineedit.OpenHistory(path, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, entry := range []string{"+1:A", "", "+1:A", "+2:multi\nline", `+3:back\slash`, "<1"} {
+		assert.NoError(t, history.Add(entry))
+	}
+	expected := []string{"+2:multi\nline", `+3:back\slash`, "<1"}
+	assert.Equal(t, expected, history.Entries())
+	assert.NoError(t, history.Close())
+
+	history, err = lineedit.OpenHistory(path, 3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, expected, history.Entries())
+	assert.NoError(t, history.Add("-1"))
+	assert.NoError(t, history.Close())
+
+	history, err = lineedit.OpenHistory(path, 10)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, append(expected, "-1"), history.Entries())
+	assert.NoError(t, history.Close())
+}
+
+func TestNewHistory_Unlimited(t *testing.T) {
+	history := lineedit.NewHistory(0)
+	for _, entry := range []string{"+1:A", "<1", "-1"} {
+		assert.NoError(t, history.Add(entry))
+	}
+	assert.Equal(t, []string{"+1:A", "<1", "-1"}, history.Entries())
+
+	// entries are recalled with up arrow
+	editor := lineedit.NewEditor(strings.NewReader("\x1b[A\x1b[A\r"), io.Discard, history, nil)
+	line, err := editor.ReadLine("> ")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "<1", line)
+	}
+}
@@ -0,0 +1,129 @@
+package lineedit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// History is a list of entered lines, optionally persisted in a file with one entry per line;
+// backslashes and newlines of multi-line entries are escaped as \\ and \n
+type History struct {
+	mu      sync.Mutex
+	entries []string
+	max     int
+	file    *os.File
+}
+
+// NewHistory creates in-memory history keeping at most max entries, all of them if max <= 0
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// OpenHistory loads history from file at path, creating it if it doesn't exist, and appends new entries to it;
+// file is rewritten if it holds more than max entries
+func OpenHistory(path string, max int) (*History, error) {
+	h := NewHistory(max)
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	total, err := h.load(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if max > 0 && total > max {
+		if err := h.rewrite(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	h.file = file
+
+	return h, nil
+}
+
+// Add appends entry to history, empty entries and repetitions of the last entry are ignored
+func (h *History) Add(entry string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if strings.TrimSpace(entry) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return nil
+	}
+	h.append(entry)
+
+	if h.file == nil {
+		return nil
+	}
+	_, err := h.file.WriteString(escapeEntry(entry) + "\n")
+	return err
+}
+
+// Entries returns copy of history entries, the oldest first
+func (h *History) Entries() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]string(nil), h.entries...)
+}
+
+// Close closes history file
+func (h *History) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
+
+func (h *History) append(entry string) {
+	h.entries = append(h.entries, entry)
+	if h.max > 0 && len(h.entries) > h.max {
+		h.entries = append(h.entries[:0], h.entries[len(h.entries)-h.max:]...)
+	}
+}
+
+// load reads entries from r and returns their total number
+func (h *History) load(r io.Reader) (int, error) {
+	total := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		h.append(unescapeEntry(scanner.Text()))
+		total++
+	}
+	return total, scanner.Err()
+}
+
+func (h *History) rewrite(file *os.File) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, entry := range h.entries {
+		if _, err := w.WriteString(escapeEntry(entry) + "\n"); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+var (
+	entryEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	entryUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+)
+
+func escapeEntry(entry string) string {
+	return entryEscaper.Replace(entry)
+}
+
+func unescapeEntry(line string) string {
+	return entryUnescaper.Replace(line)
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package lineedit
+
+import "errors"
+
+type termState struct{}
+
+// IsTerminal reports whether fd refers to a terminal, terminals are not supported on this platform
+func IsTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
+
+func restore(fd int, state *termState) error {
+	return nil
+}
@@ -0,0 +1,266 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Level is a severity of log entry
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLevel parses level name, one of debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// Format defines how log entries are rendered
+type Format string
+
+const (
+	TextFormat = Format("text")
+	JSONFormat = Format("json")
+)
+
+// ParseFormat parses format name, one of text or json
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case TextFormat, JSONFormat:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown log format %q", name)
+}
+
+// output is shared by logger and all loggers derived from it with With
+type output struct {
+	lock   sync.Mutex
+	writer io.Writer
+	format Format
+	level  Level
+}
+
+// Logger writes leveled log entries with attached key/value fields
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// New creates new logger writing entries with given level or above to writer
+func New(writer io.Writer, format Format, level Level) *Logger {
+	return &Logger{
+		out: &output{
+			writer: writer,
+			format: format,
+			level:  level,
+		},
+	}
+}
+
+var defaultLogger = New(os.Stderr, TextFormat, InfoLevel)
+
+// Default returns default logger, which writes text entries to stderr unless replaced with SetDefault
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetDefault replaces default logger
+func SetDefault(logger *Logger) {
+	defaultLogger = logger
+}
+
+// With returns logger which adds given key/value pairs to every entry
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+
+	return &Logger{
+		out:    l.out,
+		fields: fields,
+	}
+}
+
+// Enabled reports whether entries with given level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+// Debug writes debug entry
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.log(DebugLevel, msg, keyValues)
+}
+
+// Info writes info entry
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.log(InfoLevel, msg, keyValues)
+}
+
+// Warn writes warning entry
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.log(WarnLevel, msg, keyValues)
+}
+
+// Error writes error entry
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.log(ErrorLevel, msg, keyValues)
+}
+
+// Fatal writes error entry and exits with non-zero code
+func (l *Logger) Fatal(msg string, keyValues ...interface{}) {
+	l.log(ErrorLevel, msg, keyValues)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, keyValues []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := make([]interface{}, 0, len(l.fields)+len(keyValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyValues...)
+
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	if l.out.format == JSONFormat {
+		writeJSON(&buf, now, level, msg, fields)
+	} else {
+		writeText(&buf, now, level, msg, fields)
+	}
+
+	l.out.lock.Lock()
+	_, _ = l.out.writer.Write(buf.Bytes())
+	l.out.lock.Unlock()
+}
+
+const timeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+func writeText(buf *bytes.Buffer, t time.Time, level Level, msg string, fields []interface{}) {
+	buf.WriteString(t.Format(timeFormat))
+	buf.WriteByte(' ')
+	fmt.Fprintf(buf, "%-5s", level)
+	buf.WriteByte(' ')
+	buf.WriteString(quoteIfNeeded(msg))
+	eachField(fields, func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(quoteIfNeeded(valueString(value)))
+	})
+	buf.WriteByte('\n')
+}
+
+func writeJSON(buf *bytes.Buffer, t time.Time, level Level, msg string, fields []interface{}) {
+	buf.WriteString(`{"time":`)
+	writeJSONValue(buf, t.Format(timeFormat))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(buf, msg)
+	eachField(fields, func(key string, value interface{}) {
+		buf.WriteByte(',')
+		writeJSONValue(buf, key)
+		buf.WriteByte(':')
+		switch v := value.(type) {
+		case error:
+			value = v.Error()
+		case fmt.Stringer:
+			value = v.String()
+		}
+		writeJSONValue(buf, value)
+	})
+	buf.WriteString("}\n")
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		bytes, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(bytes)
+}
+
+// eachField calls fn for every key/value pair, odd trailing value is reported with key "!BADKEY"
+func eachField(fields []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			fn("!BADKEY", fields[i])
+			return
+		}
+		key, ok := fields[i].(string)
+		if !ok {
+			key = fmt.Sprint(fields[i])
+		}
+		fn(key, fields[i+1])
+	}
+}
+
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func quoteIfNeeded(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// Setup replaces default logger with one writing to stderr with given format and level names
+func Setup(formatName, levelName string) error {
+	format, err := ParseFormat(formatName)
+	if err != nil {
+		return err
+	}
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	SetDefault(New(os.Stderr, format, level))
+	return nil
+}
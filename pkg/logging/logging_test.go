@@ -0,0 +1,68 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+)
+
+func TestLogger(t *testing.T) {
+	cases := map[string]struct {
+		format   logging.Format
+		level    logging.Level
+		scenario func(logger *logging.Logger)
+		expected []string
+	}{
+		"Text entry with context": {
+			format: logging.TextFormat,
+			level:  logging.InfoLevel,
+			scenario: func(logger *logging.Logger) {
+				logger.With("processor", "processor-1", "key", "a b").Info("adding item", "value", `x="y"`)
+			},
+			expected: []string{`info  "adding item" processor=processor-1 key="a b" value="x=\"y\""`},
+		},
+		"Entries below level are skipped": {
+			format: logging.TextFormat,
+			level:  logging.WarnLevel,
+			scenario: func(logger *logging.Logger) {
+				logger.Info("skipped")
+				logger.Warn("written", "error", errors.New("failed"))
+			},
+			expected: []string{`warn  written error=failed`},
+		},
+		"JSON entry with context": {
+			format: logging.JSONFormat,
+			level:  logging.DebugLevel,
+			scenario: func(logger *logging.Logger) {
+				logger.With("operation", "Add").Debug("message received", "count", 2, "error", errors.New("failed"))
+			},
+			expected: []string{`"level":"debug","msg":"message received","operation":"Add","count":2,"error":"failed"}`},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			tc.scenario(logging.New(&out, tc.format, tc.level))
+
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if assert.Len(t, lines, len(tc.expected)) {
+				for i, line := range lines {
+					// skip timestamp, which is the first field in both formats
+					if tc.format == logging.JSONFormat {
+						assert.True(t, json.Valid([]byte(line)))
+						line = line[strings.Index(line, `"level"`):]
+					} else {
+						line = line[strings.Index(line, " ")+1:]
+					}
+					assert.Equal(t, tc.expected[i], line)
+				}
+			}
+		})
+	}
+}
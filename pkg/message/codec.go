@@ -0,0 +1,298 @@
+package message
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ContentTypeAttribute is a name of SQS message attribute identifying codec of message body,
+// messages without it are decoded as JSON
+const ContentTypeAttribute = "content-type"
+
+const (
+	JSONContentType     = "application/json"
+	MsgPackContentType  = "application/msgpack"
+	ProtobufContentType = "application/x-protobuf"
+)
+
+// Codec encodes messages into SQS message bodies and decodes them back
+type Codec interface {
+	// Name is a short name of codec used in command line flags
+	Name() string
+	// ContentType identifies codec in content-type message attribute
+	ContentType() string
+	// Encode validates and encodes message, encoded message must fit SQS message
+	Encode(msg Message) (string, error)
+	// Decode decodes and validates message; if message is decoded but invalid, it's returned along with *ValidationError
+	Decode(body string) (*Any, error)
+}
+
+var (
+	JSONCodec     Codec = jsonCodec{}
+	MsgPackCodec  Codec = binaryCodec{name: "msgpack", contentType: MsgPackContentType, marshal: marshalMsgPack, unmarshal: unmarshalMsgPack}
+	ProtobufCodec Codec = binaryCodec{name: "protobuf", contentType: ProtobufContentType, marshal: marshalProtobuf, unmarshal: unmarshalProtobuf}
+)
+
+var codecs = []Codec{JSONCodec, MsgPackCodec, ProtobufCodec}
+
+// CodecByName returns codec with given name: json, msgpack or protobuf
+func CodecByName(name string) (Codec, error) {
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+// CodecByContentType returns codec for content type, JSON codec is returned for empty content type
+func CodecByContentType(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec, nil
+	}
+	for _, codec := range codecs {
+		if codec.ContentType() == contentType {
+			return codec, nil
+		}
+	}
+	return nil, invalid(CodeInvalidValue, ContentTypeAttribute, "unsupported content type %q", contentType)
+}
+
+// wire is a flat representation of any message, all codecs decode into it at once;
+// Remove and Get carry key as itemId in JSON of protocol version 1, binary codecs use key for all messages
+type wire struct {
+	Fields
+	ItemId string `json:"itemId,omitempty"`
+	// unknown are names of fields unknown to decoder
+	unknown []string
+}
+
+func toWire(msg Message) (wire, error) {
+	fields, err := fieldsOf(msg)
+	if err == nil && len(fields.Payload) > 0 && !json.Valid(fields.Payload) {
+		err = invalid(CodeInvalidValue, "payload", "payload isn't valid JSON")
+	}
+	return wire{Fields: fields}, err
+}
+
+// key returns key of item regardless of field name it was sent in
+func (w *wire) key() string {
+	if w.Key != "" {
+		return w.Key
+	}
+	return w.ItemId
+}
+
+// decode checks decoded wire and converts it to valid message; unknown fields are allowed only in messages
+// of minor version newer than supported one
+func (w *wire) decode() (*Any, error) {
+	if len(w.unknown) > 0 && !newerMinorVersion(w.Version) {
+		return nil, invalid(CodeUnknownField, w.unknown[0], "unknown field")
+	}
+	if len(w.Payload) > 0 && !json.Valid(w.Payload) {
+		return nil, invalid(CodeInvalidValue, "payload", "payload isn't valid JSON")
+	}
+	msg, err := w.toAny()
+	if err != nil {
+		return nil, err
+	}
+	return msg, msg.Validate()
+}
+
+func (w *wire) toAny() (*Any, error) {
+	if w.Operation == "" {
+		return nil, invalid(CodeRequired, "operation", "operation is required")
+	}
+	spec, ok := LookupOperation(w.Operation)
+	if !ok {
+		return nil, invalid(CodeUnknownOperation, "operation", "unrecognized operation %q", w.Operation)
+	}
+	fields := w.Fields
+	fields.Key = w.key()
+	return NewAny(spec.Decode(fields)), nil
+}
+
+// jsonCodec keeps messages in the format produced by ToJSON, or in format of protocol version 1 for messages of this version
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) ContentType() string {
+	return JSONContentType
+}
+
+func (jsonCodec) Encode(msg Message) (string, error) {
+	if err := Validate(msg); err != nil {
+		return "", err
+	}
+	var body string
+	var err error
+	if major, _, _ := ParseVersion(msg.Meta().Version); major == 1 {
+		body, err = encodeJSONv1(msg)
+	} else {
+		body, err = msg.ToJSON()
+	}
+	if err != nil {
+		return "", err
+	}
+	return body, checkBodySize(body)
+}
+
+func (jsonCodec) Decode(body string) (*Any, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		return nil, malformed("json", err)
+	}
+
+	var w wire
+	for name, raw := range fields {
+		switch name {
+		case "payload":
+			w.Payload = raw
+			continue
+		case "itemId":
+			if err := json.Unmarshal(raw, &w.ItemId); err != nil {
+				return nil, malformed("json", fmt.Errorf("field %s: %w", name, err))
+			}
+			continue
+		}
+		// known fields are strings, while unknown ones may be of any type
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			if w.set(0, name, "") {
+				return nil, malformed("json", fmt.Errorf("field %s: %w", name, err))
+			}
+			w.unknown = append(w.unknown, name)
+			continue
+		}
+		if !w.set(0, name, value) {
+			w.unknown = append(w.unknown, name)
+		}
+	}
+	// fields of map are visited in random order
+	sort.Strings(w.unknown)
+	return w.decode()
+}
+
+// malformed returns error of message body which can't be decoded
+func malformed(codec string, err error) error {
+	return &ValidationError{Code: CodeMalformed, Reason: fmt.Sprintf("invalid %s body: %v", codec, err), Err: err}
+}
+
+// encodeJSONv1 encodes message with key of Remove and Get in itemId field
+func encodeJSONv1(msg Message) (string, error) {
+	w, err := toWire(msg)
+	if err != nil {
+		return "", err
+	}
+	if w.Operation == RemoveOp || w.Operation == GetItemOp {
+		w.ItemId, w.Key = w.Key, ""
+	}
+	body, err := json.Marshal(w)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// binaryCodec encodes messages in binary format, base64 encoded since SQS message body must be a text
+type binaryCodec struct {
+	name        string
+	contentType string
+	marshal     func(w wire) []byte
+	unmarshal   func(data []byte) (wire, error)
+}
+
+func (c binaryCodec) Name() string {
+	return c.name
+}
+
+func (c binaryCodec) ContentType() string {
+	return c.contentType
+}
+
+func (c binaryCodec) Encode(msg Message) (string, error) {
+	if err := Validate(msg); err != nil {
+		return "", err
+	}
+	w, err := toWire(msg)
+	if err != nil {
+		return "", err
+	}
+	body := base64.StdEncoding.EncodeToString(c.marshal(w))
+	return body, checkBodySize(body)
+}
+
+func (c binaryCodec) Decode(body string) (*Any, error) {
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, malformed(c.name, err)
+	}
+	w, err := c.unmarshal(data)
+	if err != nil {
+		return nil, malformed(c.name, err)
+	}
+	return w.decode()
+}
+
+// fields returns non-empty fields of wire with their names and protobuf field numbers, see message.proto
+func (w *wire) fields() []wireField {
+	all := []wireField{
+		{1, "operation", string(w.Operation)},
+		{2, "namespace", w.Namespace},
+		{3, "correlationId", w.CorrelationId},
+		{4, "replyTo", w.ReplyTo},
+		{5, "key", w.Key},
+		{6, "data", w.Data},
+		{7, "onConflict", string(w.OnConflict)},
+		{8, "version", w.Version},
+		{9, "dataRef", w.DataRef},
+		{10, "payload", string(w.Payload)},
+	}
+	fields := all[:0]
+	for _, f := range all {
+		if f.value != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// set sets field by name or protobuf number, it reports whether field is known
+func (w *wire) set(number int, name string, value string) bool {
+	switch {
+	case number == 1 || name == "operation":
+		w.Operation = Operation(value)
+	case number == 2 || name == "namespace":
+		w.Namespace = value
+	case number == 3 || name == "correlationId":
+		w.CorrelationId = value
+	case number == 4 || name == "replyTo":
+		w.ReplyTo = value
+	case number == 5 || name == "key":
+		w.Key = value
+	case number == 6 || name == "data":
+		w.Data = value
+	case number == 7 || name == "onConflict":
+		w.OnConflict = ConflictMode(value)
+	case number == 8 || name == "version":
+		w.Version = value
+	case number == 9 || name == "dataRef":
+		w.DataRef = value
+	case number == 10 || name == "payload":
+		w.Payload = json.RawMessage(value)
+	default:
+		return false
+	}
+	return true
+}
+
+type wireField struct {
+	number int
+	name   string
+	value  string
+}
@@ -0,0 +1,162 @@
+package message_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+var codecs = []message.Codec{message.JSONCodec, message.MsgPackCodec, message.ProtobufCodec}
+
+func TestCodecs(t *testing.T) {
+	add := message.NewAdd("teamA", "1", strings.Repeat("value ", 10))
+	add.OnConflict = message.ConflictSkip
+	add.ReplyTo = "http://localhost:4566/000000000000/replies"
+
+	msgs := []message.Message{
+		add,
+		message.NewAdd("", "empty", ""),
+		message.NewRemove("teamA", "1"),
+		message.NewGet("", strings.Repeat("k", 300)),
+		message.NewGetAll("teamA"),
+		message.NewListNamespaces(),
+		message.NewDropNamespace("teamA"),
+		message.NewCapabilities(),
+		message.WithVersion(message.NewRemove("teamA", "1"), message.Version1),
+		message.WithVersion(message.NewGet("teamA", "1"), ""),
+	}
+
+	for _, codec := range codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			byType, err := message.CodecByContentType(codec.ContentType())
+			if assert.NoError(t, err) {
+				assert.Equal(t, codec.Name(), byType.Name())
+			}
+
+			for _, msg := range msgs {
+				body, err := codec.Encode(msg)
+				if !assert.NoError(t, err) {
+					continue
+				}
+				decoded, err := codec.Decode(body)
+				if !assert.NoError(t, err) {
+					continue
+				}
+				assert.Equal(t, msg.Meta(), decoded.Base)
+				assert.Equal(t, msg, concrete(decoded))
+			}
+
+			_, err = codec.Decode("!")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCodecs_Compatibility(t *testing.T) {
+	// fields are in the same order as produced by ToJSON before codecs were introduced
+	any, err := message.JSONCodec.Decode(`{"operation":"Remove","namespace":"teamA","correlationId":"c1","itemId":"1"}`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", any.Remove.Key)
+	}
+
+	// unknown keys of any type are rejected, unless message is of newer minor version
+	_, err = message.JSONCodec.Decode(`{"operation":"Get","key":"1","extra":[1,{"a":true}],"ttl":300}`)
+	assert.Equal(t, message.CodeUnknownField, message.CodeOf(err))
+	any, err = message.JSONCodec.Decode(`{"version":"2.9","operation":"Get","key":"1","extra":[1,{"a":true}],"ttl":300}`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", any.GetItem.Key)
+	}
+	_, err = message.JSONCodec.Decode(`{"operation":"Get","key":1}`)
+	assert.Equal(t, message.CodeMalformed, message.CodeOf(err))
+
+	// map with unknown keys of other types: {"operation":"Get","key":"1","extra":[1,{"a":true}],"ttl":300}
+	msgPack := []byte{0x84, 0xa9, 'o', 'p', 'e', 'r', 'a', 't', 'i', 'o', 'n', 0xa3, 'G', 'e', 't', 0xa3, 'k', 'e', 'y', 0xa1, '1',
+		0xa5, 'e', 'x', 't', 'r', 'a', 0x92, 0x01, 0x81, 0xa1, 'a', 0xc3, 0xa3, 't', 't', 'l', 0xcd, 0x01, 0x2c}
+	_, err = message.MsgPackCodec.Decode(base64.StdEncoding.EncodeToString(msgPack))
+	assert.Equal(t, message.CodeUnknownField, message.CodeOf(err))
+
+	// unknown keys are skipped in messages of newer minor version, "version":"2.9" is added
+	msgPack[0] = 0x85
+	msgPack = append(msgPack, 0xa7, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0xa3, '2', '.', '9')
+	any, err = message.MsgPackCodec.Decode(base64.StdEncoding.EncodeToString(msgPack))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", any.GetItem.Key)
+	}
+
+	// unknown varint field 15 and fixed32 field 16
+	protobuf := []byte{0x0a, 0x03, 'G', 'e', 't', 0x78, 0x96, 0x01, 0x2a, 0x01, '1', 0x85, 0x01, 1, 2, 3, 4}
+	_, err = message.ProtobufCodec.Decode(base64.StdEncoding.EncodeToString(protobuf))
+	assert.Equal(t, message.CodeUnknownField, message.CodeOf(err))
+
+	// are skipped in messages of newer minor version, field 8 is version 2.9
+	protobuf = append(protobuf, 0x42, 0x03, '2', '.', '9')
+	any, err = message.ProtobufCodec.Decode(base64.StdEncoding.EncodeToString(protobuf))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", any.GetItem.Key)
+	}
+
+	_, err = message.CodecByContentType("text/xml")
+	assert.Error(t, err)
+	codec, err := message.CodecByContentType("")
+	if assert.NoError(t, err) {
+		assert.Equal(t, message.JSONCodec.Name(), codec.Name())
+	}
+}
+
+func concrete(any *message.Any) message.Message {
+	switch {
+	case any.Add != nil:
+		return *any.Add
+	case any.Remove != nil:
+		return *any.Remove
+	case any.GetItem != nil:
+		return *any.GetItem
+	case any.GetAllItems != nil:
+		return *any.GetAllItems
+	case any.ListNamespaces != nil:
+		return *any.ListNamespaces
+	case any.DropNamespace != nil:
+		return *any.DropNamespace
+	case any.Capabilities != nil:
+		return *any.Capabilities
+	}
+	return nil
+}
+
+func benchmarkMessage() message.Message {
+	add := message.NewAdd("teamA", "user-12345", strings.Repeat("some value ", 20))
+	add.ReplyTo = "http://localhost:4566/000000000000/replies"
+	return add
+}
+
+func BenchmarkEncode(b *testing.B) {
+	msg := benchmarkMessage()
+	for _, codec := range codecs {
+		b.Run(codec.Name(), func(b *testing.B) {
+			var body string
+			for i := 0; i < b.N; i++ {
+				body, _ = codec.Encode(msg)
+			}
+			b.ReportMetric(float64(len(body)), "body-bytes")
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	msg := benchmarkMessage()
+	for _, codec := range codecs {
+		b.Run(codec.Name(), func(b *testing.B) {
+			body, _ := codec.Encode(msg)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := codec.Decode(body); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(body)), "body-bytes")
+		})
+	}
+}
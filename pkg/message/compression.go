@@ -0,0 +1,83 @@
+package message
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// ContentEncodingAttribute is a name of SQS message attribute identifying compression of message body,
+// compressed bodies are base64 encoded, so they are valid SQS message text
+const ContentEncodingAttribute = "content-encoding"
+
+// GzipEncoding is the only supported compression of message bodies
+const GzipEncoding = "gzip"
+
+// CompressBody compresses encoded message with gzip and encodes result with base64
+func CompressBody(body string) (string, error) {
+	compressed, err := Gzip(body)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(compressed)), nil
+}
+
+// DecompressBody restores body compressed with given encoding, body without encoding is returned as is;
+// decompressed body must fit MaxBodySize as uncompressed one
+func DecompressBody(body string, encoding string) (string, error) {
+	switch encoding {
+	case "":
+		return body, nil
+	case GzipEncoding:
+	default:
+		return "", invalid(CodeInvalidValue, ContentEncodingAttribute, "unsupported content encoding %q", encoding)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return "", malformed(GzipEncoding, err)
+	}
+	decompressed, err := Gunzip(string(compressed), MaxBodySize)
+	if err != nil {
+		if errors.Is(err, errTooLarge) {
+			return "", invalid(CodeTooLarge, "", "decompressed message is longer than %d bytes", MaxBodySize)
+		}
+		return "", malformed(GzipEncoding, err)
+	}
+	return decompressed, nil
+}
+
+// Gzip compresses data with gzip
+func Gzip(data string) (string, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var errTooLarge = errors.New("decompressed data is too large")
+
+// Gunzip decompresses data compressed with Gzip, reading at most limit bytes, so small input can't exhaust memory
+func Gunzip(data string, limit int) (string, error) {
+	r, err := gzip.NewReader(bytes.NewReader([]byte(data)))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return "", err
+	}
+	if n > int64(limit) {
+		return "", errTooLarge
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,43 @@
+package message_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+func TestDecompressBody(t *testing.T) {
+	body := `{"operation":"Add","key":"1","data":"` + strings.Repeat(`{\"a\":1}`, 1000) + `"}`
+	compressed, err := message.CompressBody(body)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Less(t, len(compressed), len(body)/10)
+
+	bomb, _ := message.CompressBody(strings.Repeat(" ", message.MaxBodySize+1))
+
+	cases := map[string]struct {
+		body     string
+		encoding string
+		expected string
+		code     message.ErrorCode
+	}{
+		"gzip":                 {body: compressed, encoding: message.GzipEncoding, expected: body},
+		"not compressed":       {body: body, encoding: "", expected: body},
+		"unsupported encoding": {body: compressed, encoding: "br", code: message.CodeInvalidValue},
+		"invalid base64":       {body: "!", encoding: message.GzipEncoding, code: message.CodeMalformed},
+		"not gzip":             {body: base64.StdEncoding.EncodeToString([]byte(body)), encoding: message.GzipEncoding, code: message.CodeMalformed},
+		"too large":            {body: bomb, encoding: message.GzipEncoding, code: message.CodeTooLarge},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			decompressed, err := message.DecompressBody(c.body, c.encoding)
+			assert.Equal(t, c.code, message.CodeOf(err))
+			assert.Equal(t, c.expected, decompressed)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package message
+
+// Attributes of SQS messages identifying client
+const (
+	// PrincipalAttribute is a name of client, it's covered by signature
+	PrincipalAttribute = "principal"
+	// ApiKeyAttribute authenticates principal without signature
+	ApiKeyAttribute = "api-key"
+)
+
+// Credentials identify client to server
+type Credentials struct {
+	// Principal is a name of client, it's trusted only if message is signed with key allowed to principal
+	// or carries principal's API key
+	Principal string
+	// ApiKey authenticates principal, it's sent as is, so it's readable to anyone with access to the queue
+	ApiKey string
+	// SigningKeyId is set by server to ID of key message signature was verified with
+	SigningKeyId string
+}
+
+// SetAttributes adds principal and API key to message attributes, empty ones are omitted
+func (c Credentials) SetAttributes(attributes map[string]string) {
+	if c.Principal != "" {
+		attributes[PrincipalAttribute] = c.Principal
+	}
+	if c.ApiKey != "" {
+		attributes[ApiKeyAttribute] = c.ApiKey
+	}
+}
+
+// CredentialsFromAttributes returns credentials sent in message attributes, SigningKeyId is left empty
+func CredentialsFromAttributes(attributes map[string]string) Credentials {
+	return Credentials{
+		Principal: attributes[PrincipalAttribute],
+		ApiKey:    attributes[ApiKeyAttribute],
+	}
+}
@@ -1,7 +1,8 @@
 package message
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 
 	"github.com/yosadchyi/go-client-server/pkg/util"
@@ -13,10 +14,89 @@ const AddOp = Operation("Add")
 const RemoveOp = Operation("Remove")
 const GetItemOp = Operation("Get")
 const GetAllItemsOp = Operation("GetAll")
+const ListNamespacesOp = Operation("ListNamespaces")
+const DropNamespaceOp = Operation("DropNamespace")
+const CapabilitiesOp = Operation("Capabilities")
+
+// ConflictMode defines how Add is handled when item with the same key exists
+type ConflictMode string
+
+const ConflictOverwrite = ConflictMode("overwrite")
+const ConflictSkip = ConflictMode("skip")
+const ConflictFail = ConflictMode("fail")
+
+// ParseConflictMode parses conflict mode name, one of overwrite, skip or fail
+func ParseConflictMode(name string) (ConflictMode, error) {
+	switch mode := ConflictMode(name); mode {
+	case ConflictOverwrite, ConflictSkip, ConflictFail:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown conflict mode %q", name)
+}
 
 // Base is a base for message
 type Base struct {
-	Operation Operation `json:"operation"`
+	// Version is a protocol version message is encoded with, see ProtocolVersion
+	Version       string    `json:"version,omitempty"`
+	Operation     Operation `json:"operation"`
+	Namespace     string    `json:"namespace,omitempty"`
+	CorrelationId string    `json:"correlationId,omitempty"`
+	// ReplyTo is URL of SQS queue server sends Reply with result of operation to, no reply is sent if it's empty
+	ReplyTo string `json:"replyTo,omitempty"`
+}
+
+// Message is implemented by all messages
+type Message interface {
+	util.JSONEr
+	// Meta returns fields common for all messages
+	Meta() Base
+}
+
+func newBase(operation Operation, namespace string) Base {
+	return Base{
+		Version:       ProtocolVersion,
+		Operation:     operation,
+		Namespace:     namespace,
+		CorrelationId: NewCorrelationId(),
+	}
+}
+
+// NewCorrelationId returns random identifier used to trace message across client and server
+func NewCorrelationId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+func (b Base) Meta() Base {
+	return b
+}
+
+// WithReplyTo returns copy of message with ReplyTo set to queueUrl
+func WithReplyTo(msg Message, queueUrl string) Message {
+	return withBase(msg, func(b *Base) {
+		b.ReplyTo = queueUrl
+	})
+}
+
+// WithVersion returns copy of message with protocol version set to version
+func WithVersion(msg Message, version string) Message {
+	return withBase(msg, func(b *Base) {
+		b.Version = version
+	})
+}
+
+// withBase returns copy of message with base modified by fn, message of unknown operation is returned as is
+func withBase(msg Message, fn func(b *Base)) Message {
+	spec, ok := LookupOperation(msg.Meta().Operation)
+	if !ok {
+		return msg
+	}
+	fields := spec.Encode(msg)
+	fn(&fields.Base)
+	return spec.Decode(fields)
 }
 
 // Add is a message representing addItem command
@@ -24,18 +104,22 @@ type Add struct {
 	Base
 	Key  string `json:"key"`
 	Data string `json:"data"`
+	// OnConflict defines how existing item with the same key is handled, it's overwritten if empty
+	OnConflict ConflictMode `json:"onConflict,omitempty"`
+	// DataRef is a key of blob holding value which is too large to be sent in message, Data is empty then
+	DataRef string `json:"dataRef,omitempty"`
 }
 
-// Remove is a message representing removeItem command
+// Remove is a message representing removeItem command, key is encoded as itemId in protocol version 1
 type Remove struct {
 	Base
-	Key string `json:"itemId"`
+	Key string `json:"key"`
 }
 
-// Get is a message representing getItem command
+// Get is a message representing getItem command, key is encoded as itemId in protocol version 1
 type Get struct {
 	Base
-	Key string `json:"itemId"`
+	Key string `json:"key"`
 }
 
 // GetAll is a message representing getAllItems command
@@ -43,97 +127,176 @@ type GetAll struct {
 	Base
 }
 
+// ListNamespaces is an admin message representing listNamespaces command
+type ListNamespaces struct {
+	Base
+}
+
+// DropNamespace is an admin message representing dropNamespace command, namespace is taken from Base
+type DropNamespace struct {
+	Base
+}
+
+// Capabilities is a message requesting protocol versions and operations supported by server, see Protocol
+type Capabilities struct {
+	Base
+}
+
 // Any represents any of valid messages, only one message field can be non-nil
 type Any struct {
 	Base
-	Add         *Add
-	Remove      *Remove
-	GetItem     *Get
-	GetAllItems *GetAll
+	// MessageId is an id assigned to message by SQS
+	MessageId string `json:"-"`
+	// Credentials are taken from message attributes by server
+	Credentials    Credentials `json:"-"`
+	Add            *Add
+	Remove         *Remove
+	GetItem        *Get
+	GetAllItems    *GetAll
+	ListNamespaces *ListNamespaces
+	DropNamespace  *DropNamespace
+	Capabilities   *Capabilities
+	// Custom is a message of operation registered outside of this package, see RegisterOperation
+	Custom Message
+	// Retriable is set by server for messages which are received again if they fail because of panic
+	Retriable bool `json:"-"`
 }
 
-func NewAdd(key, data string) Add {
+func NewAdd(namespace, key, data string) Add {
 	return Add{
-		Base: Base{
-			Operation: AddOp,
-		},
+		Base: newBase(AddOp, namespace),
 		Key:  key,
 		Data: data,
 	}
 }
 
-func (m Add) ToJSON() *string {
+func (m Add) ToJSON() (string, error) {
 	return util.ToJSON(m)
 }
 
-func NewRemove(key string) Remove {
+func NewRemove(namespace, key string) Remove {
 	return Remove{
-		Base: Base{
-			Operation: RemoveOp,
-		},
-		Key: key,
+		Base: newBase(RemoveOp, namespace),
+		Key:  key,
 	}
 }
 
-func (m Remove) ToJSON() *string {
+func (m Remove) ToJSON() (string, error) {
 	return util.ToJSON(m)
 }
 
-func NewGet(key string) Get {
+func NewGet(namespace, key string) Get {
 	return Get{
-		Base: Base{
-			Operation: GetItemOp,
-		},
-		Key: key,
+		Base: newBase(GetItemOp, namespace),
+		Key:  key,
 	}
 }
 
-func (m Get) ToJSON() *string {
+func (m Get) ToJSON() (string, error) {
 	return util.ToJSON(m)
 }
 
-func NewGetAll() GetAll {
+func NewGetAll(namespace string) GetAll {
 	return GetAll{
-		Base: Base{
-			Operation: GetAllItemsOp,
-		},
+		Base: newBase(GetAllItemsOp, namespace),
 	}
 }
 
-func (m GetAll) ToJSON() *string {
+func (m GetAll) ToJSON() (string, error) {
 	return util.ToJSON(m)
 }
 
-func AnyFromJSON(data string) (*Any, error) {
-	msg := Any{}
-	var err error
+func NewListNamespaces() ListNamespaces {
+	return ListNamespaces{
+		Base: newBase(ListNamespacesOp, ""),
+	}
+}
 
-	bytes := []byte(data)
-	err = json.Unmarshal(bytes, &msg.Base)
-	if err != nil {
-		return nil, err
+func (m ListNamespaces) ToJSON() (string, error) {
+	return util.ToJSON(m)
+}
+
+func NewDropNamespace(namespace string) DropNamespace {
+	return DropNamespace{
+		Base: newBase(DropNamespaceOp, namespace),
+	}
+}
+
+func (m DropNamespace) ToJSON() (string, error) {
+	return util.ToJSON(m)
+}
+
+func NewCapabilities() Capabilities {
+	return Capabilities{
+		Base: newBase(CapabilitiesOp, ""),
 	}
+}
+
+func (m Capabilities) ToJSON() (string, error) {
+	return util.ToJSON(m)
+}
 
-	switch msg.Operation {
-	case AddOp:
-		msg.Add = &Add{}
-		err = json.Unmarshal(bytes, msg.Add)
-	case RemoveOp:
-		msg.Remove = &Remove{}
-		err = json.Unmarshal(bytes, msg.Remove)
-	case GetItemOp:
-		msg.GetItem = &Get{}
-		err = json.Unmarshal(bytes, msg.GetItem)
-	case GetAllItemsOp:
-		msg.GetAllItems = &GetAll{}
-		err = json.Unmarshal(bytes, msg.GetAllItems)
+// NewAny stores message in Any
+func NewAny(msg Message) *Any {
+	m := &Any{Base: msg.Meta()}
+	switch msg := msg.(type) {
+	case Add:
+		m.Add = &msg
+	case Remove:
+		m.Remove = &msg
+	case Get:
+		m.GetItem = &msg
+	case GetAll:
+		m.GetAllItems = &msg
+	case ListNamespaces:
+		m.ListNamespaces = &msg
+	case DropNamespace:
+		m.DropNamespace = &msg
+	case Capabilities:
+		m.Capabilities = &msg
 	default:
-		err = fmt.Errorf("unrecognized operation %q", msg.Operation)
+		m.Custom = msg
 	}
+	return m
+}
 
+// Key returns key of item message refers to, or empty string for messages which don't refer to an item
+func (m *Any) Key() string {
+	msg := m.Message()
+	if msg == nil {
+		return ""
+	}
+	fields, err := fieldsOf(msg)
 	if err != nil {
-		return nil, err
+		return ""
 	}
+	return fields.Key
+}
 
-	return &msg, err
+// Message returns message stored in Any or nil if none is stored
+func (m *Any) Message() Message {
+	switch {
+	case m.Add != nil:
+		return *m.Add
+	case m.Remove != nil:
+		return *m.Remove
+	case m.GetItem != nil:
+		return *m.GetItem
+	case m.GetAllItems != nil:
+		return *m.GetAllItems
+	case m.ListNamespaces != nil:
+		return *m.ListNamespaces
+	case m.DropNamespace != nil:
+		return *m.DropNamespace
+	case m.Capabilities != nil:
+		return *m.Capabilities
+	case m.Custom != nil:
+		return m.Custom
+	}
+	return nil
+}
+
+// AnyFromJSON decodes and validates message from JSON, see JSONCodec
+func AnyFromJSON(data string) (*Any, error) {
+	return JSONCodec.Decode(data)
 }
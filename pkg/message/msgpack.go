@@ -0,0 +1,222 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// marshalMsgPack encodes wire as MessagePack map with string values, empty fields are omitted
+func marshalMsgPack(w wire) []byte {
+	fields := w.fields()
+	buf := make([]byte, 0, 256)
+
+	if n := len(fields); n < 16 {
+		buf = append(buf, 0x80|byte(n))
+	} else {
+		buf = append(buf, 0xde, byte(n>>8), byte(n))
+	}
+	for _, f := range fields {
+		buf = appendMsgPackString(buf, f.name)
+		buf = appendMsgPackString(buf, f.value)
+	}
+	return buf
+}
+
+func appendMsgPackString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n < 1<<8:
+		buf = append(buf, 0xd9, byte(n))
+	case n < 1<<16:
+		buf = append(buf, 0xda, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(buf, s...)
+}
+
+var errMsgPackTruncated = errors.New("truncated data")
+
+// unmarshalMsgPack decodes MessagePack map into wire, values of unknown keys are skipped whatever their type is
+// and keys are recorded in wire
+func unmarshalMsgPack(data []byte) (wire, error) {
+	var w wire
+	d := msgPackDecoder{data: data}
+
+	n, err := d.mapHeader()
+	if err != nil {
+		return w, err
+	}
+	for i := 0; i < n; i++ {
+		name, err := d.str()
+		if err != nil {
+			return w, err
+		}
+		if d.peek() == 0xc0 {
+			d.pos++
+			continue
+		}
+		if !isMsgPackString(d.peek()) {
+			if err := d.skip(); err != nil {
+				return w, err
+			}
+			w.unknown = append(w.unknown, name)
+			continue
+		}
+		value, err := d.str()
+		if err != nil {
+			return w, err
+		}
+		if !w.set(0, name, value) {
+			w.unknown = append(w.unknown, name)
+		}
+	}
+	if d.pos != len(data) {
+		return w, fmt.Errorf("%d trailing bytes", len(data)-d.pos)
+	}
+	return w, nil
+}
+
+type msgPackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgPackDecoder) peek() byte {
+	if d.pos >= len(d.data) {
+		return 0
+	}
+	return d.data[d.pos]
+}
+
+// next returns next n bytes
+func (d *msgPackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errMsgPackTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads big endian unsigned integer of given size
+func (d *msgPackDecoder) uint(size int) (int, error) {
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (d *msgPackDecoder) mapHeader() (int, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b[0]&0xf0 == 0x80:
+		return int(b[0] & 0x0f), nil
+	case b[0] == 0xde:
+		return d.uint(2)
+	case b[0] == 0xdf:
+		return d.uint(4)
+	}
+	return 0, fmt.Errorf("map expected, got type 0x%02x", b[0])
+}
+
+func isMsgPackString(b byte) bool {
+	return b&0xe0 == 0xa0 || b == 0xd9 || b == 0xda || b == 0xdb
+}
+
+func (d *msgPackDecoder) str() (string, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case b[0]&0xe0 == 0xa0:
+		n = int(b[0] & 0x1f)
+	case b[0] == 0xd9:
+		n, err = d.uint(1)
+	case b[0] == 0xda:
+		n, err = d.uint(2)
+	case b[0] == 0xdb:
+		n, err = d.uint(4)
+	default:
+		return "", fmt.Errorf("string expected, got type 0x%02x", b[0])
+	}
+	if err != nil {
+		return "", err
+	}
+	s, err := d.next(n)
+	return string(s), err
+}
+
+// skip skips value of any type
+func (d *msgPackDecoder) skip() error {
+	b, err := d.next(1)
+	if err != nil {
+		return err
+	}
+	t := b[0]
+
+	var size, elements int
+	switch {
+	case t <= 0x7f || t >= 0xe0 || t == 0xc0 || t == 0xc2 || t == 0xc3:
+		return nil
+	case t&0xe0 == 0xa0:
+		size = int(t & 0x1f)
+	case t&0xf0 == 0x90:
+		elements = int(t & 0x0f)
+	case t&0xf0 == 0x80:
+		elements = 2 * int(t&0x0f)
+	case t == 0xcc || t == 0xd0:
+		size = 1
+	case t == 0xcd || t == 0xd1:
+		size = 2
+	case t == 0xca || t == 0xce || t == 0xd2:
+		size = 4
+	case t == 0xcb || t == 0xcf || t == 0xd3:
+		size = 8
+	case t == 0xc4 || t == 0xd9:
+		size, err = d.uint(1)
+	case t == 0xc5 || t == 0xda:
+		size, err = d.uint(2)
+	case t == 0xc6 || t == 0xdb:
+		size, err = d.uint(4)
+	case t == 0xdc:
+		elements, err = d.uint(2)
+	case t == 0xdd:
+		elements, err = d.uint(4)
+	case t == 0xde:
+		elements, err = d.uint(2)
+		elements *= 2
+	case t == 0xdf:
+		elements, err = d.uint(4)
+		elements *= 2
+	default:
+		return fmt.Errorf("unsupported type 0x%02x", t)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := d.next(size); err != nil {
+		return err
+	}
+	for i := 0; i < elements; i++ {
+		if err := d.skip(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package message
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Protobuf wire types
+const (
+	protobufVarint  = 0
+	protobufFixed64 = 1
+	protobufBytes   = 2
+	protobufFixed32 = 5
+)
+
+// marshalProtobuf encodes wire as protobuf Message defined in message.proto
+func marshalProtobuf(w wire) []byte {
+	buf := make([]byte, 0, 256)
+	for _, f := range w.fields() {
+		buf = appendUvarint(buf, uint64(f.number<<3|protobufBytes))
+		buf = appendUvarint(buf, uint64(len(f.value)))
+		buf = append(buf, f.value...)
+	}
+	return buf
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+var errProtobufTruncated = errors.New("truncated data")
+
+// unmarshalProtobuf decodes protobuf Message defined in message.proto, unknown fields are skipped and recorded in wire
+func unmarshalProtobuf(data []byte) (wire, error) {
+	var w wire
+	for pos := 0; pos < len(data); {
+		tag, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return w, errProtobufTruncated
+		}
+		pos += n
+		number, wireType := int(tag>>3), int(tag&7)
+		if wireType != protobufBytes {
+			w.unknown = append(w.unknown, strconv.Itoa(number))
+		}
+
+		switch wireType {
+		case protobufVarint:
+			if _, n = binary.Uvarint(data[pos:]); n <= 0 {
+				return w, errProtobufTruncated
+			}
+			pos += n
+		case protobufFixed64:
+			pos += 8
+		case protobufFixed32:
+			pos += 4
+		case protobufBytes:
+			length, n := binary.Uvarint(data[pos:])
+			if n <= 0 || length > uint64(len(data)-pos-n) {
+				return w, errProtobufTruncated
+			}
+			pos += n
+			if !w.set(number, "", string(data[pos:pos+int(length)])) {
+				w.unknown = append(w.unknown, strconv.Itoa(number))
+			}
+			pos += int(length)
+		default:
+			return w, fmt.Errorf("unsupported wire type %d of field %d", wireType, number)
+		}
+		if pos > len(data) {
+			return w, errProtobufTruncated
+		}
+	}
+	return w, nil
+}
@@ -0,0 +1,191 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
+
+// Fields are fields of message as carried by codecs, every operation maps them to its message and back;
+// custom operations may use Key and Data, and carry fields of their own as JSON in Payload
+type Fields struct {
+	Base
+	Key        string       `json:"key,omitempty"`
+	Data       string       `json:"data,omitempty"`
+	OnConflict ConflictMode `json:"onConflict,omitempty"`
+	DataRef    string       `json:"dataRef,omitempty"`
+	// Payload is JSON value which isn't interpreted by codecs, built-in operations don't use it
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// OperationSpec describes how messages of operation are decoded, encoded and validated
+type OperationSpec struct {
+	Operation Operation
+	// Decode creates message from fields decoded by codec
+	Decode func(f Fields) Message
+	// Encode returns fields of message, it's called only for messages of the operation
+	Encode func(msg Message) Fields
+	// Validate checks fields specific to operation, if set; operation, version and namespace are checked for all messages
+	Validate func(msg Message) error
+	// MinVersion is the oldest protocol version supporting operation, all versions support it if empty
+	MinVersion string
+}
+
+var operationRegistry = struct {
+	lock  sync.RWMutex
+	specs map[Operation]OperationSpec
+	// order keeps operations in order of registration, so they are listed by Operations in stable order
+	order []Operation
+}{specs: make(map[Operation]OperationSpec)}
+
+// RegisterOperation makes operation known to codecs and validation, projects embedding server and client may
+// register operations of their own; it panics if operation is registered twice or spec is incomplete
+func RegisterOperation(spec OperationSpec) {
+	if spec.Operation == "" || spec.Decode == nil || spec.Encode == nil {
+		panic("message: operation, Decode and Encode are required")
+	}
+	operationRegistry.lock.Lock()
+	defer operationRegistry.lock.Unlock()
+
+	if _, exists := operationRegistry.specs[spec.Operation]; exists {
+		panic(fmt.Sprintf("message: operation %s is registered twice", spec.Operation))
+	}
+	operationRegistry.specs[spec.Operation] = spec
+	operationRegistry.order = append(operationRegistry.order, spec.Operation)
+}
+
+// LookupOperation returns spec of registered operation
+func LookupOperation(operation Operation) (OperationSpec, bool) {
+	operationRegistry.lock.RLock()
+	defer operationRegistry.lock.RUnlock()
+
+	spec, ok := operationRegistry.specs[operation]
+	return spec, ok
+}
+
+// registeredOperations returns specs of all operations in order of registration
+func registeredOperations() []OperationSpec {
+	operationRegistry.lock.RLock()
+	defer operationRegistry.lock.RUnlock()
+
+	specs := make([]OperationSpec, 0, len(operationRegistry.order))
+	for _, operation := range operationRegistry.order {
+		specs = append(specs, operationRegistry.specs[operation])
+	}
+	return specs
+}
+
+// fieldsOf returns fields of message of registered operation
+func fieldsOf(msg Message) (Fields, error) {
+	operation := msg.Meta().Operation
+	spec, ok := LookupOperation(operation)
+	if !ok {
+		return Fields{}, invalid(CodeUnknownOperation, "operation", "unrecognized operation %q", operation)
+	}
+	return spec.Encode(msg), nil
+}
+
+func init() {
+	RegisterOperation(OperationSpec{
+		Operation: AddOp,
+		Decode: func(f Fields) Message {
+			return Add{Base: f.Base, Key: f.Key, Data: f.Data, OnConflict: f.OnConflict, DataRef: f.DataRef}
+		},
+		Encode: func(msg Message) Fields {
+			m := msg.(Add)
+			return Fields{Base: m.Base, Key: m.Key, Data: m.Data, OnConflict: m.OnConflict, DataRef: m.DataRef}
+		},
+		Validate: validateAdd,
+	})
+	RegisterOperation(OperationSpec{
+		Operation: RemoveOp,
+		Decode: func(f Fields) Message {
+			return Remove{Base: f.Base, Key: f.Key}
+		},
+		Encode: func(msg Message) Fields {
+			m := msg.(Remove)
+			return Fields{Base: m.Base, Key: m.Key}
+		},
+		Validate: func(msg Message) error {
+			return validateKey(msg.(Remove).Key)
+		},
+	})
+	RegisterOperation(OperationSpec{
+		Operation: GetItemOp,
+		Decode: func(f Fields) Message {
+			return Get{Base: f.Base, Key: f.Key}
+		},
+		Encode: func(msg Message) Fields {
+			m := msg.(Get)
+			return Fields{Base: m.Base, Key: m.Key}
+		},
+		Validate: func(msg Message) error {
+			return validateKey(msg.(Get).Key)
+		},
+	})
+	RegisterOperation(OperationSpec{
+		Operation: GetAllItemsOp,
+		Decode: func(f Fields) Message {
+			return GetAll{Base: f.Base}
+		},
+		Encode: func(msg Message) Fields {
+			return Fields{Base: msg.Meta()}
+		},
+	})
+	RegisterOperation(OperationSpec{
+		Operation: ListNamespacesOp,
+		Decode: func(f Fields) Message {
+			return ListNamespaces{Base: f.Base}
+		},
+		Encode: func(msg Message) Fields {
+			return Fields{Base: msg.Meta()}
+		},
+	})
+	RegisterOperation(OperationSpec{
+		Operation: DropNamespaceOp,
+		Decode: func(f Fields) Message {
+			return DropNamespace{Base: f.Base}
+		},
+		Encode: func(msg Message) Fields {
+			return Fields{Base: msg.Meta()}
+		},
+	})
+	RegisterOperation(OperationSpec{
+		Operation: CapabilitiesOp,
+		Decode: func(f Fields) Message {
+			return Capabilities{Base: f.Base}
+		},
+		Encode: func(msg Message) Fields {
+			return Fields{Base: msg.Meta()}
+		},
+		MinVersion: Version2,
+	})
+}
+
+func validateAdd(msg Message) error {
+	m := msg.(Add)
+	if err := validateKey(m.Key); err != nil {
+		return err
+	}
+	if m.DataRef != "" {
+		if m.Data != "" {
+			return invalid(CodeInvalidValue, "dataRef", "either data or dataRef can be set")
+		}
+		if err := validateDataRef(m.DataRef); err != nil {
+			return err
+		}
+	}
+	if len(m.Data) > MaxValueLength {
+		return invalid(CodeTooLong, "data", "value is %d bytes long, at most %d bytes are allowed", len(m.Data), MaxValueLength)
+	}
+	if !utf8.ValidString(m.Data) {
+		return invalid(CodeInvalidCharacters, "data", "value isn't valid UTF-8")
+	}
+	if m.OnConflict != "" {
+		if _, err := ParseConflictMode(string(m.OnConflict)); err != nil {
+			return invalid(CodeInvalidValue, "onConflict", "%v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package message_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/util"
+)
+
+const touchOp = message.Operation("Touch")
+
+// touch is a custom operation carrying key, a reason in data field and its own fields in payload;
+// Details are nil if payload can't be parsed
+type touch struct {
+	message.Base
+	Key     string        `json:"key"`
+	Reason  string        `json:"data,omitempty"`
+	Details *touchDetails `json:"payload,omitempty"`
+}
+
+type touchDetails struct {
+	TTL  int      `json:"ttl"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (m touch) ToJSON() (string, error) {
+	return util.ToJSON(m)
+}
+
+func init() {
+	message.RegisterOperation(message.OperationSpec{
+		Operation: touchOp,
+		Decode: func(f message.Fields) message.Message {
+			m := touch{Base: f.Base, Key: f.Key, Reason: f.Data}
+			var details touchDetails
+			if err := json.Unmarshal(f.Payload, &details); err == nil {
+				m.Details = &details
+			}
+			return m
+		},
+		Encode: func(msg message.Message) message.Fields {
+			m := msg.(touch)
+			payload, _ := json.Marshal(m.Details)
+			return message.Fields{Base: m.Base, Key: m.Key, Data: m.Reason, Payload: payload}
+		},
+		Validate: func(msg message.Message) error {
+			m := msg.(touch)
+			if m.Key == "" {
+				return &message.ValidationError{Code: message.CodeRequired, Field: "key", Reason: "key is required"}
+			}
+			if m.Details == nil {
+				return &message.ValidationError{Code: message.CodeInvalidValue, Field: "payload", Reason: "ttl expected"}
+			}
+			return nil
+		},
+		MinVersion: message.Version21,
+	})
+}
+
+func TestRegisterOperation(t *testing.T) {
+	msg := touch{
+		Base:    message.Base{Version: message.ProtocolVersion, Operation: touchOp, Namespace: "teamA"},
+		Key:     "1",
+		Reason:  "audit",
+		Details: &touchDetails{TTL: 60, Tags: []string{"a", "b"}},
+	}
+
+	for _, codec := range codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			body, err := codec.Encode(msg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			decoded, err := codec.Decode(body)
+			if assert.NoError(t, err) {
+				assert.Equal(t, msg, decoded.Custom)
+				assert.Equal(t, "1", decoded.Key())
+			}
+		})
+	}
+
+	invalid := msg
+	invalid.Key = ""
+	assert.Equal(t, message.CodeRequired, message.CodeOf(message.Validate(invalid)))
+	_, err := message.JSONCodec.Decode(`{"version":"2.1","operation":"Touch","key":"1","payload":"60"}`)
+	assert.Equal(t, message.CodeInvalidValue, message.CodeOf(err))
+
+	withReply := message.WithReplyTo(msg, "http://localhost/replies")
+	assert.Equal(t, "http://localhost/replies", withReply.Meta().ReplyTo)
+
+	assert.Contains(t, message.Operations(message.Version21), touchOp)
+	assert.NotContains(t, message.Operations(message.Version2), touchOp)
+	// operation can't be registered twice
+	spec, ok := message.LookupOperation(message.AddOp)
+	if assert.True(t, ok) {
+		assert.Panics(t, func() {
+			message.RegisterOperation(spec)
+		})
+	}
+}
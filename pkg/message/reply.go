@@ -0,0 +1,56 @@
+package message
+
+import (
+	"encoding/json"
+
+	"github.com/yosadchyi/go-client-server/pkg/util"
+)
+
+// Status is a result of operation reported in Reply
+type Status string
+
+const StatusOk = Status("ok")
+const StatusError = Status("error")
+const StatusSkipped = Status("skipped")
+
+// Item is an item returned in Reply
+type Item struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Ref is a key of blob holding value which is too large to be sent in reply, Value is empty then
+	Ref string `json:"ref,omitempty"`
+}
+
+// Reply is sent by server to queue given in Base.ReplyTo once operation is processed
+type Reply struct {
+	CorrelationId string    `json:"correlationId"`
+	Operation     Operation `json:"operation"`
+	Namespace     string    `json:"namespace,omitempty"`
+	Key           string    `json:"key,omitempty"`
+	Status        Status    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	// Code identifies kind of error if message was invalid
+	Code ErrorCode `json:"code,omitempty"`
+	// Value is a value of item returned by Get
+	Value *string `json:"value,omitempty"`
+	// ValueRef is a key of blob holding value returned by Get, if it's too large to be sent in reply
+	ValueRef string `json:"valueRef,omitempty"`
+	// Items are items returned by GetAll
+	Items []Item `json:"items,omitempty"`
+	// Namespaces are names returned by ListNamespaces
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Protocol is a protocol supported by server returned by Capabilities
+	Protocol *Protocol `json:"protocol,omitempty"`
+}
+
+func (r Reply) ToJSON() (string, error) {
+	return util.ToJSON(r)
+}
+
+func ReplyFromJSON(data string) (*Reply, error) {
+	reply := Reply{}
+	if err := json.Unmarshal([]byte(data), &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
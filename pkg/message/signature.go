@@ -0,0 +1,225 @@
+package message
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attributes of signed SQS messages
+const (
+	// SignatureAttribute carries base64 encoded HMAC-SHA256 of body and signed attributes
+	SignatureAttribute = "signature"
+	// SignatureKeyIdAttribute identifies key message is signed with
+	SignatureKeyIdAttribute = "signature-key-id"
+	// SignatureTimestampAttribute is a time message was signed at in RFC 3339 format
+	SignatureTimestampAttribute = "signature-timestamp"
+)
+
+// signedAttributes are attributes covered by signature along with body, absent attributes are signed as empty
+var signedAttributes = []string{
+	ContentTypeAttribute, ContentEncodingAttribute, PrincipalAttribute, SignatureKeyIdAttribute, SignatureTimestampAttribute,
+}
+
+// MinSigningKeyLength is a minimal length of signing key in bytes
+const MinSigningKeyLength = 16
+
+// SigningKeys maps key ID to secret key
+type SigningKeys map[string][]byte
+
+// LoadSigningKeys reads keys from file, see ParseSigningKeys for format
+func LoadSigningKeys(path string) (SigningKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseSigningKeys(f)
+}
+
+// ParseSigningKeys parses keys, one per line as ID=SECRET, where SECRET is base64 encoded;
+// empty lines and lines starting with # are ignored
+func ParseSigningKeys(r io.Reader) (SigningKeys, error) {
+	keys := SigningKeys{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, secret, ok := strings.Cut(line, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("line %d: ID=SECRET expected", n)
+		}
+		if _, exists := keys[id]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key ID %q", n, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secret))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid secret of key %q: %w", n, id, err)
+		}
+		if len(key) < MinSigningKeyLength {
+			return nil, fmt.Errorf("line %d: key %q is %d bytes long, at least %d bytes are required", n, id, len(key), MinSigningKeyLength)
+		}
+		keys[id] = key
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found")
+	}
+	return keys, nil
+}
+
+// IDs returns sorted key IDs
+func (k SigningKeys) IDs() []string {
+	ids := make([]string, 0, len(k))
+	for id := range k {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Signer signs messages with a single key
+type Signer struct {
+	keyId string
+	key   []byte
+}
+
+// NewSigner creates signer using key with given ID from keys; ID may be empty if there is the only key
+func NewSigner(keys SigningKeys, keyId string) (*Signer, error) {
+	if keyId == "" {
+		if len(keys) != 1 {
+			return nil, fmt.Errorf("key ID is required, one of %s", strings.Join(keys.IDs(), ", "))
+		}
+		keyId = keys.IDs()[0]
+	}
+	key, ok := keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", keyId)
+	}
+	return &Signer{keyId: keyId, key: key}, nil
+}
+
+// Sign adds signature, key ID and timestamp to attributes of message with given body,
+// attributes covered by signature must be set before
+func (s *Signer) Sign(attributes map[string]string, body string, now time.Time) {
+	attributes[SignatureKeyIdAttribute] = s.keyId
+	attributes[SignatureTimestampAttribute] = now.UTC().Format(time.RFC3339)
+	attributes[SignatureAttribute] = signature(s.key, attributes, body)
+}
+
+// Verifier checks signatures of messages signed with any of active keys, so keys can be rotated by adding
+// new key to all servers, switching clients to it and removing old key afterwards
+type Verifier struct {
+	keys SigningKeys
+	// maxAge is a maximal difference between message timestamp and current time, 0 disables the check
+	maxAge time.Duration
+
+	lock sync.Mutex
+	// seen are signatures of messages received within maxAge, mapped to SQS message IDs, so copy of message
+	// sent again is rejected while redelivery of the same SQS message is not
+	seen      map[string]seenSignature
+	nextPrune time.Time
+}
+
+type seenSignature struct {
+	messageId string
+	expires   time.Time
+}
+
+// NewVerifier creates verifier of messages signed with any of keys and not older than maxAge
+func NewVerifier(keys SigningKeys, maxAge time.Duration) *Verifier {
+	return &Verifier{
+		keys:   keys,
+		maxAge: maxAge,
+		seen:   make(map[string]seenSignature),
+	}
+}
+
+// Verify checks signature and timestamp of SQS message with given ID, attributes and body as received,
+// it returns *ValidationError if message is unsigned, signed with unknown key, modified, expired or replayed
+func (v *Verifier) Verify(messageId string, attributes map[string]string, body string, now time.Time) error {
+	sig, ok := attributes[SignatureAttribute]
+	if !ok {
+		return invalid(CodeInvalidSignature, SignatureAttribute, "message isn't signed")
+	}
+	keyId := attributes[SignatureKeyIdAttribute]
+	key, ok := v.keys[keyId]
+	if !ok {
+		return invalid(CodeInvalidSignature, SignatureKeyIdAttribute, "unknown key ID %q", keyId)
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(key, attributes, body))) {
+		return invalid(CodeInvalidSignature, SignatureAttribute, "signature doesn't match message")
+	}
+
+	if v.maxAge <= 0 {
+		return nil
+	}
+	timestamp, err := time.Parse(time.RFC3339, attributes[SignatureTimestampAttribute])
+	if err != nil {
+		return invalid(CodeInvalidValue, SignatureTimestampAttribute, "invalid timestamp: %v", err)
+	}
+	if age := now.Sub(timestamp); age > v.maxAge || age < -v.maxAge {
+		return invalid(CodeExpired, SignatureTimestampAttribute, "message signed at %s is outside of %s window", attributes[SignatureTimestampAttribute], v.maxAge)
+	}
+	return v.checkReplay(messageId, sig, timestamp.Add(v.maxAge), now)
+}
+
+// Expires returns time after which signed message with given attributes is rejected as expired, it reports false
+// if timestamps aren't checked or message has no valid timestamp
+func (v *Verifier) Expires(attributes map[string]string) (time.Time, bool) {
+	if v.maxAge <= 0 {
+		return time.Time{}, false
+	}
+	timestamp, err := time.Parse(time.RFC3339, attributes[SignatureTimestampAttribute])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return timestamp.Add(v.maxAge), true
+}
+
+// checkReplay remembers signature till it expires and rejects other SQS messages with the same signature
+func (v *Verifier) checkReplay(messageId string, sig string, expires time.Time, now time.Time) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if now.After(v.nextPrune) {
+		for s, seen := range v.seen {
+			if now.After(seen.expires) {
+				delete(v.seen, s)
+			}
+		}
+		v.nextPrune = now.Add(time.Minute)
+	}
+
+	if seen, ok := v.seen[sig]; ok && seen.messageId != messageId {
+		return invalid(CodeReplayed, SignatureAttribute, "message with the same signature was received as %s", seen.messageId)
+	}
+	v.seen[sig] = seenSignature{messageId: messageId, expires: expires}
+	return nil
+}
+
+// signature computes HMAC-SHA256 of signed attributes and body, attribute values are prefixed with length,
+// so they can't be shifted into each other or body
+func signature(key []byte, attributes map[string]string, body string) string {
+	mac := hmac.New(sha256.New, key)
+	for _, name := range signedAttributes {
+		value := attributes[name]
+		fmt.Fprintf(mac, "%s:%d:%s\n", name, len(value), value)
+	}
+	io.WriteString(mac, body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,116 @@
+package message_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+const testSigningKeys = `
+# rotated on 2026-10-01
+old=b2xkIHNlY3JldCBvZiAzMiBieXRlcyBsZW5ndGgh
+new = bmV3IHNlY3JldCBvZiAzMiBieXRlcyBsZW5ndGgh
+`
+
+func TestParseSigningKeys(t *testing.T) {
+	keys, err := message.ParseSigningKeys(strings.NewReader(testSigningKeys))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"new", "old"}, keys.IDs())
+		assert.Equal(t, "new secret of 32 bytes length!", string(keys["new"]))
+	}
+
+	cases := map[string]string{
+		"empty":          "# no keys\n",
+		"no separator":   "old\n",
+		"no ID":          "=b2xkIHNlY3JldCBvZiAzMiBieXRlcyBsZW5ndGgh\n",
+		"invalid base64": "old=!\n",
+		"short key":      "old=c2hvcnQ=\n",
+		"duplicate ID":   testSigningKeys + "old=b2xkIHNlY3JldCBvZiAzMiBieXRlcyBsZW5ndGgh\n",
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := message.ParseSigningKeys(strings.NewReader(input))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err = message.NewSigner(keys, "")
+	assert.Error(t, err, "key ID is required for multiple keys")
+	_, err = message.NewSigner(keys, "other")
+	assert.Error(t, err)
+}
+
+func TestVerifier(t *testing.T) {
+	keys, _ := message.ParseSigningKeys(strings.NewReader(testSigningKeys))
+	now := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	body := `{"operation":"Remove","key":"1"}`
+
+	sign := func(keyId string, at time.Time) map[string]string {
+		signer, err := message.NewSigner(keys, keyId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		attributes := map[string]string{message.ContentTypeAttribute: message.JSONContentType}
+		signer.Sign(attributes, body, at)
+		return attributes
+	}
+	with := func(attributes map[string]string, name, value string) map[string]string {
+		result := map[string]string{name: value}
+		for k, v := range attributes {
+			if k != name {
+				result[k] = v
+			}
+		}
+		return result
+	}
+	without := func(attributes map[string]string, name string) map[string]string {
+		result := with(attributes, name, "")
+		delete(result, name)
+		return result
+	}
+
+	signed := sign("new", now)
+	// cases depend on signatures seen before, so they are run in order
+	cases := []struct {
+		name       string
+		messageId  string
+		attributes map[string]string
+		body       string
+		code       message.ErrorCode
+	}{
+		{name: "new key", messageId: "1", attributes: signed, body: body},
+		{name: "redelivery", messageId: "1", attributes: signed, body: body},
+		{name: "old key", messageId: "2", attributes: sign("old", now), body: body},
+		{name: "clock skew", messageId: "3", attributes: sign("new", now.Add(4*time.Minute)), body: body},
+		{name: "replayed", messageId: "4", attributes: signed, body: body, code: message.CodeReplayed},
+		{name: "missing signature", messageId: "5", attributes: without(signed, message.SignatureAttribute), body: body, code: message.CodeInvalidSignature},
+		{name: "unknown key", messageId: "6", attributes: with(signed, message.SignatureKeyIdAttribute, "other"), body: body, code: message.CodeInvalidSignature},
+		{name: "wrong key", messageId: "7", attributes: with(signed, message.SignatureKeyIdAttribute, "old"), body: body, code: message.CodeInvalidSignature},
+		{name: "modified body", messageId: "8", attributes: signed, body: `{"operation":"Remove","key":"2"}`, code: message.CodeInvalidSignature},
+		{name: "modified attribute", messageId: "9", attributes: with(signed, message.ContentEncodingAttribute, message.GzipEncoding), body: body, code: message.CodeInvalidSignature},
+		{name: "modified timestamp", messageId: "10", attributes: with(signed, message.SignatureTimestampAttribute, now.Add(time.Second).Format(time.RFC3339)), body: body, code: message.CodeInvalidSignature},
+		{name: "expired", messageId: "11", attributes: sign("new", now.Add(-6*time.Minute)), body: body, code: message.CodeExpired},
+		{name: "signed in the future", messageId: "12", attributes: sign("new", now.Add(6*time.Minute)), body: body, code: message.CodeExpired},
+	}
+
+	verifier := message.NewVerifier(keys, 5*time.Minute)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := verifier.Verify(c.messageId, c.attributes, c.body, now)
+			assert.Equal(t, c.code, message.CodeOf(err), "%v", err)
+		})
+	}
+
+	// timestamp isn't checked without max age
+	assert.NoError(t, message.NewVerifier(keys, 0).Verify("11", sign("new", now.Add(-time.Hour)), body, now))
+
+	expires, ok := verifier.Expires(signed)
+	if assert.True(t, ok) {
+		assert.Equal(t, now.Add(5*time.Minute), expires)
+	}
+	_, ok = message.NewVerifier(keys, 0).Expires(signed)
+	assert.False(t, ok)
+}
@@ -0,0 +1,176 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits of message fields, lengths are in bytes
+const (
+	// MaxMessageSize is a maximal size of SQS message including attributes
+	MaxMessageSize = 256 * 1024
+	// MaxBodySize is a maximal size of encoded message body, the rest of MaxMessageSize is left for attributes
+	MaxBodySize = MaxMessageSize - 8*1024
+	// MaxValueLength leaves room for base64 encoding of binary codecs and escaping of JSON
+	MaxValueLength     = 128 * 1024
+	MaxKeyLength       = 1024
+	MaxNamespaceLength = 128
+	MaxDataRefLength   = 256
+)
+
+// ErrorCode identifies kind of invalid message, it's shown by client and sent by server in replies and
+// dead-letter queue attributes
+type ErrorCode string
+
+const (
+	CodeMalformed          = ErrorCode("malformed")
+	CodeUnsupportedVersion = ErrorCode("unsupported_version")
+	CodeUnknownOperation   = ErrorCode("unknown_operation")
+	CodeUnknownField       = ErrorCode("unknown_field")
+	CodeRequired           = ErrorCode("required")
+	CodeTooLong            = ErrorCode("too_long")
+	CodeTooLarge           = ErrorCode("too_large")
+	CodeInvalidCharacters  = ErrorCode("invalid_characters")
+	CodeInvalidValue       = ErrorCode("invalid_value")
+	CodeInvalidSignature   = ErrorCode("invalid_signature")
+	CodeExpired            = ErrorCode("expired")
+	CodeReplayed           = ErrorCode("replayed")
+	CodeUnauthenticated    = ErrorCode("unauthenticated")
+	CodeForbidden          = ErrorCode("forbidden")
+	CodeRateLimited        = ErrorCode("rate_limited")
+	CodeQuotaExceeded      = ErrorCode("quota_exceeded")
+	// CodeInternal is a code of messages which caused server failure
+	CodeInternal = ErrorCode("internal")
+)
+
+// ValidationError describes why message is invalid
+type ValidationError struct {
+	Code ErrorCode
+	// Field is a name of invalid field, empty if error refers to the whole message
+	Field  string
+	Reason string
+	// Err is an underlying error, if any
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s [%s]", e.Reason, e.Code)
+	}
+	return fmt.Sprintf("%s: %s [%s]", e.Field, e.Reason, e.Code)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// CodeOf returns error code of validation error, CodeMalformed for other errors and empty code for nil
+func CodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return CodeMalformed
+}
+
+func invalid(code ErrorCode, field string, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Code: code, Field: field, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks that message has required fields, fields are within limits and contain allowed characters
+func Validate(msg Message) error {
+	meta := msg.Meta()
+	if meta.Operation == "" {
+		return invalid(CodeRequired, "operation", "operation is required")
+	}
+	if err := CheckVersion(meta.Version); err != nil {
+		return err
+	}
+	if err := validateNamespace(meta.Namespace); err != nil {
+		return err
+	}
+
+	spec, ok := LookupOperation(meta.Operation)
+	if !ok {
+		return invalid(CodeUnknownOperation, "operation", "unrecognized operation %q", meta.Operation)
+	}
+	if spec.Validate != nil {
+		return spec.Validate(msg)
+	}
+	return nil
+}
+
+// Validate checks message, see Validate
+func (m *Any) Validate() error {
+	msg := m.Message()
+	if msg == nil {
+		return invalid(CodeUnknownOperation, "operation", "unrecognized operation %q", m.Operation)
+	}
+	return Validate(msg)
+}
+
+// validateKey checks that key isn't empty and consists of printable characters other than spaces
+func validateKey(key string) error {
+	if key == "" {
+		return invalid(CodeRequired, "key", "key is required")
+	}
+	if len(key) > MaxKeyLength {
+		return invalid(CodeTooLong, "key", "key is %d bytes long, at most %d bytes are allowed", len(key), MaxKeyLength)
+	}
+	if !utf8.ValidString(key) {
+		return invalid(CodeInvalidCharacters, "key", "key isn't valid UTF-8")
+	}
+	for _, r := range key {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return invalid(CodeInvalidCharacters, "key", "key contains %q, only printable characters other than spaces are allowed", r)
+		}
+	}
+	return nil
+}
+
+// validateDataRef checks that blob key is a relative path of letters, digits, '.', '_' and '-' separated by '/'
+func validateDataRef(ref string) error {
+	if len(ref) > MaxDataRefLength {
+		return invalid(CodeTooLong, "dataRef", "dataRef is %d bytes long, at most %d bytes are allowed", len(ref), MaxDataRefLength)
+	}
+	for _, segment := range strings.Split(ref, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return invalid(CodeInvalidValue, "dataRef", "dataRef %q isn't a relative path", ref)
+		}
+		if i := strings.IndexFunc(segment, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-')
+		}); i >= 0 {
+			r, _ := utf8.DecodeRuneInString(segment[i:])
+			return invalid(CodeInvalidCharacters, "dataRef", "dataRef contains %q, only letters, digits, '.', '_', '-' and '/' are allowed", r)
+		}
+	}
+	return nil
+}
+
+// validateNamespace checks that namespace consists of letters, digits, '-', '_' and '.', empty namespace is default one
+func validateNamespace(namespace string) error {
+	if len(namespace) > MaxNamespaceLength {
+		return invalid(CodeTooLong, "namespace", "namespace is %d bytes long, at most %d bytes are allowed", len(namespace), MaxNamespaceLength)
+	}
+	if i := strings.IndexFunc(namespace, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.'
+	}); i >= 0 {
+		r, _ := utf8.DecodeRuneInString(namespace[i:])
+		return invalid(CodeInvalidCharacters, "namespace", "namespace contains %q, only letters, digits, '-', '_' and '.' are allowed", r)
+	}
+	return nil
+}
+
+// checkBodySize checks that encoded message fits SQS message
+func checkBodySize(body string) error {
+	if len(body) > MaxBodySize {
+		return invalid(CodeTooLarge, "", "encoded message is %d bytes long, at most %d bytes are allowed", len(body), MaxBodySize)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package message_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+func TestValidate(t *testing.T) {
+	withConflict := message.NewAdd("teamA", "1", "A")
+	withConflict.OnConflict = "replace"
+
+	tests := map[string]struct {
+		msg   message.Message
+		code  message.ErrorCode
+		field string
+	}{
+		"valid add":              {msg: message.NewAdd("teamA", "user:1/a@b", "A")},
+		"empty value":            {msg: message.NewAdd("", "1", "")},
+		"longest value":          {msg: message.NewAdd("", "1", strings.Repeat("a", message.MaxValueLength))},
+		"unicode key":            {msg: message.NewGet("team-ü.1", "ключ")},
+		"no key":                 {msg: message.NewAdd("teamA", "", "A"), code: message.CodeRequired, field: "key"},
+		"no key in get":          {msg: message.NewGet("teamA", ""), code: message.CodeRequired, field: "key"},
+		"long key":               {msg: message.NewRemove("", strings.Repeat("k", message.MaxKeyLength+1)), code: message.CodeTooLong, field: "key"},
+		"key with space":         {msg: message.NewGet("", "a b"), code: message.CodeInvalidCharacters, field: "key"},
+		"key with control":       {msg: message.NewGet("", "a\x00"), code: message.CodeInvalidCharacters, field: "key"},
+		"long value":             {msg: message.NewAdd("", "1", strings.Repeat("a", message.MaxValueLength+1)), code: message.CodeTooLong, field: "data"},
+		"invalid UTF-8 value":    {msg: message.NewAdd("", "1", "\xff"), code: message.CodeInvalidCharacters, field: "data"},
+		"unknown conflict mode":  {msg: withConflict, code: message.CodeInvalidValue, field: "onConflict"},
+		"namespace with slash":   {msg: message.NewGetAll("team/A"), code: message.CodeInvalidCharacters, field: "namespace"},
+		"long namespace":         {msg: message.NewDropNamespace(strings.Repeat("n", message.MaxNamespaceLength+1)), code: message.CodeTooLong, field: "namespace"},
+		"unsupported version":    {msg: message.WithVersion(message.NewGetAll(""), "3.0"), code: message.CodeUnsupportedVersion, field: "version"},
+		"invalid version":        {msg: message.WithVersion(message.NewGetAll(""), "two"), code: message.CodeInvalidValue, field: "version"},
+		"no operation":           {msg: message.GetAll{}, code: message.CodeRequired, field: "operation"},
+		"capabilities are valid": {msg: message.NewCapabilities()},
+		"data ref":               {msg: withDataRef("", "values/0af3.bin")},
+		"data ref and data":      {msg: withDataRef("A", "values/1"), code: message.CodeInvalidValue, field: "dataRef"},
+		"data ref to parent":     {msg: withDataRef("", "values/../etc"), code: message.CodeInvalidValue, field: "dataRef"},
+		"absolute data ref":      {msg: withDataRef("", "/etc"), code: message.CodeInvalidValue, field: "dataRef"},
+		"data ref with space":    {msg: withDataRef("", "values/a b"), code: message.CodeInvalidCharacters, field: "dataRef"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := message.Validate(tt.msg)
+			if tt.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *message.ValidationError
+			if assert.True(t, errors.As(err, &validationErr), "validation error expected, got %v", err) {
+				assert.Equal(t, tt.code, validationErr.Code)
+				assert.Equal(t, tt.field, validationErr.Field)
+				assert.Contains(t, err.Error(), "["+string(tt.code)+"]")
+			}
+		})
+	}
+}
+
+func withDataRef(data, ref string) message.Add {
+	add := message.NewAdd("", "1", data)
+	add.DataRef = ref
+	return add
+}
+
+func TestDecode_Validation(t *testing.T) {
+	tests := map[string]struct {
+		body string
+		code message.ErrorCode
+	}{
+		"empty key":          {body: `{"operation":"Add","key":"","data":"A"}`, code: message.CodeRequired},
+		"unknown field":      {body: `{"operation":"Add","key":"1","data":"A","ttl":60}`, code: message.CodeUnknownField},
+		"unknown operation":  {body: `{"operation":"Put","key":"1"}`, code: message.CodeUnknownOperation},
+		"no operation":       {body: `{"key":"1"}`, code: message.CodeRequired},
+		"not JSON":           {body: `{"operation":`, code: message.CodeMalformed},
+		"large value":        {body: `{"operation":"Add","key":"1","data":"` + strings.Repeat("a", message.MaxValueLength+1) + `"}`, code: message.CodeTooLong},
+		"newer minor fields": {body: `{"version":"2.9","operation":"Add","key":"1","data":"A","ttl":60}`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := message.AnyFromJSON(tt.body)
+			assert.Equal(t, tt.code, message.CodeOf(err), "%v", err)
+		})
+	}
+
+	// invalid message is returned along with error, so server can reply to it
+	msg, err := message.AnyFromJSON(`{"operation":"Get","key":"a b","replyTo":"http://localhost/replies"}`)
+	assert.Equal(t, message.CodeInvalidCharacters, message.CodeOf(err))
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, "http://localhost/replies", msg.ReplyTo)
+	}
+}
+
+func TestEncode_Size(t *testing.T) {
+	// every control character is escaped as \u00XX, so valid value doesn't fit SQS message
+	add := message.NewAdd("", "1", strings.Repeat("\x01", message.MaxValueLength))
+	_, err := message.JSONCodec.Encode(add)
+	assert.Equal(t, message.CodeTooLarge, message.CodeOf(err))
+
+	for _, codec := range codecs {
+		body, err := codec.Encode(message.NewAdd("", "1", strings.Repeat("a", message.MaxValueLength)))
+		if assert.NoError(t, err, codec.Name()) {
+			assert.LessOrEqual(t, len(body), message.MaxBodySize)
+		}
+
+		_, err = codec.Encode(message.NewAdd("", "", "A"))
+		assert.Equal(t, message.CodeRequired, message.CodeOf(err), codec.Name())
+	}
+}
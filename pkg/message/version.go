@@ -0,0 +1,168 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Protocol versions have form MAJOR.MINOR, messages without version are version 1.0.
+//
+// Minor versions of the same major version are compatible: they may only add optional fields
+// and operations, fields unknown to reader are ignored. Major version may rename or change meaning
+// of fields, server accepts all major versions listed in MajorVersions and rejects others.
+//
+// In version 1 Remove and Get carry key in itemId field, version 2 uses key field for all messages
+// and adds Capabilities operation. Version 2.1 adds dataRef field of Add and valueRef of Reply,
+// version 2.2 allows bodies compressed as described by content-encoding attribute.
+const (
+	Version1        = "1.0"
+	Version2        = "2.0"
+	Version21       = "2.1"
+	Version22       = "2.2"
+	ProtocolVersion = Version22
+)
+
+// MajorVersions are major protocol versions supported by this implementation
+var MajorVersions = []int{1, 2}
+
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// ParseVersion parses version in form MAJOR.MINOR or MAJOR, empty version is 1.0
+func ParseVersion(version string) (major, minor int, err error) {
+	if version == "" {
+		return 1, 0, nil
+	}
+	majorPart, minorPart, hasMinor := strings.Cut(version, ".")
+	major, err = strconv.Atoi(majorPart)
+	if err == nil && hasMinor {
+		minor, err = strconv.Atoi(minorPart)
+	}
+	if err != nil || major < 0 || minor < 0 {
+		return 0, 0, fmt.Errorf("invalid protocol version %q", version)
+	}
+	return major, minor, nil
+}
+
+// CheckVersion checks that version is valid and its major version is supported, it returns *ValidationError otherwise
+func CheckVersion(version string) error {
+	major, _, err := ParseVersion(version)
+	if err != nil {
+		return &ValidationError{Code: CodeInvalidValue, Field: "version", Reason: err.Error(), Err: err}
+	}
+	if !supportsMajor(MajorVersions, major) {
+		return &ValidationError{
+			Code:   CodeUnsupportedVersion,
+			Field:  "version",
+			Reason: fmt.Sprintf("%v %s, supported major versions are %s", ErrUnsupportedVersion, version, formatMajors(MajorVersions)),
+			Err:    ErrUnsupportedVersion,
+		}
+	}
+	return nil
+}
+
+// AtLeast reports whether version is the same or newer than min, invalid version isn't newer than any
+func AtLeast(version, min string) bool {
+	major, minor, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	minMajor, minMinor, _ := ParseVersion(min)
+	return major > minMajor || major == minMajor && minor >= minMinor
+}
+
+// newerMinorVersion reports whether version is a minor version newer than the latest one supported of the same major
+func newerMinorVersion(version string) bool {
+	major, minor, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	latestMajor, latestMinor, _ := ParseVersion(ProtocolVersion)
+	if major != latestMajor {
+		// previous major versions have no minor versions
+		latestMinor = 0
+	}
+	return minor > latestMinor
+}
+
+// Operations returns operations supported by given protocol version
+func Operations(version string) []Operation {
+	var operations []Operation
+	for _, spec := range registeredOperations() {
+		if spec.MinVersion == "" || AtLeast(version, spec.MinVersion) {
+			operations = append(operations, spec.Operation)
+		}
+	}
+	return operations
+}
+
+// Protocol describes protocol versions and operations supported by server, it's returned in reply to Capabilities
+type Protocol struct {
+	// Version is the latest protocol version supported by server
+	Version       string      `json:"version"`
+	MajorVersions []int       `json:"majorVersions"`
+	Operations    []Operation `json:"operations"`
+}
+
+// SupportedProtocol returns protocol supported by this implementation
+func SupportedProtocol() Protocol {
+	return Protocol{
+		Version:       ProtocolVersion,
+		MajorVersions: MajorVersions,
+		Operations:    Operations(ProtocolVersion),
+	}
+}
+
+// Negotiate returns the latest version not newer than version which is supported by server
+func (p Protocol) Negotiate(version string) (string, error) {
+	major, minor, err := ParseVersion(version)
+	if err != nil {
+		return "", err
+	}
+	if supportsMajor(p.MajorVersions, major) {
+		// server of the same major version may not know fields of newer minor version
+		serverMajor, serverMinor, err := ParseVersion(p.Version)
+		if err == nil && serverMajor == major && serverMinor < minor {
+			return p.Version, nil
+		}
+		return version, nil
+	}
+	best := -1
+	for _, m := range p.MajorVersions {
+		if m < major && m > best {
+			best = m
+		}
+	}
+	if best < 0 {
+		return "", fmt.Errorf("%w %s, server supports major versions %s", ErrUnsupportedVersion, version, formatMajors(p.MajorVersions))
+	}
+	return fmt.Sprintf("%d.0", best), nil
+}
+
+// Supports reports whether server supports operation
+func (p Protocol) Supports(operation Operation) bool {
+	for _, op := range p.Operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+func supportsMajor(majors []int, major int) bool {
+	for _, m := range majors {
+		if m == major {
+			return true
+		}
+	}
+	return false
+}
+
+func formatMajors(majors []int) string {
+	names := make([]string, 0, len(majors))
+	for _, m := range majors {
+		names = append(names, strconv.Itoa(m))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,114 @@
+package message_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := map[string]struct {
+		version string
+		major   int
+		minor   int
+		wantErr bool
+	}{
+		"empty is 1.0":  {version: "", major: 1, minor: 0},
+		"major only":    {version: "2", major: 2, minor: 0},
+		"major, minor":  {version: "2.3", major: 2, minor: 3},
+		"not a number":  {version: "v2", wantErr: true},
+		"invalid minor": {version: "2.x", wantErr: true},
+		"negative":      {version: "-1.0", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			major, minor, err := message.ParseVersion(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.major, major)
+				assert.Equal(t, tt.minor, minor)
+			}
+		})
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	assert.NoError(t, message.CheckVersion(""))
+	assert.NoError(t, message.CheckVersion(message.Version1))
+	assert.NoError(t, message.CheckVersion("2.7"))
+
+	err := message.CheckVersion("3.0")
+	assert.True(t, errors.Is(err, message.ErrUnsupportedVersion))
+	assert.True(t, strings.Contains(err.Error(), "supported major versions are 1, 2"), err.Error())
+}
+
+func TestProtocol_Negotiate(t *testing.T) {
+	tests := map[string]struct {
+		server  string
+		majors  []int
+		version string
+		want    string
+		wantErr bool
+	}{
+		"same major":           {majors: []int{1, 2}, version: "2.0", want: "2.0"},
+		"older minor server":   {server: "2.0", majors: []int{1, 2}, version: "2.1", want: "2.0"},
+		"newer minor server":   {server: "2.3", majors: []int{1, 2}, version: "2.1", want: "2.1"},
+		"newer server":         {majors: []int{1, 2, 3}, version: "2.0", want: "2.0"},
+		"older server":         {majors: []int{1}, version: "2.0", want: "1.0"},
+		"no common version":    {majors: []int{3}, version: "2.0", wantErr: true},
+		"invalid version":      {majors: []int{1, 2}, version: "x", wantErr: true},
+		"highest older server": {majors: []int{1, 2}, version: "4.1", want: "2.0"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, err := message.Protocol{Version: tt.server, MajorVersions: tt.majors}.Negotiate(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, version)
+			}
+		})
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	assert.True(t, message.AtLeast("2.1", message.Version21))
+	assert.True(t, message.AtLeast("3.0", message.Version21))
+	assert.False(t, message.AtLeast("2.0", message.Version21))
+	assert.False(t, message.AtLeast("", message.Version2))
+	assert.False(t, message.AtLeast("x", message.Version1))
+}
+
+func TestVersions_FieldNames(t *testing.T) {
+	v1, err := message.JSONCodec.Encode(message.WithVersion(message.NewGet("teamA", "1"), message.Version1))
+	if assert.NoError(t, err) {
+		assert.Contains(t, v1, `"itemId":"1"`)
+		assert.NotContains(t, v1, `"key"`)
+	}
+
+	v2, err := message.JSONCodec.Encode(message.NewGet("teamA", "1"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, v2, `"key":"1"`)
+		assert.Contains(t, v2, `"version":"`+message.ProtocolVersion+`"`)
+	}
+
+	// version 2 message with key in itemId is normalized too
+	any, err := message.JSONCodec.Decode(`{"version":"2.0","operation":"Get","itemId":"1"}`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "1", any.GetItem.Key)
+	}
+
+	assert.Contains(t, message.Operations(message.Version2), message.CapabilitiesOp)
+	assert.NotContains(t, message.Operations(message.Version1), message.CapabilitiesOp)
+	assert.True(t, message.SupportedProtocol().Supports(message.CapabilitiesOp))
+}
@@ -0,0 +1,371 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets suitable for latencies measured in seconds
+var DefaultBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5}
+
+// DefaultRegistry is a registry used by server and client packages
+var DefaultRegistry = NewRegistry()
+
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry holds metrics and writes them in Prometheus text exposition format
+type Registry struct {
+	lock       sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates new empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	r.collectors = append(r.collectors, c)
+	r.lock.Unlock()
+}
+
+// NewCounter creates and registers new counter with given label names
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, "counter", labelNames)}
+	r.register(c)
+	return c
+}
+
+// NewGauge creates and registers new gauge with given label names
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{vec: newVec(name, help, "gauge", labelNames)}
+	r.register(g)
+	return g
+}
+
+// NewGaugeFunc creates and registers gauge which values are collected with fn on every scrape,
+// fn reports every sample with set
+func (r *Registry) NewGaugeFunc(name, help string, labelNames []string, fn func(set func(value float64, labelValues ...string))) {
+	r.register(&gaugeFunc{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		fn:         fn,
+	})
+}
+
+// NewHistogram creates and registers new histogram with given buckets and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		name:       name,
+		help:       help,
+		buckets:    buckets,
+		labelNames: labelNames,
+		series:     make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Write writes all registered metrics in Prometheus text exposition format
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.Lock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.lock.Unlock()
+
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns HTTP handler exposing registry's metrics
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.Write(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// vec holds float values of a metric indexed by label values
+type vec struct {
+	lock       sync.Mutex
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	values     map[string]float64
+	labels     map[string][]string
+}
+
+func newVec(name, help, kind string, labelNames []string) vec {
+	return vec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+		labels:     make(map[string][]string),
+	}
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.lock.Lock()
+	v.values[key] += delta
+	v.labels[key] = labelValues
+	v.lock.Unlock()
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.lock.Lock()
+	v.values[key] = value
+	v.labels[key] = labelValues
+	v.lock.Unlock()
+}
+
+func (v *vec) get(labelValues []string) float64 {
+	key := v.key(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.values[key]
+}
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) write(w io.Writer) error {
+	v.lock.Lock()
+	keys := sortedKeys(v.values)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, sample(v.name, v.labelNames, v.labels[key], nil, v.values[key]))
+	}
+	v.lock.Unlock()
+
+	return writeFamily(w, v.name, v.help, v.kind, lines)
+}
+
+// Counter is a monotonically increasing metric
+type Counter struct {
+	vec
+}
+
+// Inc increments counter by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add increases counter by delta, which must not be negative
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %s can't be decreased", c.name))
+	}
+	c.add(delta, labelValues)
+}
+
+// Value returns current value of the counter
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.get(labelValues)
+}
+
+// Gauge is a metric which can go up and down
+type Gauge struct {
+	vec
+}
+
+// Set sets gauge to value
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+// Add adds delta to gauge, delta can be negative
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.add(delta, labelValues)
+}
+
+// Value returns current value of the gauge
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.get(labelValues)
+}
+
+type gaugeFunc struct {
+	name       string
+	help       string
+	labelNames []string
+	fn         func(set func(value float64, labelValues ...string))
+}
+
+func (g *gaugeFunc) write(w io.Writer) error {
+	var lines []string
+	g.fn(func(value float64, labelValues ...string) {
+		lines = append(lines, sample(g.name, g.labelNames, labelValues, nil, value))
+	})
+	sort.Strings(lines)
+
+	return writeFamily(w, g.name, g.help, "gauge", lines)
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Histogram samples observations into cumulative buckets
+type Histogram struct {
+	lock       sync.Mutex
+	name       string
+	help       string
+	buckets    []float64
+	labelNames []string
+	series     map[string]*histogramSeries
+}
+
+// Observe adds single observation to histogram
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", h.name, len(h.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: labelValues,
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.lock.Lock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, key := range keys {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			le := []string{"le", formatFloat(upper)}
+			lines = append(lines, sample(h.name+"_bucket", h.labelNames, s.labelValues, le, float64(s.counts[i])))
+		}
+		lines = append(lines, sample(h.name+"_bucket", h.labelNames, s.labelValues, []string{"le", "+Inf"}, float64(s.count)))
+		lines = append(lines, sample(h.name+"_sum", h.labelNames, s.labelValues, nil, s.sum))
+		lines = append(lines, sample(h.name+"_count", h.labelNames, s.labelValues, nil, float64(s.count)))
+	}
+	h.lock.Unlock()
+
+	return writeFamily(w, h.name, h.help, "histogram", lines)
+}
+
+func writeFamily(w io.Writer, name, help, kind string, lines []string) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sample formats single sample line, extra is an additional label name/value pair, e.g. histogram's le
+func sample(name string, labelNames, labelValues, extra []string, value float64) string {
+	var b strings.Builder
+	b.WriteString(name)
+
+	if len(labelNames) > 0 || len(extra) > 0 {
+		b.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeLabel(&b, labelName, labelValues[i])
+		}
+		if len(extra) > 0 {
+			if len(labelNames) > 0 {
+				b.WriteByte(',')
+			}
+			writeLabel(&b, extra[0], extra[1])
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(value))
+	b.WriteByte('\n')
+
+	return b.String()
+}
+
+func writeLabel(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteString(`="`)
+	b.WriteString(labelEscaper.Replace(value))
+	b.WriteByte('"')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,93 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	cases := map[string]struct {
+		scenario func(registry *metrics.Registry)
+		expected string
+	}{
+		"Counter without labels": {
+			scenario: func(registry *metrics.Registry) {
+				c := registry.NewCounter("requests_total", "Total requests.")
+				c.Inc()
+				c.Add(2)
+			},
+			expected: "# HELP requests_total Total requests.\n" +
+				"# TYPE requests_total counter\n" +
+				"requests_total 3\n",
+		},
+		"Counter with labels is sorted by label values": {
+			scenario: func(registry *metrics.Registry) {
+				c := registry.NewCounter("errors_total", "Errors.", "call")
+				c.Inc("ReceiveMessage")
+				c.Inc("DeleteMessage")
+				c.Inc("ReceiveMessage")
+			},
+			expected: "# HELP errors_total Errors.\n" +
+				"# TYPE errors_total counter\n" +
+				"errors_total{call=\"DeleteMessage\"} 1\n" +
+				"errors_total{call=\"ReceiveMessage\"} 2\n",
+		},
+		"Gauge and label escaping": {
+			scenario: func(registry *metrics.Registry) {
+				g := registry.NewGauge("items", "Items\nin storage.", "namespace")
+				g.Set(5, "a\"b\\c\nd")
+				g.Add(-2, "a\"b\\c\nd")
+			},
+			expected: "# HELP items Items\\nin storage.\n" +
+				"# TYPE items gauge\n" +
+				"items{namespace=\"a\\\"b\\\\c\\nd\"} 3\n",
+		},
+		"Gauge function": {
+			scenario: func(registry *metrics.Registry) {
+				registry.NewGaugeFunc("buffer", "Buffer.", []string{"kind"}, func(set func(float64, ...string)) {
+					set(128, "capacity")
+					set(7, "size")
+				})
+			},
+			expected: "# HELP buffer Buffer.\n" +
+				"# TYPE buffer gauge\n" +
+				"buffer{kind=\"capacity\"} 128\n" +
+				"buffer{kind=\"size\"} 7\n",
+		},
+		"Histogram": {
+			scenario: func(registry *metrics.Registry) {
+				h := registry.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "operation")
+				h.Observe(0.05, "Add")
+				h.Observe(0.5, "Add")
+				h.Observe(2, "Add")
+			},
+			expected: "# HELP latency_seconds Latency.\n" +
+				"# TYPE latency_seconds histogram\n" +
+				"latency_seconds_bucket{operation=\"Add\",le=\"0.1\"} 1\n" +
+				"latency_seconds_bucket{operation=\"Add\",le=\"1\"} 2\n" +
+				"latency_seconds_bucket{operation=\"Add\",le=\"+Inf\"} 3\n" +
+				"latency_seconds_sum{operation=\"Add\"} 2.55\n" +
+				"latency_seconds_count{operation=\"Add\"} 3\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			registry := metrics.NewRegistry()
+			tc.scenario(registry)
+
+			recorder := httptest.NewRecorder()
+			metrics.Handler(registry).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+			body, err := io.ReadAll(recorder.Body)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+			assert.Equal(t, tc.expected, string(body))
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker stops calls to service which keeps failing: it opens after threshold consecutive failures and
+// lets a trial call through once cooldown passes; successful call closes it, failed trial opens it again
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	lock      sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// NewBreaker creates breaker opening after threshold consecutive failures for cooldown
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Wait returns time left until breaker lets calls through, 0 if calls are allowed
+func (b *Breaker) Wait(now time.Time) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.failures < b.threshold || !now.Before(b.openUntil) {
+		return 0
+	}
+	return b.openUntil.Sub(now)
+}
+
+// Success records successful call, which closes breaker
+func (b *Breaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures = 0
+}
+
+// Failure records failed call, it reports whether breaker is open after it
+func (b *Breaker) Failure(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// Open reports whether breaker has opened and hasn't been closed by successful call yet, including
+// the time it lets trial call through
+func (b *Breaker) Open() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.failures >= b.threshold
+}
@@ -0,0 +1,163 @@
+// Package retry retries failed calls of remote services with exponential backoff and jitter, and classifies
+// errors, so permanent failures aren't retried and throttled calls back off longer. Breaker stops calling
+// a service which keeps failing, e.g. during outage.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// Class tells whether failed call is worth retrying
+type Class string
+
+const (
+	// Permanent errors fail the same way when retried, e.g. access denied or missing queue
+	Permanent Class = "permanent"
+	// Transient errors, e.g. network errors or failures of service, may not happen again
+	Transient Class = "transient"
+	// Throttling errors are caused by exceeding request rate of service, they are retried after longer delays
+	Throttling Class = "throttling"
+)
+
+// throttlingCodes are error codes AWS services return when requests are throttled
+var throttlingCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"RequestLimitExceeded":                   true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+	"SlowDown":                               true,
+	"OverLimit":                              true,
+}
+
+// transientCodes are error codes of failures on the side of AWS services
+var transientCodes = map[string]bool{
+	"InternalError":           true,
+	"InternalFailure":         true,
+	"ServiceUnavailable":      true,
+	"RequestTimeout":          true,
+	"RequestTimeoutException": true,
+}
+
+// Classify returns class of error: errors reported by service are classified by code and HTTP status,
+// other errors, e.g. failed connections, are transient; cancellation is permanent
+func Classify(err error) Class {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return Permanent
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.ErrorCode(); {
+		case throttlingCodes[code]:
+			return Throttling
+		case transientCodes[code]:
+			return Transient
+		}
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch status := respErr.HTTPStatusCode(); {
+		case status == http.StatusTooManyRequests:
+			return Throttling
+		case status >= http.StatusInternalServerError:
+			return Transient
+		default:
+			return Permanent
+		}
+	}
+	if apiErr != nil {
+		return Permanent
+	}
+	return Transient
+}
+
+// throttlingFactor multiplies delays after throttling errors
+const throttlingFactor = 4
+
+// Policy defines how failed calls are retried
+type Policy struct {
+	// MaxAttempts is a maximal number of calls, including the first one; 1 or less disables retries
+	MaxAttempts int
+	// BaseDelay is the longest delay before the first retry, it's doubled for every next one
+	BaseDelay time.Duration
+	// MaxDelay limits delays
+	MaxDelay time.Duration
+	// OnRetry is called before every retry with number of failed attempts, if set
+	OnRetry func(attempt int, class Class, delay time.Duration, err error)
+}
+
+// DefaultPolicy makes 3 attempts, waiting up to 100ms and 200ms between them
+var DefaultPolicy = Policy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 20 * time.Second}
+
+// random generates jitter, global source of math/rand isn't seeded
+var random = struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Delay returns delay before retry after given number of failed attempts: BaseDelay doubled for every attempt
+// after the first one, 4 times longer after throttling, limited by MaxDelay; the half of it is random jitter,
+// so clients failed at once don't retry at once
+func (p Policy) Delay(attempt int, class Class) time.Duration {
+	delay := p.BaseDelay
+	if class == Throttling {
+		delay *= throttlingFactor
+	}
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	random.lock.Lock()
+	defer random.lock.Unlock()
+	return delay/2 + time.Duration(random.rand.Int63n(int64(delay/2)+1))
+}
+
+// Do calls fn until it succeeds, fails with permanent error, attempts are exhausted or ctx is done,
+// it returns the last error of fn
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts {
+			return err
+		}
+		class := Classify(err)
+		if class == Permanent {
+			return err
+		}
+		delay := p.Delay(attempt, class)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, class, delay, err)
+		}
+		if Sleep(ctx, delay) != nil {
+			return err
+		}
+	}
+}
+
+// Sleep waits for given time, it returns error of ctx if it's done earlier
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,175 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+)
+
+// responseError returns error of response with given status, as returned by SDK for errors without known code
+func responseError(status int, err error) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      err,
+	}}
+}
+
+func TestClassify(t *testing.T) {
+	tests := map[string]struct {
+		err   error
+		class retry.Class
+	}{
+		"throttling code": {
+			err:   &smithy.GenericAPIError{Code: "RequestThrottled"},
+			class: retry.Throttling,
+		},
+		"wrapped throttling code": {
+			err:   fmt.Errorf("send: %w", &smithy.GenericAPIError{Code: "ThrottlingException"}),
+			class: retry.Throttling,
+		},
+		"service failure": {
+			err:   &smithy.GenericAPIError{Code: "ServiceUnavailable"},
+			class: retry.Transient,
+		},
+		"client error": {
+			err:   &smithy.GenericAPIError{Code: "AWS.SimpleQueueService.NonExistentQueue"},
+			class: retry.Permanent,
+		},
+		"too many requests": {
+			err:   responseError(http.StatusTooManyRequests, errors.New("slow down")),
+			class: retry.Throttling,
+		},
+		"server error": {
+			err:   responseError(http.StatusBadGateway, errors.New("bad gateway")),
+			class: retry.Transient,
+		},
+		"forbidden": {
+			err:   responseError(http.StatusForbidden, &smithy.GenericAPIError{Code: "AccessDenied"}),
+			class: retry.Permanent,
+		},
+		"network error": {
+			err:   errors.New("connection refused"),
+			class: retry.Transient,
+		},
+		"canceled": {
+			err:   fmt.Errorf("send: %w", context.Canceled),
+			class: retry.Permanent,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.class, retry.Classify(tc.err))
+		})
+	}
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	policy := retry.Policy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1, retry.Transient)
+		assert.True(t, delay >= 50*time.Millisecond && delay <= 100*time.Millisecond, delay)
+		delay = policy.Delay(3, retry.Transient)
+		assert.True(t, delay >= 200*time.Millisecond && delay <= 400*time.Millisecond, delay)
+		delay = policy.Delay(1, retry.Throttling)
+		assert.True(t, delay >= 200*time.Millisecond && delay <= 400*time.Millisecond, delay)
+		delay = policy.Delay(10, retry.Transient)
+		assert.True(t, delay >= 500*time.Millisecond && delay <= time.Second, delay)
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	transient := errors.New("connection reset")
+	permanent := &smithy.GenericAPIError{Code: "AccessDenied"}
+	tests := map[string]struct {
+		errs     []error
+		err      error
+		attempts int
+	}{
+		"success": {
+			errs:     []error{nil},
+			attempts: 1,
+		},
+		"transient failure": {
+			errs:     []error{transient, transient, nil},
+			attempts: 3,
+		},
+		"attempts exhausted": {
+			errs:     []error{transient, transient, transient, nil},
+			err:      transient,
+			attempts: 3,
+		},
+		"permanent failure": {
+			errs:     []error{permanent, nil},
+			err:      permanent,
+			attempts: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			retries := 0
+			policy := retry.Policy{
+				MaxAttempts: 3,
+				BaseDelay:   time.Millisecond,
+				OnRetry: func(attempt int, class retry.Class, delay time.Duration, err error) {
+					retries++
+				},
+			}
+			attempts := 0
+			err := policy.Do(context.Background(), func(ctx context.Context) error {
+				attempts++
+				return tc.errs[attempts-1]
+			})
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.attempts, attempts)
+			assert.Equal(t, tc.attempts-1, retries)
+		})
+	}
+}
+
+func TestPolicy_Do_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	policy := retry.Policy{MaxAttempts: 3, BaseDelay: time.Hour}
+	attempts := 0
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		attempts++
+		return errors.New("connection reset")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := retry.NewBreaker(2, time.Minute)
+
+	assert.False(t, breaker.Failure(now))
+	assert.Zero(t, breaker.Wait(now))
+	assert.True(t, breaker.Failure(now))
+	assert.True(t, breaker.Open())
+	assert.Equal(t, time.Minute, breaker.Wait(now))
+
+	// trial call is let through after cooldown, its failure opens breaker again
+	now = now.Add(time.Minute)
+	assert.Zero(t, breaker.Wait(now))
+	assert.True(t, breaker.Failure(now))
+	assert.Equal(t, time.Minute, breaker.Wait(now))
+
+	now = now.Add(time.Minute)
+	breaker.Success()
+	assert.False(t, breaker.Open())
+	assert.False(t, breaker.Failure(now))
+	assert.Zero(t, breaker.Wait(now))
+}
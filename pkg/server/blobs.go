@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// blobReleaseBuffer is a number of blobs waiting for deletion, blobs released when buffer is full are left in store
+const blobReleaseBuffer = 1024
+
+var errNoBlobStore = errors.New("value is stored in blob store, but blob store isn't configured")
+
+// Blobs resolves values offloaded by clients to blob store and deletes blobs of removed and replaced items
+// in background; nil Blobs can't resolve values and doesn't delete anything
+type Blobs struct {
+	store    blob.Store
+	released chan string
+
+	lock sync.Mutex
+	// owners are items referencing blobs; blob is referenced by a single item, so value of item can't be read
+	// through item of other namespace or key, and isn't deleted while item exists
+	owners map[string]blobOwner
+}
+
+type blobOwner struct {
+	namespace string
+	key       string
+}
+
+// NewBlobs creates new blobs over store
+func NewBlobs(store blob.Store) *Blobs {
+	return &Blobs{
+		store:    store,
+		released: make(chan string, blobReleaseBuffer),
+		owners:   make(map[string]blobOwner),
+	}
+}
+
+// Get returns value stored in blob
+func (b *Blobs) Get(ctx context.Context, ref string) (string, error) {
+	if b == nil {
+		return "", errNoBlobStore
+	}
+	value, err := b.store.Get(ctx, ref)
+	if err != nil {
+		blobOperations.Inc("get", "error")
+		return "", err
+	}
+	blobOperations.Inc("get", "ok")
+	return string(value), nil
+}
+
+// Release schedules deletion of blob which isn't referenced by any item, e.g. blob of item which wasn't added;
+// it doesn't block, so can be called under lock
+func (b *Blobs) Release(ref string) {
+	if b == nil || ref == "" {
+		return
+	}
+	b.lock.Lock()
+	_, owned := b.owners[ref]
+	b.lock.Unlock()
+	if !owned {
+		b.delete(ref)
+	}
+}
+
+// claim makes item the owner of blob, it fails if blob is owned by another item; it reports whether item
+// didn't own blob yet
+func (b *Blobs) claim(ref string, owner blobOwner) (bool, error) {
+	if b == nil || ref == "" {
+		return false, nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	current, owned := b.owners[ref]
+	if owned && current != owner {
+		return false, &message.ValidationError{
+			Code:   message.CodeInvalidValue,
+			Field:  "dataRef",
+			Reason: fmt.Sprintf("blob %s is referenced by another item", ref),
+		}
+	}
+	b.owners[ref] = owner
+	return !owned, nil
+}
+
+// disown drops ownership of blob by item, it reports whether item owned it
+func (b *Blobs) disown(ref string, owner blobOwner) bool {
+	if b == nil || ref == "" {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if current, owned := b.owners[ref]; !owned || current != owner {
+		return false
+	}
+	delete(b.owners, ref)
+	return true
+}
+
+// releaseOwned schedules deletion of blob owned by item which is replaced or removed
+func (b *Blobs) releaseOwned(ref string, owner blobOwner) {
+	if b.disown(ref, owner) {
+		b.delete(ref)
+	}
+}
+
+func (b *Blobs) delete(ref string) {
+	select {
+	case b.released <- ref:
+	default:
+		blobOperations.Inc("delete", "dropped")
+		logging.Default().Warn("too many blobs waiting for deletion, leaving blob in store", "ref", ref)
+	}
+}
+
+// Run deletes released blobs until context is cancelled
+func (b *Blobs) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ref := <-b.released:
+			if err := b.store.Delete(ctx, ref); err != nil {
+				blobOperations.Inc("delete", "error")
+				logging.Default().Error("error deleting blob", "ref", ref, "error", err)
+				continue
+			}
+			blobOperations.Inc("delete", "ok")
+			logging.Default().Debug("blob deleted", "ref", ref)
+		}
+	}
+}
+
+// blobRefStorage makes items of namespace owners of blobs they reference and releases blobs of items which are
+// replaced or removed; it must be wrapped by locking storage, so looking up previous item and modification are atomic
+type blobRefStorage struct {
+	Storage
+	namespace string
+	blobs     *Blobs
+}
+
+// NewBlobRefStorage returns storage of namespace which owns and releases blobs of its items
+func NewBlobRefStorage(storage Storage, namespace string, blobs *Blobs) *blobRefStorage {
+	return &blobRefStorage{
+		Storage:   storage,
+		namespace: namespace,
+		blobs:     blobs,
+	}
+}
+
+func (s *blobRefStorage) owner(key string) blobOwner {
+	return blobOwner{namespace: s.namespace, key: key}
+}
+
+func (s *blobRefStorage) AddItem(item Item) error {
+	previous, _ := s.Storage.GetItem(item.K)
+	return s.add(item, previous, s.Storage.AddItem)
+}
+
+func (s *blobRefStorage) AddNewItem(item Item) error {
+	previous, _ := s.Storage.GetItem(item.K)
+	if previous != nil {
+		return ErrKeyExists
+	}
+	return s.add(item, nil, s.Storage.AddNewItem)
+}
+
+// add claims blob of item before it's added and releases blob of previous item once it's replaced
+func (s *blobRefStorage) add(item Item, previous *Item, add func(item Item) error) error {
+	claimed, err := s.blobs.claim(item.Ref, s.owner(item.K))
+	if err != nil {
+		return err
+	}
+	if err := add(item); err != nil {
+		if claimed {
+			s.blobs.disown(item.Ref, s.owner(item.K))
+		}
+		return err
+	}
+	if previous != nil && previous.Ref != item.Ref {
+		s.blobs.releaseOwned(previous.Ref, s.owner(item.K))
+	}
+	return nil
+}
+
+func (s *blobRefStorage) RemoveItem(key string) error {
+	previous, _ := s.Storage.GetItem(key)
+	if err := s.Storage.RemoveItem(key); err != nil {
+		return err
+	}
+	if previous != nil {
+		s.blobs.releaseOwned(previous.Ref, s.owner(key))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package server_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestBlobs_Release(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := blob.NewFileStore(t.TempDir())
+	for _, ref := range []string{"values/1", "values/2", "values/3", "values/4"} {
+		assert.NoError(t, store.Put(ctx, ref, []byte(ref)))
+	}
+	blobs := server.NewBlobs(store)
+	go blobs.Run(ctx)
+
+	namespaces := server.NewNamespaces(0, nil)
+	namespaces.UseBlobs(blobs)
+	storage := namespaces.Storage("a")
+	assert.NoError(t, storage.AddItem(server.Item{K: "1", V: "A", Ref: "values/1"}))
+	// replaced by item with other blob
+	assert.NoError(t, storage.AddItem(server.Item{K: "1", V: "B", Ref: "values/2"}))
+	// removed
+	assert.NoError(t, storage.AddItem(server.Item{K: "2", V: "C", Ref: "values/3"}))
+	assert.NoError(t, storage.RemoveItem("2"))
+	// dropped with namespace
+	assert.NoError(t, namespaces.Storage("b").AddItem(server.Item{K: "1", V: "D", Ref: "values/4"}))
+	assert.NoError(t, namespaces.Drop("b"))
+
+	exists := func(ref string) bool {
+		_, err := store.Get(ctx, ref)
+		return err == nil
+	}
+	assert.Eventually(t, func() bool {
+		return !exists("values/1") && !exists("values/3") && !exists("values/4")
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, exists("values/2"), "blob of existing item")
+
+	value, err := blobs.Get(ctx, "values/2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "values/2", value)
+	}
+}
+
+func TestBlobs_Owners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := blob.NewFileStore(t.TempDir())
+	assert.NoError(t, store.Put(ctx, "values/1", []byte("A")))
+	blobs := server.NewBlobs(store)
+	go blobs.Run(ctx)
+
+	namespaces := server.NewNamespaces(0, nil)
+	namespaces.UseBlobs(blobs)
+	storage := namespaces.Storage("a")
+	assert.NoError(t, storage.AddItem(server.Item{K: "1", V: "A", Ref: "values/1"}))
+
+	// blob can't be referenced by items of other namespaces or keys
+	err := namespaces.Storage("b").AddItem(server.Item{K: "1", V: "A", Ref: "values/1"})
+	assert.Equal(t, message.CodeInvalidValue, message.CodeOf(err))
+	err = storage.AddItem(server.Item{K: "2", V: "A", Ref: "values/1"})
+	assert.Equal(t, message.CodeInvalidValue, message.CodeOf(err))
+	// redelivered message adds the same item again
+	assert.NoError(t, storage.AddItem(server.Item{K: "1", V: "A", Ref: "values/1"}))
+	assert.Equal(t, server.ErrKeyExists, storage.AddNewItem(server.Item{K: "1", V: "A", Ref: "values/1"}))
+
+	// blob of existing item isn't deleted when message referencing it fails
+	blobs.Release("values/1")
+	exists := func(ref string) bool {
+		_, err := store.Get(ctx, ref)
+		return err == nil
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, exists("values/1"))
+
+	assert.NoError(t, storage.RemoveItem("1"))
+	assert.Eventually(t, func() bool {
+		return !exists("values/1")
+	}, time.Second, 10*time.Millisecond)
+
+	// storage held after its namespace is dropped doesn't claim blobs
+	assert.NoError(t, store.Put(ctx, "values/2", []byte("B")))
+	assert.NoError(t, namespaces.Drop("a"))
+	assert.Equal(t, server.ErrNamespaceDropped, storage.AddItem(server.Item{K: "2", V: "B", Ref: "values/2"}))
+	assert.NoError(t, namespaces.Storage("b").AddItem(server.Item{K: "2", V: "B", Ref: "values/2"}))
+}
+
+func TestReplay_Blobs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "log.txt")
+	file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := journal.NewWriter(file, journal.SyncNever, 0)
+	assert.NoError(t, w.Write(journal.Record{Operation: "Add", Namespace: "default", Key: "1", Ref: "values/1", Result: journal.ResultOk}))
+	assert.NoError(t, w.Write(journal.Record{Operation: "Add", Namespace: "default", Key: "2", Ref: "values/missing", Result: journal.ResultOk}))
+	assert.NoError(t, w.Close())
+
+	store := blob.NewFileStore(t.TempDir())
+	assert.NoError(t, store.Put(ctx, "values/1", []byte("large value")))
+
+	namespaces := server.NewNamespaces(0, nil)
+	result, err := server.Replay(path, namespaces, server.ReplayOptions{Blobs: server.NewBlobs(store)})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, result.Entries)
+		assert.Equal(t, 1, result.Applied)
+		assert.Equal(t, 1, result.Failed)
+	}
+	assert.Equal(t, []server.Item{{K: "1", V: "large value", Ref: "values/1"}}, namespaces.Storage("default").GetAllItems())
+
+	// values can't be resolved without blob store
+	result, err = server.Replay(path, server.NewNamespaces(0, nil), server.ReplayOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, result.Failed)
+	}
+}
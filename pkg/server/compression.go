@@ -0,0 +1,86 @@
+package server
+
+import (
+	"math"
+
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// compressedStorage keeps values longer than threshold compressed with gzip, values are decompressed when items are read,
+// so Size of upstream storage reports memory actually used
+type compressedStorage struct {
+	Storage
+	threshold int
+}
+
+// NewCompressedStorage returns storage which compresses values longer than threshold bytes,
+// values which don't become shorter are kept as is
+func NewCompressedStorage(storage Storage, threshold int) *compressedStorage {
+	return &compressedStorage{
+		Storage:   storage,
+		threshold: threshold,
+	}
+}
+
+func (s *compressedStorage) AddItem(item Item) error {
+	return s.Storage.AddItem(s.compress(item))
+}
+
+func (s *compressedStorage) AddNewItem(item Item) error {
+	return s.Storage.AddNewItem(s.compress(item))
+}
+
+func (s *compressedStorage) GetItem(key string) (*Item, error) {
+	item, err := s.Storage.GetItem(key)
+	if err != nil {
+		return nil, err
+	}
+	decompressed := decompress(*item)
+	return &decompressed, nil
+}
+
+func (s *compressedStorage) GetAllItems() []Item {
+	items := s.Storage.GetAllItems()
+	for i := range items {
+		items[i] = decompress(items[i])
+	}
+	return items
+}
+
+func (s *compressedStorage) Iterate(accept func(Item)) {
+	s.Storage.Iterate(func(item Item) {
+		accept(decompress(item))
+	})
+}
+
+func (s *compressedStorage) compress(item Item) Item {
+	if len(item.V) <= s.threshold {
+		return item
+	}
+	compressed, err := message.Gzip(item.V)
+	if err != nil || len(compressed) >= len(item.V) {
+		return item
+	}
+	compressionBytes.Add(float64(len(item.V)), "value", "uncompressed")
+	compressionBytes.Add(float64(len(compressed)), "value", "compressed")
+	item.V = compressed
+	item.compressed = true
+	return item
+}
+
+// decompress restores value of item, value compressed by storage itself can't be invalid unless memory is corrupted,
+// so error is only logged
+func decompress(item Item) Item {
+	if !item.compressed {
+		return item
+	}
+	value, err := message.Gunzip(item.V, math.MaxInt32)
+	if err != nil {
+		logging.Default().Error("can't decompress stored value", "key", item.K, "error", err)
+		return item
+	}
+	item.V = value
+	item.compressed = false
+	return item
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+)
+
+// Attributes of messages in dead-letter queue explaining why message was moved there
+const (
+	DeadLetterReasonAttribute = "dlq-reason"
+	// DeadLetterCodeAttribute is message.ErrorCode of invalid message
+	DeadLetterCodeAttribute = "dlq-error-code"
+)
+
+// DeadLetters moves messages which can't be processed to dead-letter queue
+type DeadLetters struct {
+	sqsClient *sqs.Client
+	queueUrl  string
+	retry     retry.Policy
+}
+
+// NewDeadLetters creates new dead-letter queue sender
+func NewDeadLetters(sqsClient *sqs.Client, queueUrl string) *DeadLetters {
+	return &DeadLetters{
+		sqsClient: sqsClient,
+		queueUrl:  queueUrl,
+		retry:     retry.DefaultPolicy,
+	}
+}
+
+// UseRetry makes sender retry failed sends according to policy, retry.DefaultPolicy is used by default
+func (d *DeadLetters) UseRetry(policy retry.Policy) {
+	d.retry = policy
+}
+
+// Send sends copy of message with its attributes other than API key, error code and reason to dead-letter queue
+func (d *DeadLetters) Send(ctx context.Context, m types.Message, code message.ErrorCode, reason string) error {
+	attributes := make(map[string]types.MessageAttributeValue, len(m.MessageAttributes)+2)
+	for name, value := range m.MessageAttributes {
+		// API key would be readable to anyone with access to dead-letter queue
+		if name != message.ApiKeyAttribute {
+			attributes[name] = value
+		}
+	}
+	attributes[DeadLetterReasonAttribute] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(reason),
+	}
+	attributes[DeadLetterCodeAttribute] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(string(code)),
+	}
+
+	return callSQS(ctx, d.retry, "SendMessage", func(ctx context.Context) error {
+		_, err := d.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:          aws.String(d.queueUrl),
+			MessageBody:       m.Body,
+			MessageAttributes: attributes,
+		})
+		return err
+	})
+}
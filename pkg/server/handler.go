@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// Handler performs operation requested by message
+type Handler func(ctx context.Context, m *message.Any) (*Result, error)
+
+// Middleware wraps handler with cross-cutting behaviour, e.g. logging or metrics
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler with middlewares, the first middleware is the outermost one
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Result is an outcome of successfully performed operation
+type Result struct {
+	// Status is message.StatusOk or message.StatusSkipped for operation which didn't modify storage
+	Status message.Status
+	// Reply carries data returned to client: value, items, namespaces or protocol
+	Reply message.Reply
+	// Value and Ref are value and blob key of item recorded in audit journal, they are set only by operations
+	// modifying storage, so that journal doesn't collect values which are merely read
+	Value string
+	Ref   string
+}
+
+// HandlerOptions defines optional collaborators of handler
+type HandlerOptions struct {
+	// Blobs resolve values offloaded by clients
+	Blobs *Blobs
+	// Keyring decrypts encrypted values before they are stored and encrypts values in replies,
+	// values are stored as sent if it's nil
+	Keyring *envelope.Keyring
+}
+
+// NewHandler creates handler performing registered operations on namespaces, see RegisterOperation;
+// it's the innermost handler of chain
+func NewHandler(namespaces *Namespaces, opts HandlerOptions) Handler {
+	env := &Env{Namespaces: namespaces, Blobs: opts.Blobs, Keyring: opts.Keyring}
+
+	return func(ctx context.Context, m *message.Any) (*Result, error) {
+		spec, ok := lookupOperation(m.Operation)
+		if !ok {
+			return nil, &message.ValidationError{
+				Code:   message.CodeUnknownOperation,
+				Field:  "operation",
+				Reason: fmt.Sprintf("operation %q isn't supported by server", m.Operation),
+			}
+		}
+		return spec.Handler(ctx, env, m)
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/metrics"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// AdminHandler serves admin HTTP API over the same storages which are used by SQS processors
+type AdminHandler struct {
+	namespaces *Namespaces
+	reader     *Reader
+	processor  *Processor
+	journal    *journal.Writer
+	authorizer *Authorizer
+	mux        *http.ServeMux
+}
+
+type itemView struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type itemsPage struct {
+	Namespace string     `json:"namespace"`
+	Offset    int        `json:"offset"`
+	Limit     int        `json:"limit"`
+	Total     int        `json:"total"`
+	Items     []itemView `json:"items"`
+}
+
+type queueStats struct {
+	Waiting        int    `json:"waiting"`
+	InFlight       int    `json:"inFlight"`
+	Buffered       int    `json:"buffered"`
+	BufferCapacity int    `json:"bufferCapacity"`
+	Receivers      int    `json:"receivers"`
+	Error          string `json:"error,omitempty"`
+}
+
+type processorStats struct {
+	Running int  `json:"running"`
+	Ready   bool `json:"ready"`
+}
+
+type stats struct {
+	Items      int            `json:"items"`
+	Namespaces map[string]int `json:"namespaces"`
+	Queue      queueStats     `json:"queue"`
+	Processors processorStats `json:"processors"`
+}
+
+// NewAdminHandler creates new admin HTTP API handler, modifications are recorded in audit journal the same way processors do
+func NewAdminHandler(namespaces *Namespaces, reader *Reader, processor *Processor, auditJournal *journal.Writer) *AdminHandler {
+	h := &AdminHandler{
+		namespaces: namespaces,
+		reader:     reader,
+		processor:  processor,
+		journal:    auditJournal,
+		mux:        http.NewServeMux(),
+	}
+
+	h.mux.HandleFunc("/healthz", h.healthz)
+	h.mux.HandleFunc("/readyz", h.readyz)
+	h.mux.HandleFunc("/stats", h.stats)
+	h.mux.HandleFunc("/namespaces", h.listNamespaces)
+	h.mux.HandleFunc("/items", h.items)
+	h.mux.HandleFunc("/items/", h.item)
+	h.mux.Handle("/metrics", metrics.Handler(metrics.DefaultRegistry))
+
+	return h
+}
+
+// UseAuthorizer makes handler check requests against authorizer's policy the same way messages are checked;
+// principal and its API key are taken from HTTP basic authentication, requests without it are anonymous.
+// Health checks and metrics are served to everyone
+func (h *AdminHandler) UseAuthorizer(authorizer *Authorizer) {
+	h.authorizer = authorizer
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *AdminHandler) healthz(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *AdminHandler) readyz(w http.ResponseWriter, _ *http.Request) {
+	if !h.ready() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// ready reports whether server has working processors and SQS reader
+func (h *AdminHandler) ready() bool {
+	return h.reader.Ready() && h.processor.Running() > 0
+}
+
+func (h *AdminHandler) stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	// stats reveal all namespaces, so they require the same permission as listing them
+	if _, ok := h.authorize(w, r, message.ListNamespacesOp, "", ""); !ok {
+		return
+	}
+
+	result := stats{
+		Namespaces: make(map[string]int),
+		Processors: processorStats{
+			Running: h.processor.Running(),
+			Ready:   h.ready(),
+		},
+	}
+	for _, namespace := range h.namespaces.List() {
+		if storage, ok := h.namespaces.Lookup(namespace); ok {
+			n := storage.Len()
+			result.Namespaces[namespace] = n
+			result.Items += n
+		}
+	}
+
+	result.Queue.Buffered, result.Queue.BufferCapacity = h.reader.Buffered()
+	result.Queue.Receivers = h.reader.Running()
+	waiting, inFlight, err := h.reader.QueueLag(r.Context())
+	if err != nil {
+		result.Queue.Error = err.Error()
+	} else {
+		result.Queue.Waiting = waiting
+		result.Queue.InFlight = inFlight
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h *AdminHandler) listNamespaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	if _, ok := h.authorize(w, r, message.ListNamespacesOp, "", ""); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.namespaces.List())
+}
+
+func (h *AdminHandler) items(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	query := r.URL.Query()
+	offset, err := intParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("offset must be a non-negative integer"))
+		return
+	}
+	limit, err := intParam(query.Get("limit"), defaultPageSize)
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be an integer between 1 and %d", maxPageSize))
+		return
+	}
+
+	page := itemsPage{
+		Namespace: normalizeNamespace(query.Get("namespace")),
+		Offset:    offset,
+		Limit:     limit,
+		Items:     make([]itemView, 0),
+	}
+	if _, ok := h.authorize(w, r, message.GetAllItemsOp, page.Namespace, ""); !ok {
+		return
+	}
+	if storage, ok := h.namespaces.Lookup(page.Namespace); ok {
+		// items are iterated in insertion order, so offsets are stable unless storage is modified
+		idx := 0
+		storage.Iterate(func(item Item) {
+			if idx >= offset && idx < offset+limit {
+				page.Items = append(page.Items, itemView{Key: item.K, Value: item.V})
+			}
+			idx++
+		})
+		page.Total = idx
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *AdminHandler) item(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/items/")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, errors.New("key expected"))
+		return
+	}
+	namespace := normalizeNamespace(r.URL.Query().Get("namespace"))
+	operation, ok := itemOperations[r.Method]
+	if !ok {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	principal, ok := h.authorize(w, r, operation, namespace, key)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		storage, ok := h.namespaces.Lookup(namespace)
+		if !ok {
+			writeError(w, http.StatusNotFound, namespaceNotFound(namespace))
+			return
+		}
+		item, err := storage.GetItem(key)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, itemView{Key: item.K, Value: item.V})
+	case http.MethodPut:
+		value, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		item := Item{K: key, V: string(value)}
+		err = h.namespaces.Storage(namespace).AddItem(item)
+		writeRecord(h.journal, httpRecord(message.AddOp, principal, namespace, key, item.V), err)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		httpLogger(message.AddOp, namespace, key).With("principal", principal).Info("adding item", "size", len(item.V))
+		writeJSON(w, http.StatusOK, itemView{Key: item.K, Value: item.V})
+	case http.MethodDelete:
+		storage, ok := h.namespaces.Lookup(namespace)
+		if !ok {
+			writeError(w, http.StatusNotFound, namespaceNotFound(namespace))
+			return
+		}
+		err := storage.RemoveItem(key)
+		writeRecord(h.journal, httpRecord(message.RemoveOp, principal, namespace, key, ""), err)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		httpLogger(message.RemoveOp, namespace, key).With("principal", principal).Info("removing item")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// itemOperations are operations checked by policy for methods of single item requests
+var itemOperations = map[string]message.Operation{
+	http.MethodGet:    message.GetItemOp,
+	http.MethodPut:    message.AddOp,
+	http.MethodDelete: message.RemoveOp,
+}
+
+// authorize returns principal of request if it's allowed to perform operation, otherwise it writes
+// 401 or 403 response and returns false
+func (h *AdminHandler) authorize(w http.ResponseWriter, r *http.Request, operation message.Operation, namespace, key string) (string, bool) {
+	if h.authorizer == nil {
+		return "", true
+	}
+	var credentials message.Credentials
+	if principal, apiKey, ok := r.BasicAuth(); ok {
+		credentials = message.Credentials{Principal: principal, ApiKey: apiKey}
+	}
+	principal, err := h.authorizer.Allow(credentials, operation, namespace, key)
+	if err == nil {
+		return principal, true
+	}
+
+	accessDenied.Inc(string(operation))
+	httpLogger(operation, namespace, key).Warn("access denied", "principal", principal, "error", err)
+	if replyCode(err) == message.CodeUnauthenticated {
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin"`)
+		writeError(w, http.StatusUnauthorized, err)
+		return principal, false
+	}
+	writeError(w, http.StatusForbidden, err)
+	return principal, false
+}
+
+// httpLogger returns logger with context of modification made via admin API
+func httpLogger(operation message.Operation, namespace, key string) *logging.Logger {
+	return logging.Default().With("processor", "http", "operation", operation, "namespace", namespace, "key", key)
+}
+
+// httpRecord returns journal record of modification made via admin API
+func httpRecord(operation message.Operation, principal, namespace, key, value string) journal.Record {
+	return journal.Record{
+		Operation: string(operation),
+		Principal: principal,
+		Namespace: namespace,
+		Key:       key,
+		Value:     value,
+		Processor: "http",
+	}
+}
+
+func intParam(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logging.Default().Error("error writing http response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
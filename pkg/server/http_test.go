@@ -0,0 +1,401 @@
+package server_test
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestAdminHandlerItems(t *testing.T) {
+	cases := map[string]struct {
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		"Getting existing item": {
+			method:         http.MethodGet,
+			target:         "/items/2",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"key":"2","value":"B"}`,
+		},
+		"Getting non existing item": {
+			method:         http.MethodGet,
+			target:         "/items/100",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"key ` + "`100'" + ` not found"}`,
+		},
+		"Getting item from non existing namespace": {
+			method:         http.MethodGet,
+			target:         "/items/1?namespace=other",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"namespace ` + "`other'" + ` not found"}`,
+		},
+		"Putting item": {
+			method:         http.MethodPut,
+			target:         "/items/4",
+			body:           "D",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"key":"4","value":"D"}`,
+		},
+		"Deleting item": {
+			method:         http.MethodDelete,
+			target:         "/items/1",
+			expectedStatus: http.StatusNoContent,
+		},
+		"Listing all items": {
+			method:         http.MethodGet,
+			target:         "/items",
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"namespace":"default","offset":0,"limit":100,"total":3,` +
+				`"items":[{"key":"1","value":"A"},{"key":"2","value":"B"},{"key":"3","value":"C"}]}`,
+		},
+		"Listing page of items": {
+			method:         http.MethodGet,
+			target:         "/items?offset=1&limit=1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"namespace":"default","offset":1,"limit":1,"total":3,"items":[{"key":"2","value":"B"}]}`,
+		},
+		"Listing items with invalid limit": {
+			method:         http.MethodGet,
+			target:         "/items?limit=0",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"limit must be an integer between 1 and 1000"}`,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			logFile, err := journal.OpenRotatingFile(filepath.Join(t.TempDir(), "log.txt"), journal.RotateOptions{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			auditJournal := journal.NewWriter(logFile, journal.SyncNever, 0)
+			defer auditJournal.Close()
+
+			namespaces := server.NewNamespaces(0, nil)
+			storage := namespaces.Storage(server.DefaultNamespace)
+			_ = storage.AddItem(server.Item{K: "1", V: "A"})
+			_ = storage.AddItem(server.Item{K: "2", V: "B"})
+			_ = storage.AddItem(server.Item{K: "3", V: "C"})
+
+			handler := server.NewAdminHandler(namespaces, nil, nil, auditJournal)
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			assert.Equal(t, tc.expectedBody, strings.TrimSpace(recorder.Body.String()))
+		})
+	}
+}
+
+func TestAdminHandlerAuthorization(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	if !assert.NoError(t, os.WriteFile(policyFile, []byte(testPolicy), 0600)) {
+		return
+	}
+	authorizer, err := server.NewAuthorizer(policyFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := map[string]struct {
+		method         string
+		target         string
+		principal      string
+		apiKey         string
+		expectedStatus int
+	}{
+		"Getting item with API key": {
+			method:         http.MethodGet,
+			target:         "/items/1?namespace=teamA",
+			principal:      "teamA",
+			apiKey:         "secret-a",
+			expectedStatus: http.StatusOK,
+		},
+		"Putting item with API key": {
+			method:         http.MethodPut,
+			target:         "/items/2?namespace=teamA",
+			principal:      "teamA",
+			apiKey:         "secret-a",
+			expectedStatus: http.StatusOK,
+		},
+		"Deleting item in other namespace": {
+			method:         http.MethodDelete,
+			target:         "/items/1?namespace=teamB",
+			principal:      "teamA",
+			apiKey:         "secret-a",
+			expectedStatus: http.StatusForbidden,
+		},
+		"Listing items without credentials": {
+			method:         http.MethodGet,
+			target:         "/items?namespace=teamA",
+			expectedStatus: http.StatusForbidden,
+		},
+		"Listing namespaces without admin permission": {
+			method:         http.MethodGet,
+			target:         "/namespaces",
+			principal:      "teamA",
+			apiKey:         "secret-a",
+			expectedStatus: http.StatusForbidden,
+		},
+		"Getting stats without admin permission": {
+			method:         http.MethodGet,
+			target:         "/stats",
+			principal:      "teamA",
+			apiKey:         "secret-a",
+			expectedStatus: http.StatusForbidden,
+		},
+		"Getting item with invalid API key": {
+			method:         http.MethodGet,
+			target:         "/items/1?namespace=teamA",
+			principal:      "teamA",
+			apiKey:         "secret-b",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"Health check without credentials": {
+			method:         http.MethodGet,
+			target:         "/healthz",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			logFile, err := journal.OpenRotatingFile(filepath.Join(t.TempDir(), "log.txt"), journal.RotateOptions{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			auditJournal := journal.NewWriter(logFile, journal.SyncNever, 0)
+			defer auditJournal.Close()
+
+			namespaces := server.NewNamespaces(0, nil)
+			_ = namespaces.Storage("teamA").AddItem(server.Item{K: "1", V: "A"})
+
+			handler := server.NewAdminHandler(namespaces, nil, nil, auditJournal)
+			handler.UseAuthorizer(authorizer)
+			request := httptest.NewRequest(tc.method, tc.target, strings.NewReader("B"))
+			if tc.principal != "" {
+				request.SetBasicAuth(tc.principal, tc.apiKey)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			if tc.expectedStatus == http.StatusUnauthorized {
+				assert.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// fakeSQS answers ReceiveMessage with queued messages, or no messages once they are received, and
+// GetQueueAttributes with 5 waiting and 2 in-flight messages; messages whose visibility is changed are queued
+// again at once. It records bodies of sent messages by queue URL, visibility changes as HANDLE:TIMEOUT and
+// receipt handles of deleted messages; all calls fail while failing is set
+type fakeSQS struct {
+	failing int32
+
+	lock sync.Mutex
+	// attributes are string message attributes of all queued messages
+	attributes map[string]string
+	queued     []*fakeMessage
+	inFlight   map[string]*fakeMessage
+	sent       map[string][]string
+	changed    []string
+	deleted    []string
+}
+
+type fakeMessage struct {
+	id       int
+	body     string
+	receives int
+}
+
+// queue adds messages with given bodies, receipt handle of message is handle-N, where N is its message ID
+func (f *fakeSQS) queue(bodies ...string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.inFlight == nil {
+		f.inFlight = make(map[string]*fakeMessage)
+	}
+	for _, body := range bodies {
+		f.queued = append(f.queued, &fakeMessage{id: len(f.queued) + len(f.inFlight) + 1, body: body})
+	}
+}
+
+func (f *fakeSQS) messages(queueUrl string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.sent[queueUrl]...)
+}
+
+func (f *fakeSQS) changedVisibility() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.changed...)
+}
+
+func (f *fakeSQS) deletedMessages() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.deleted...)
+}
+
+func (f *fakeSQS) receive() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var result strings.Builder
+	for _, m := range f.queued {
+		m.receives++
+		handle := fmt.Sprintf("handle-%d", m.id)
+		f.inFlight[handle] = m
+		_, _ = fmt.Fprintf(&result, `<Message><MessageId>%d</MessageId><ReceiptHandle>%s</ReceiptHandle>`+
+			`<MD5OfBody>%x</MD5OfBody><Body>%s</Body>`+
+			`<Attribute><Name>ApproximateReceiveCount</Name><Value>%d</Value></Attribute>`,
+			m.id, handle, md5.Sum([]byte(m.body)), html.EscapeString(m.body), m.receives)
+		for name, value := range f.attributes {
+			_, _ = fmt.Fprintf(&result, `<MessageAttribute><Name>%s</Name><Value><DataType>String</DataType>`+
+				`<StringValue>%s</StringValue></Value></MessageAttribute>`, name, html.EscapeString(value))
+		}
+		result.WriteString(`</Message>`)
+	}
+	f.queued = nil
+	return result.String()
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/xml")
+	if atomic.LoadInt32(&f.failing) == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`<ErrorResponse><Error><Type>Receiver</Type><Code>ServiceUnavailable</Code>` +
+			`<Message>down</Message></Error><RequestId>1</RequestId></ErrorResponse>`))
+		return
+	}
+	switch r.FormValue("Action") {
+	case "ReceiveMessage":
+		time.Sleep(5 * time.Millisecond)
+		_, _ = fmt.Fprintf(w, `<ReceiveMessageResponse><ReceiveMessageResult>%s</ReceiveMessageResult></ReceiveMessageResponse>`, f.receive())
+	case "ChangeMessageVisibility":
+		handle := r.FormValue("ReceiptHandle")
+		f.lock.Lock()
+		f.changed = append(f.changed, handle+":"+r.FormValue("VisibilityTimeout"))
+		if m, ok := f.inFlight[handle]; ok {
+			delete(f.inFlight, handle)
+			f.queued = append(f.queued, m)
+		}
+		f.lock.Unlock()
+		_, _ = w.Write([]byte(`<ChangeMessageVisibilityResponse></ChangeMessageVisibilityResponse>`))
+	case "DeleteMessage":
+		handle := r.FormValue("ReceiptHandle")
+		f.lock.Lock()
+		f.deleted = append(f.deleted, handle)
+		delete(f.inFlight, handle)
+		f.lock.Unlock()
+		_, _ = w.Write([]byte(`<DeleteMessageResponse></DeleteMessageResponse>`))
+	case "GetQueueAttributes":
+		_, _ = w.Write([]byte(`<GetQueueAttributesResponse><GetQueueAttributesResult>` +
+			`<Attribute><Name>ApproximateNumberOfMessages</Name><Value>5</Value></Attribute>` +
+			`<Attribute><Name>ApproximateNumberOfMessagesNotVisible</Name><Value>2</Value></Attribute>` +
+			`</GetQueueAttributesResult></GetQueueAttributesResponse>`))
+	case "SendMessage":
+		body := r.FormValue("MessageBody")
+		f.lock.Lock()
+		if f.sent == nil {
+			f.sent = make(map[string][]string)
+		}
+		f.sent[r.FormValue("QueueUrl")] = append(f.sent[r.FormValue("QueueUrl")], body)
+		f.lock.Unlock()
+		_, _ = fmt.Fprintf(w, `<SendMessageResponse><SendMessageResult><MD5OfMessageBody>%x</MD5OfMessageBody>`+
+			`<MessageId>1</MessageId></SendMessageResult></SendMessageResponse>`, md5.Sum([]byte(body)))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// newFakeSQSClient returns client of fake SQS, which is closed once test finishes
+func newFakeSQSClient(t *testing.T, fake *fakeSQS) (*sqs.Client, string) {
+	sqsServer := httptest.NewServer(fake)
+	t.Cleanup(sqsServer.Close)
+	return sqs.New(sqs.Options{
+		Region:           "us-east-1",
+		EndpointResolver: sqs.EndpointResolverFromURL(sqsServer.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		Retryer:          aws.NopRetryer{},
+	}), sqsServer.URL
+}
+
+func TestAdminHandlerReadiness(t *testing.T) {
+	fake := &fakeSQS{}
+	sqsClient, sqsUrl := newFakeSQSClient(t, fake)
+
+	messages := make(chan *message.Any, 8)
+	reader := server.NewReader(sqsClient, sqsUrl+"/queue", messages)
+	reader.UseRetry(retry.Policy{MaxAttempts: 1, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+	processor := server.NewProcessor(messages)
+	handler := server.NewAdminHandler(server.NewNamespaces(0, nil), reader, processor, nil)
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+	readyz := func() int {
+		return get("/readyz").Code
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, readyz())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go processor.Run(ctx, func(*message.Any) error { return nil })
+	go reader.Run(ctx, 0)
+	assert.Eventually(t, func() bool { return readyz() == http.StatusOK }, time.Second, time.Millisecond)
+
+	recorder := get("/stats")
+	var stats struct {
+		Queue struct {
+			Waiting   int `json:"waiting"`
+			InFlight  int `json:"inFlight"`
+			Receivers int `json:"receivers"`
+		} `json:"queue"`
+		Processors struct {
+			Running int  `json:"running"`
+			Ready   bool `json:"ready"`
+		} `json:"processors"`
+	}
+	if assert.Equal(t, http.StatusOK, recorder.Code) && assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &stats)) {
+		assert.Equal(t, 5, stats.Queue.Waiting)
+		assert.Equal(t, 2, stats.Queue.InFlight)
+		assert.Equal(t, 1, stats.Queue.Receivers)
+		assert.Equal(t, 1, stats.Processors.Running)
+		assert.True(t, stats.Processors.Ready)
+	}
+
+	// server isn't ready while SQS fails, and is ready again once it recovers
+	atomic.StoreInt32(&fake.failing, 1)
+	assert.Eventually(t, func() bool { return readyz() == http.StatusServiceUnavailable }, time.Second, time.Millisecond)
+	assert.Contains(t, get("/stats").Body.String(), `"error":`)
+	atomic.StoreInt32(&fake.failing, 0)
+	assert.Eventually(t, func() bool { return readyz() == http.StatusOK }, time.Second, time.Millisecond)
+}
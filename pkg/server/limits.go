@@ -0,0 +1,296 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// Limit restricts number of messages of a principal or to a namespace
+type Limit struct {
+	// Rate is a number of messages per second refilling token bucket, 0 means unlimited rate
+	Rate float64 `json:"rate,omitempty"`
+	// Burst is a capacity of token bucket, i.e. number of messages accepted at once, by default Rate rounded up
+	Burst int `json:"burst,omitempty"`
+	// Daily is a number of messages accepted per UTC day, 0 means no quota
+	Daily int `json:"daily,omitempty"`
+}
+
+// DefaultLimitName in limits applies limit to every principal or namespace not listed explicitly,
+// each of them gets its own token bucket and quota
+const DefaultLimitName = "*"
+
+// Limits define limits per principal and per namespace, message is accepted only if it's within both
+type Limits struct {
+	Principals map[string]Limit `json:"principals"`
+	Namespaces map[string]Limit `json:"namespaces"`
+}
+
+// Scopes of limits
+const (
+	LimitScopePrincipal = "principal"
+	LimitScopeNamespace = "namespace"
+)
+
+// LimitError is returned for message over rate limit or daily quota
+type LimitError struct {
+	// Code is message.CodeRateLimited or message.CodeQuotaExceeded
+	Code message.ErrorCode
+	// Scope is LimitScopePrincipal or LimitScopeNamespace, Name is principal or namespace
+	Scope      string
+	Name       string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %s: %s, retry after %s [%s]", e.Scope, e.Name, e.Reason, e.RetryAfter, e.Code)
+}
+
+// OverLimitAction defines what reader does with messages over limit
+type OverLimitAction string
+
+const (
+	// OverLimitDelay leaves message in queue and makes it visible again once it's expected to be within limits
+	OverLimitDelay = OverLimitAction("delay")
+	// OverLimitReject replies with error if reply is requested and deletes message
+	OverLimitReject = OverLimitAction("reject")
+	// OverLimitDeadLetter moves message to dead-letter queue
+	OverLimitDeadLetter = OverLimitAction("dead-letter")
+)
+
+// ParseOverLimitAction checks over-limit action name
+func ParseOverLimitAction(value string) (OverLimitAction, error) {
+	switch action := OverLimitAction(value); action {
+	case OverLimitDelay, OverLimitReject, OverLimitDeadLetter:
+		return action, nil
+	}
+	return "", fmt.Errorf("unknown over-limit action %q, one of delay, reject, dead-letter expected", value)
+}
+
+// LoadLimits reads limits from JSON file
+func LoadLimits(path string) (*Limits, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLimits(data)
+}
+
+// ParseLimits parses and checks JSON limits
+func ParseLimits(data []byte) (*Limits, error) {
+	var l Limits
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	for name, limit := range l.Principals {
+		if err := limit.check(); err != nil {
+			return nil, fmt.Errorf("principal %q: %w", name, err)
+		}
+	}
+	namespaces := make(map[string]Limit, len(l.Namespaces))
+	for name, limit := range l.Namespaces {
+		if err := limit.check(); err != nil {
+			return nil, fmt.Errorf("namespace %q: %w", name, err)
+		}
+		if name != DefaultLimitName {
+			name = normalizeNamespace(name)
+		}
+		namespaces[name] = limit
+	}
+	l.Namespaces = namespaces
+	return &l, nil
+}
+
+func (l Limit) check() error {
+	if l.Rate < 0 || l.Burst < 0 || l.Daily < 0 {
+		return fmt.Errorf("rate, burst and daily must not be negative")
+	}
+	if l.Burst > 0 && l.Rate == 0 {
+		return fmt.Errorf("burst requires rate")
+	}
+	return nil
+}
+
+// burst returns capacity of token bucket, which is at least 1
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// lookup returns limit of name or default limit
+func lookupLimit(limits map[string]Limit, name string) (Limit, bool) {
+	if limit, ok := limits[name]; ok {
+		return limit, true
+	}
+	limit, ok := limits[DefaultLimitName]
+	return limit, ok
+}
+
+// Limiter accepts messages within rate limits and daily quotas of their principals and namespaces,
+// state is kept in memory, so quotas start over when server is restarted
+type Limiter struct {
+	limits *Limits
+	// authorizer authenticates principals, if set, otherwise principals sent by clients are trusted
+	authorizer *Authorizer
+
+	lock      sync.Mutex
+	counters  map[limitKey]*limitCounter
+	nextPrune time.Time
+}
+
+type limitKey struct {
+	scope string
+	name  string
+}
+
+// limitCounter is a token bucket and a number of messages accepted during the day
+type limitCounter struct {
+	limit   Limit
+	tokens  float64
+	updated time.Time
+	day     int64
+	used    int
+}
+
+// NewLimiter creates limiter enforcing limits
+func NewLimiter(limits *Limits) *Limiter {
+	return &Limiter{
+		limits:   limits,
+		counters: make(map[limitKey]*limitCounter),
+	}
+}
+
+// UseAuthorizer makes limiter count messages of principals authenticated by authorizer's policy,
+// messages with invalid credentials are counted as anonymous ones, so they can't use up quota of other principal
+func (l *Limiter) UseAuthorizer(authorizer *Authorizer) {
+	l.authorizer = authorizer
+}
+
+// Check accepts message at given time or returns *LimitError if message is over limit of its principal or
+// namespace; only accepted messages use up tokens and quotas
+func (l *Limiter) Check(m *message.Any, now time.Time) error {
+	keys := make([]limitKey, 0, 2)
+	limits := make([]Limit, 0, 2)
+	principal := l.principal(m.Credentials)
+	if limit, ok := lookupLimit(l.limits.Principals, principal); ok {
+		keys = append(keys, limitKey{scope: LimitScopePrincipal, name: principal})
+		limits = append(limits, limit)
+	}
+	if m.Operation != message.ListNamespacesOp && m.Operation != message.CapabilitiesOp {
+		namespace := normalizeNamespace(m.Namespace)
+		if limit, ok := lookupLimit(l.limits.Namespaces, namespace); ok {
+			keys = append(keys, limitKey{scope: LimitScopeNamespace, name: namespace})
+			limits = append(limits, limit)
+		}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.prune(now)
+	counters := make([]*limitCounter, len(keys))
+	for i, key := range keys {
+		counters[i] = l.counter(key, limits[i], now)
+		if err := counters[i].check(key, now); err != nil {
+			return err
+		}
+	}
+	for _, c := range counters {
+		c.take()
+	}
+	return nil
+}
+
+func (l *Limiter) principal(credentials message.Credentials) string {
+	if l.authorizer != nil {
+		principal, err := l.authorizer.Authenticate(credentials)
+		if err != nil {
+			return AnonymousPrincipal
+		}
+		return principal
+	}
+	if credentials.Principal == "" {
+		return AnonymousPrincipal
+	}
+	return credentials.Principal
+}
+
+func (l *Limiter) counter(key limitKey, limit Limit, now time.Time) *limitCounter {
+	c, ok := l.counters[key]
+	if !ok {
+		c = &limitCounter{limit: limit, tokens: limit.burst(), updated: now, day: day(now)}
+		l.counters[key] = c
+	}
+	c.refill(now)
+	return c
+}
+
+// prune forgets counters with full buckets and no messages today, so every principal sending messages once
+// doesn't occupy memory forever
+func (l *Limiter) prune(now time.Time) {
+	if now.Before(l.nextPrune) {
+		return
+	}
+	for key, c := range l.counters {
+		c.refill(now)
+		if c.used == 0 && (c.limit.Rate == 0 || c.tokens >= c.limit.burst()) {
+			delete(l.counters, key)
+		}
+	}
+	l.nextPrune = now.Add(time.Minute)
+}
+
+func (c *limitCounter) refill(now time.Time) {
+	if c.limit.Rate > 0 && now.After(c.updated) {
+		c.tokens = math.Min(c.limit.burst(), c.tokens+c.limit.Rate*now.Sub(c.updated).Seconds())
+		c.updated = now
+	}
+	if today := day(now); today != c.day {
+		c.day = today
+		c.used = 0
+	}
+}
+
+func (c *limitCounter) check(key limitKey, now time.Time) error {
+	if c.limit.Daily > 0 && c.used >= c.limit.Daily {
+		return &LimitError{
+			Code:       message.CodeQuotaExceeded,
+			Scope:      key.scope,
+			Name:       key.name,
+			Reason:     fmt.Sprintf("daily quota of %d messages is used up", c.limit.Daily),
+			RetryAfter: time.Unix((c.day+1)*secondsPerDay, 0).Sub(now),
+		}
+	}
+	if c.limit.Rate > 0 && c.tokens < 1 {
+		return &LimitError{
+			Code:       message.CodeRateLimited,
+			Scope:      key.scope,
+			Name:       key.name,
+			Reason:     fmt.Sprintf("rate limit of %g messages per second is exceeded", c.limit.Rate),
+			RetryAfter: time.Duration((1 - c.tokens) / c.limit.Rate * float64(time.Second)),
+		}
+	}
+	return nil
+}
+
+func (c *limitCounter) take() {
+	c.used++
+	if c.limit.Rate > 0 {
+		c.tokens--
+	}
+}
+
+const secondsPerDay = 24 * 60 * 60
+
+// day returns number of UTC day since Unix epoch
+func day(t time.Time) int64 {
+	return t.Unix() / secondsPerDay
+}
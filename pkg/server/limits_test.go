@@ -0,0 +1,130 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+const testLimits = `{
+	"principals": {
+		"*": {"rate": 1, "burst": 2},
+		"batch": {"daily": 3}
+	},
+	"namespaces": {
+		"small": {"rate": 1}
+	}
+}`
+
+func TestLimiter(t *testing.T) {
+	limits, err := server.ParseLimits([]byte(testLimits))
+	if !assert.NoError(t, err) {
+		return
+	}
+	start := time.Date(2026, 10, 19, 23, 59, 0, 0, time.UTC)
+
+	type check struct {
+		principal string
+		namespace string
+		after     time.Duration
+		code      message.ErrorCode
+	}
+	cases := map[string][]check{
+		"burst": {
+			{principal: "teamA"},
+			{principal: "teamA"},
+			{principal: "teamA", code: message.CodeRateLimited},
+			{principal: "teamB"},
+			{principal: "teamA", after: time.Second},
+			{principal: "teamA", code: message.CodeRateLimited},
+		},
+		"anonymous": {
+			{},
+			{},
+			{code: message.CodeRateLimited},
+		},
+		"daily quota": {
+			{principal: "batch"},
+			{principal: "batch"},
+			{principal: "batch"},
+			{principal: "batch", after: 30 * time.Second, code: message.CodeQuotaExceeded},
+			{principal: "batch", after: time.Minute},
+		},
+		"namespace": {
+			{principal: "teamA", namespace: "small"},
+			{principal: "teamB", namespace: "small", code: message.CodeRateLimited},
+			{principal: "teamB", namespace: "large"},
+		},
+		"rejected message doesn't use up tokens": {
+			{principal: "teamA", namespace: "small"},
+			{principal: "teamA", namespace: "small", code: message.CodeRateLimited},
+			{principal: "teamA", namespace: "large"},
+		},
+	}
+
+	for name, checks := range cases {
+		t.Run(name, func(t *testing.T) {
+			limiter := server.NewLimiter(limits)
+			now := start
+			for i, c := range checks {
+				now = now.Add(c.after)
+				msg := &message.Any{
+					Base:        message.NewGet(c.namespace, "1").Base,
+					GetItem:     &message.Get{Key: "1"},
+					Credentials: message.Credentials{Principal: c.principal},
+				}
+				err := limiter.Check(msg, now)
+				var code message.ErrorCode
+				var limitErr *server.LimitError
+				if errors.As(err, &limitErr) {
+					code = limitErr.Code
+					assert.Greater(t, limitErr.RetryAfter, time.Duration(0), "check %d", i+1)
+				}
+				assert.Equal(t, c.code, code, "check %d: %v", i+1, err)
+			}
+		})
+	}
+}
+
+func TestLimiter_Capabilities(t *testing.T) {
+	limits, err := server.ParseLimits([]byte(`{"namespaces": {"*": {"daily": 1}}}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	limiter := server.NewLimiter(limits)
+	capabilities := &message.Any{Base: message.NewCapabilities().Base}
+	now := time.Now()
+	assert.NoError(t, limiter.Check(capabilities, now))
+	assert.NoError(t, limiter.Check(capabilities, now))
+}
+
+func TestParseLimits(t *testing.T) {
+	cases := map[string]string{
+		"invalid JSON":        `{`,
+		"negative rate":       `{"principals": {"a": {"rate": -1}}}`,
+		"negative daily":      `{"namespaces": {"a": {"daily": -1}}}`,
+		"burst without rate":  `{"principals": {"a": {"burst": 10}}}`,
+		"negative burst":      `{"namespaces": {"*": {"rate": 1, "burst": -1}}}`,
+		"string instead rate": `{"principals": {"a": {"rate": "1"}}}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := server.ParseLimits([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseOverLimitAction(t *testing.T) {
+	for _, action := range []string{"delay", "reject", "dead-letter"} {
+		parsed, err := server.ParseOverLimitAction(action)
+		assert.NoError(t, err)
+		assert.Equal(t, server.OverLimitAction(action), parsed)
+	}
+	_, err := server.ParseOverLimitAction("drop")
+	assert.Error(t, err)
+}
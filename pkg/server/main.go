@@ -1,63 +1,131 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"log"
-	"os"
 
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
 	"github.com/yosadchyi/go-client-server/pkg/message"
 )
 
-// NewProcessFn creates new processing function for messages
-func NewProcessFn(id int, storage Storage, logFile *os.File) func(*message.Any) {
+// NewProcessFn creates processing function passing messages to handler, which is usually a Chain of middlewares;
+// it returns error of handler, panic of handler is recovered and returned as *PanicError
+func NewProcessFn(id int, handler Handler) func(*message.Any) error {
 	name := fmt.Sprintf("processor-%d", id)
 
-	return func(m *message.Any) {
-		writeLog(logFile, string(m.Operation))
-		switch {
-		case m.Add != nil:
-			storage.AddItem(Item{
-				K: m.Add.Key,
-				V: m.Add.Data,
-			})
-			log.Printf("%s: adding item %s with key %s", name, m.Add.Data, m.Add.Key)
-			writeLog(logFile, fmt.Sprintf("%s:%s", m.Add.Key, m.Add.Data))
-		case m.Remove != nil:
-			key := m.Remove.Key
-			err := storage.RemoveItem(key)
-			if err != nil {
-				log.Printf("%s: can't remove item with key %s", name, key)
-			} else {
-				log.Printf("%s: removing item with key %s", name, key)
-				writeLog(logFile, m.Remove.Key)
+	return func(m *message.Any) (err error) {
+		ctx := context.WithValue(context.Background(), processingKey{}, &processing{processor: name})
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(ctx, m, r)
 			}
-		case m.GetItem != nil:
-			key := m.GetItem.Key
-			item, err := storage.GetItem(key)
-			if err != nil {
-				log.Printf("%s: can't get item with key %s", name, key)
-			}
-			log.Printf("%s: Get(%s): %s", name, key, item.V)
-			writeLog(logFile, fmt.Sprintf("%s:%s", item.K, item.V))
-		case m.GetAllItems != nil:
-			items := storage.GetAllItems()
-			log.Printf("%s: listing all items:", name)
-			for _, item := range items {
-				log.Printf("%s: (%s, %s)", name, item.K, item.V)
-				writeLog(logFile, fmt.Sprintf("%s:%s", item.K, item.V))
-			}
-		}
+		}()
+		_, err = handler(ctx, m)
+		return err
+	}
+}
+
+type processingKey struct{}
+
+// processing is a state of message shared by middlewares
+type processing struct {
+	processor string
+	// principal is a sender of message authenticated by Authorization
+	principal string
+}
+
+// processingOf returns state of message processed with ctx, or an empty one outside of processing function
+func processingOf(ctx context.Context) *processing {
+	if p, ok := ctx.Value(processingKey{}).(*processing); ok {
+		return p
+	}
+	return &processing{}
+}
+
+// encryptValue encrypts value sent in reply if keyring is used, values encrypted by clients are sent as is
+func encryptValue(keyring *envelope.Keyring, value string, key string) (string, error) {
+	if keyring == nil || envelope.IsEncrypted(value) {
+		return value, nil
 	}
+	return keyring.Encrypt(value, key)
 }
 
-func writeLog(logFile *os.File, logEntry string) {
-	_, err := io.WriteString(logFile, fmt.Sprintf("%s\n", logEntry))
+// messageLogger returns logger with message context attached
+func messageLogger(m *message.Any) *logging.Logger {
+	return logging.Default().With(
+		"operation", m.Operation,
+		"key", m.Key(),
+		"messageId", m.MessageId,
+		"correlationId", m.CorrelationId,
+	)
+}
+
+// processingLogger returns logger with message and processor context attached
+func processingLogger(ctx context.Context, m *message.Any) *logging.Logger {
+	logger := messageLogger(m).With("namespace", normalizeNamespace(m.Namespace))
+	if p := processingOf(ctx); p.processor != "" {
+		logger = logger.With("processor", p.processor)
+	}
+	return logger
+}
+
+// sendReply sends reply with result of operation or error to queue requested in message
+func sendReply(replier *Replier, m *message.Any, result *Result, err error, logger *logging.Logger) {
+	var reply message.Reply
+	if result != nil {
+		reply = result.Reply
+		reply.Status = result.Status
+	}
+	reply.CorrelationId = m.CorrelationId
+	reply.Operation = m.Operation
+	reply.Namespace = normalizeNamespace(m.Namespace)
+	reply.Key = m.Key()
 	if err != nil {
-		log.Printf("error writing log %s", err.Error())
+		reply.Status = message.StatusError
+		reply.Error = err.Error()
+		reply.Code = replyCode(err)
+	} else if reply.Status == "" {
+		reply.Status = message.StatusOk
+	}
+
+	if err := replier.Reply(context.Background(), m.ReplyTo, reply); err != nil {
+		logger.Error("error sending reply", "replyTo", m.ReplyTo, "error", err)
+		return
+	}
+	logger.Debug("reply sent", "replyTo", m.ReplyTo)
+}
+
+// replyCode returns code of validation or access error and internal code of panic, other errors have no code
+func replyCode(err error) message.ErrorCode {
+	var accessErr *AccessError
+	if errors.As(err, &accessErr) {
+		return accessErr.Code
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return message.CodeInternal
+	}
+	var validationErr *message.ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	return ""
+}
+
+// writeRecord writes record to audit journal with result of the operation, unless record has result already
+func writeRecord(auditJournal *journal.Writer, record journal.Record, err error) {
+	switch {
+	case err != nil:
+		record.Result = journal.ResultError
+		record.Error = err.Error()
+	case record.Result == "":
+		record.Result = journal.ResultOk
 	}
 
-	if err := logFile.Sync(); err != nil {
-		log.Printf("error writing log %s", err.Error())
+	if err := auditJournal.Write(record); err != nil {
+		logging.Default().Error("error writing journal", "error", err)
 	}
 }
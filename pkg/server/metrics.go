@@ -0,0 +1,162 @@
+package server
+
+import (
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/metrics"
+)
+
+var lockWaitBuckets = []float64{.000001, .00001, .0001, .001, .01, .1, 1}
+
+var (
+	readerReceived = metrics.DefaultRegistry.NewCounter(
+		"server_reader_messages_received_total",
+		"Number of messages received from SQS.",
+	)
+	readerParsed = metrics.DefaultRegistry.NewCounter(
+		"server_reader_messages_parsed_total",
+		"Number of received messages parsed successfully.",
+	)
+	readerFailed = metrics.DefaultRegistry.NewCounter(
+		"server_reader_messages_failed_total",
+		"Number of received messages which are empty, can't be parsed or have unsupported protocol version.",
+	)
+	readerDeleted = metrics.DefaultRegistry.NewCounter(
+		"server_reader_messages_deleted_total",
+		"Number of messages deleted from SQS after being passed to processors or moved to dead-letter queue.",
+	)
+	readerDeadLettered = metrics.DefaultRegistry.NewCounter(
+		"server_reader_messages_dead_lettered_total",
+		"Number of messages moved to dead-letter queue.",
+	)
+	readerUnauthenticated = metrics.DefaultRegistry.NewCounter(
+		"server_reader_messages_unauthenticated_total",
+		"Number of received messages rejected because of missing or invalid signature, expired timestamp or replay.",
+		"code",
+	)
+	readerLimited = metrics.DefaultRegistry.NewCounter(
+		"server_reader_messages_limited_total",
+		"Number of received messages over rate limit or daily quota of principal or namespace, and action taken.",
+		"scope", "code", "action",
+	)
+	sqsErrors = metrics.DefaultRegistry.NewCounter(
+		"server_sqs_errors_total",
+		"Number of failed SQS API calls.",
+		"call",
+	)
+	sqsRetries = metrics.DefaultRegistry.NewCounter(
+		"server_sqs_retries_total",
+		"Number of retried SQS API calls, class is transient or throttling.",
+		"call", "class",
+	)
+	sqsBreakerOpen = metrics.DefaultRegistry.NewGauge(
+		"server_sqs_breaker_open",
+		"1 while receiving is paused because SQS keeps failing, 0 otherwise.",
+	)
+	poolSize = metrics.DefaultRegistry.NewGauge(
+		"server_pool_size",
+		"Number of processors and receivers run by adaptive scaling, pool is processors or receivers.",
+		"pool",
+	)
+	scalingDecisions = metrics.DefaultRegistry.NewCounter(
+		"server_scaling_decisions_total",
+		"Number of times adaptive scaling resized pool of processors or receivers, direction is up or down.",
+		"pool", "direction",
+	)
+	operations = metrics.DefaultRegistry.NewCounter(
+		"server_operations_total",
+		"Number of processed operations.",
+		"operation", "result",
+	)
+	accessDenied = metrics.DefaultRegistry.NewCounter(
+		"server_access_denied_total",
+		"Number of operations denied by authorization policy, including messages with invalid credentials.",
+		"operation",
+	)
+	processorPanics = metrics.DefaultRegistry.NewCounter(
+		"server_processor_panics_total",
+		"Number of messages which caused panic while being processed.",
+		"operation",
+	)
+	failedMessages = metrics.DefaultRegistry.NewCounter(
+		"server_failed_messages_total",
+		"Number of messages which failed because of panic, action is retry, dead-letter or drop when there is no dead-letter queue.",
+		"action",
+	)
+	operationDuration = metrics.DefaultRegistry.NewHistogram(
+		"server_operation_duration_seconds",
+		"Time spent processing operations.",
+		metrics.DefaultBuckets,
+		"operation",
+	)
+	blobOperations = metrics.DefaultRegistry.NewCounter(
+		"server_blob_operations_total",
+		"Number of blob store operations, result is ok, error or dropped for deletions which didn't fit the queue.",
+		"operation", "result",
+	)
+	compressionBytes = metrics.DefaultRegistry.NewCounter(
+		"server_compression_bytes_total",
+		"Size of compressed messages and values kept compressed in storage, before and after compression; form is compressed or uncompressed.",
+		"target", "form",
+	)
+	storageLockWait = metrics.DefaultRegistry.NewHistogram(
+		"server_storage_lock_wait_seconds",
+		"Time spent waiting for storage lock.",
+		lockWaitBuckets,
+		"mode",
+	)
+)
+
+// RegisterGauges registers gauges reporting occupancy of messages buffer and storage usage per namespace
+func RegisterGauges(registry *metrics.Registry, namespaces *Namespaces, messages MessageChan) {
+	registry.NewGaugeFunc(
+		"server_message_buffer_size",
+		"Number of received messages waiting for processors.",
+		nil,
+		func(set func(float64, ...string)) {
+			set(float64(len(messages)))
+		},
+	)
+	registry.NewGaugeFunc(
+		"server_message_buffer_capacity",
+		"Capacity of received messages buffer.",
+		nil,
+		func(set func(float64, ...string)) {
+			set(float64(cap(messages)))
+		},
+	)
+	registry.NewGaugeFunc(
+		"server_storage_items",
+		"Number of items in storage.",
+		[]string{"namespace"},
+		func(set func(float64, ...string)) {
+			for _, namespace := range namespaces.List() {
+				if storage, ok := namespaces.Lookup(namespace); ok {
+					set(float64(storage.Len()), namespace)
+				}
+			}
+		},
+	)
+	registry.NewGaugeFunc(
+		"server_storage_bytes",
+		"Total size of keys and values in storage.",
+		[]string{"namespace"},
+		func(set func(float64, ...string)) {
+			for _, namespace := range namespaces.List() {
+				if storage, ok := namespaces.Lookup(namespace); ok {
+					set(float64(storage.Size()), namespace)
+				}
+			}
+		},
+	)
+}
+
+func observeOperation(operation message.Operation, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	operations.Inc(string(operation), result)
+	operationDuration.Observe(time.Since(start).Seconds(), string(operation))
+}
@@ -0,0 +1,42 @@
+package server_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/metrics"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestRegisterGauges(t *testing.T) {
+	namespaces := server.NewNamespaces(0, nil)
+	_ = namespaces.Storage("a").AddItem(server.Item{K: "1", V: "A"})
+	_ = namespaces.Storage("a").AddItem(server.Item{K: "22", V: "BB"})
+	_ = namespaces.Storage("b").AddItem(server.Item{K: "333", V: "CCC"})
+
+	messages := make(server.MessageChan, 4)
+	messages <- &message.Any{}
+
+	registry := metrics.NewRegistry()
+	server.RegisterGauges(registry, namespaces, messages)
+
+	var out bytes.Buffer
+	assert.NoError(t, registry.Write(&out))
+	assert.Equal(t, "# HELP server_message_buffer_size Number of received messages waiting for processors.\n"+
+		"# TYPE server_message_buffer_size gauge\n"+
+		"server_message_buffer_size 1\n"+
+		"# HELP server_message_buffer_capacity Capacity of received messages buffer.\n"+
+		"# TYPE server_message_buffer_capacity gauge\n"+
+		"server_message_buffer_capacity 4\n"+
+		"# HELP server_storage_items Number of items in storage.\n"+
+		"# TYPE server_storage_items gauge\n"+
+		"server_storage_items{namespace=\"a\"} 2\n"+
+		"server_storage_items{namespace=\"b\"} 1\n"+
+		"# HELP server_storage_bytes Total size of keys and values in storage.\n"+
+		"# TYPE server_storage_bytes gauge\n"+
+		"server_storage_bytes{namespace=\"a\"} 6\n"+
+		"server_storage_bytes{namespace=\"b\"} 6\n",
+		out.String())
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// Reply sends result of operation or error to queue requested in message, failure of message which is retried
+// is replied only once the last attempt fails
+func Reply(replier *Replier) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *message.Any) (*Result, error) {
+			result, err := next(ctx, m)
+			if m.ReplyTo != "" && !retried(m, err) {
+				sendReply(replier, m, result, err, processingLogger(ctx, m))
+			}
+			return result, err
+		}
+	}
+}
+
+// Metrics counts operations and observes their duration
+func Metrics() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *message.Any) (*Result, error) {
+			start := time.Now()
+			result, err := next(ctx, m)
+			observeOperation(m.Operation, start, err)
+			return result, err
+		}
+	}
+}
+
+// Audit records every operation in audit journal, along with principal authenticated by Authorization;
+// failure of message which is retried is recorded only once the last attempt fails
+func Audit(auditJournal *journal.Writer) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *message.Any) (*Result, error) {
+			result, err := next(ctx, m)
+			if retried(m, err) {
+				return result, err
+			}
+			p := processingOf(ctx)
+			record := journal.Record{
+				Operation:     string(m.Operation),
+				Namespace:     normalizeNamespace(m.Namespace),
+				Key:           m.Key(),
+				Processor:     p.processor,
+				Principal:     p.principal,
+				MessageId:     m.MessageId,
+				CorrelationId: m.CorrelationId,
+			}
+			if result != nil {
+				record.Value = result.Value
+				record.Ref = result.Ref
+				record.Result = string(result.Status)
+			}
+			writeRecord(auditJournal, record, err)
+			return result, err
+		}
+	}
+}
+
+// Timing logs duration of every operation at debug level, and operations slower than threshold as warnings;
+// threshold 0 disables warnings
+func Timing(threshold time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *message.Any) (*Result, error) {
+			start := time.Now()
+			result, err := next(ctx, m)
+			duration := time.Since(start)
+			if threshold > 0 && duration > threshold {
+				processingLogger(ctx, m).Warn("slow operation", "duration", duration, "threshold", threshold)
+			} else {
+				processingLogger(ctx, m).Debug("operation processed", "duration", duration)
+			}
+			return result, err
+		}
+	}
+}
+
+// Recovery turns panic of handler into *PanicError, so it's recorded and replied as any other failure
+func Recovery() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *message.Any) (result *Result, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					result, err = nil, recovered(ctx, m, r)
+				}
+			}()
+			return next(ctx, m)
+		}
+	}
+}
+
+// PanicError is returned for message which caused panic while being processed
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recovered logs panic with stack and counts it, it returns *PanicError describing panic
+func recovered(ctx context.Context, m *message.Any, value interface{}) error {
+	err := &PanicError{Value: value, Stack: debug.Stack()}
+	processorPanics.Inc(string(m.Operation))
+	processingLogger(ctx, m).Error("panic processing message", "panic", value, "stack", string(err.Stack))
+	return err
+}
+
+// retried reports whether message failed because of panic is received again, see Reader.Done
+func retried(m *message.Any, err error) bool {
+	var panicErr *PanicError
+	return m.Retriable && errors.As(err, &panicErr)
+}
+
+// Validation rejects invalid messages, e.g. ones created by embedding code rather than decoded by Reader
+func Validation() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *message.Any) (*Result, error) {
+			if err := m.Validate(); err != nil {
+				processingLogger(ctx, m).Warn("invalid message", "code", message.CodeOf(err), "error", err)
+				return nil, err
+			}
+			return next(ctx, m)
+		}
+	}
+}
+
+// Authorization passes to handler only messages of principals granted their operations by authorizer's policy
+func Authorization(authorizer *Authorizer) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, m *message.Any) (*Result, error) {
+			principal, err := authorizer.Check(m)
+			processingOf(ctx).principal = principal
+			if err != nil {
+				accessDenied.Inc(string(m.Operation))
+				processingLogger(ctx, m).Warn("access denied", "principal", principal, "error", err)
+				return nil, err
+			}
+			return next(ctx, m)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) server.Middleware {
+		return func(next server.Handler) server.Handler {
+			return func(ctx context.Context, m *message.Any) (*server.Result, error) {
+				calls = append(calls, name)
+				return next(ctx, m)
+			}
+		}
+	}
+	handler := server.Chain(func(ctx context.Context, m *message.Any) (*server.Result, error) {
+		calls = append(calls, "handler")
+		return &server.Result{}, nil
+	}, trace("outer"), trace("inner"))
+
+	_, err := handler(context.Background(), getMessage("", "1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner", "handler"}, calls)
+}
+
+func TestHandler(t *testing.T) {
+	namespaces := server.NewNamespaces(0, nil)
+	_ = namespaces.Storage(server.DefaultNamespace).AddItem(server.Item{K: "1", V: "A"})
+	handler := server.NewHandler(namespaces, server.HandlerOptions{})
+	ctx := context.Background()
+
+	result, err := handler(ctx, getMessage("", "1"))
+	if assert.NoError(t, err) && assert.NotNil(t, result.Reply.Value) {
+		assert.Equal(t, "A", *result.Reply.Value)
+		assert.Empty(t, result.Value)
+	}
+
+	_, err = handler(ctx, getMessage("", "2"))
+	assert.Error(t, err)
+	_, err = handler(ctx, getMessage("other", "1"))
+	assert.Error(t, err)
+
+	add := message.NewAdd("", "1", "B")
+	add.OnConflict = message.ConflictSkip
+	result, err = handler(ctx, &message.Any{Base: add.Base, Add: &add})
+	if assert.NoError(t, err) {
+		assert.Equal(t, message.StatusSkipped, result.Status)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	handler := server.Chain(func(ctx context.Context, m *message.Any) (*server.Result, error) {
+		panic("boom")
+	}, server.Recovery())
+
+	result, err := handler(context.Background(), getMessage("", "1"))
+	assert.Nil(t, result)
+	assert.EqualError(t, err, "panic: boom")
+	var panicErr *server.PanicError
+	if assert.True(t, errors.As(err, &panicErr)) {
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+}
+
+func TestNewProcessFn_Panic(t *testing.T) {
+	// panic outside of Recovery middleware doesn't stop processor either
+	processFn := server.NewProcessFn(1, func(ctx context.Context, m *message.Any) (*server.Result, error) {
+		var item *server.Item
+		return &server.Result{Value: item.V}, nil
+	})
+
+	err := processFn(getMessage("", "1"))
+	var panicErr *server.PanicError
+	assert.True(t, errors.As(err, &panicErr), "%v", err)
+}
+
+func TestValidation(t *testing.T) {
+	called := false
+	handler := server.Chain(func(ctx context.Context, m *message.Any) (*server.Result, error) {
+		called = true
+		return &server.Result{}, nil
+	}, server.Validation())
+
+	_, err := handler(context.Background(), getMessage("", "key with spaces"))
+	assert.Equal(t, message.CodeInvalidCharacters, message.CodeOf(err))
+	assert.False(t, called)
+}
+
+func TestAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := journal.NewWriter(file, journal.SyncNever, 0)
+
+	namespaces := server.NewNamespaces(0, nil)
+	_ = namespaces.Storage(server.DefaultNamespace).AddItem(server.Item{K: "1", V: "A"})
+	handler := server.Chain(server.NewHandler(namespaces, server.HandlerOptions{}), server.Audit(w))
+	processFn := server.NewProcessFn(1, handler)
+	processFn(getMessage("", "1"))
+	processFn(getMessage("", "2"))
+	assert.NoError(t, w.Close())
+
+	records := readRecords(t, path)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, journal.ResultOk, records[0].Result)
+		assert.Empty(t, records[0].Value, "read values aren't journaled")
+		assert.Equal(t, "processor-1", records[0].Processor)
+		assert.Equal(t, journal.ResultError, records[1].Result)
+		assert.Equal(t, "key `2' not found", records[1].Error)
+	}
+}
+
+func getMessage(namespace, key string) *message.Any {
+	get := message.NewGet(namespace, key)
+	return &message.Any{Base: get.Base, GetItem: &get}
+}
+
+func TestAudit_Retriable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := journal.NewWriter(file, journal.SyncNever, 0)
+
+	handler := server.Chain(func(ctx context.Context, m *message.Any) (*server.Result, error) {
+		panic("boom")
+	}, server.Audit(w), server.Recovery())
+	processFn := server.NewProcessFn(1, handler)
+	// failure of message which is received again isn't journaled until the last attempt
+	retriable := getMessage("", "1")
+	retriable.Retriable = true
+	assert.Error(t, processFn(retriable))
+	assert.Error(t, processFn(getMessage("", "1")))
+	assert.NoError(t, w.Close())
+
+	records := readRecords(t, path)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "panic: boom", records[0].Error)
+	}
+}
+
+// readRecords returns all records of journal file
+func readRecords(t *testing.T, path string) []journal.Record {
+	f, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer f.Close()
+	r := journal.NewReader(f)
+	var records []journal.Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records
+		}
+		if !assert.NoError(t, err) {
+			return records
+		}
+		records = append(records, record)
+	}
+}
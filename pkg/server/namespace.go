@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultNamespace is used for messages which do not specify namespace
+const DefaultNamespace = "default"
+
+// Namespaces routes operations to isolated storages, one per namespace
+type Namespaces struct {
+	lock            sync.RWMutex
+	storages        map[string]*rwLockedStorage
+	defaultMaxItems int
+	maxItems        map[string]int
+	// blobs are released when items referencing them are removed or replaced
+	blobs *Blobs
+	// compressThreshold is a length of value above which it's kept compressed, 0 disables compression
+	compressThreshold int
+}
+
+// NewNamespaces creates new namespace registry, storages are created lazily on first write;
+// maxItems defines per-namespace item limits overriding defaultMaxItems, zero limit means unlimited
+func NewNamespaces(defaultMaxItems int, maxItems map[string]int) *Namespaces {
+	return &Namespaces{
+		storages:        make(map[string]*rwLockedStorage),
+		defaultMaxItems: defaultMaxItems,
+		maxItems:        maxItems,
+	}
+}
+
+// UseBlobs makes items owners of blobs they reference and storages release blobs of removed and replaced items,
+// blob referenced by another item can't be added; it must be called before storages are created,
+// so before journal is replayed
+func (n *Namespaces) UseBlobs(blobs *Blobs) {
+	n.blobs = blobs
+}
+
+// UseCompression makes storages keep values longer than threshold compressed, it must be called before storages are created
+func (n *Namespaces) UseCompression(threshold int) {
+	n.compressThreshold = threshold
+}
+
+// Storage returns storage for given namespace, creating it if necessary
+func (n *Namespaces) Storage(namespace string) Storage {
+	namespace = normalizeNamespace(namespace)
+
+	if storage, ok := n.Lookup(namespace); ok {
+		return storage
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	// storage could be created while we were waiting for the lock
+	if storage, ok := n.storages[namespace]; ok {
+		return storage
+	}
+
+	var storage Storage = NewMemoryStorage()
+	if n.blobs != nil {
+		storage = NewBlobRefStorage(storage, namespace, n.blobs)
+	}
+	if n.compressThreshold > 0 {
+		storage = NewCompressedStorage(storage, n.compressThreshold)
+	}
+	if limit := n.limit(namespace); limit > 0 {
+		storage = NewLimitedStorage(storage, limit)
+	}
+	locked := NewRWLockedStorage(storage)
+	n.storages[namespace] = locked
+
+	return locked
+}
+
+// Lookup returns storage for given namespace if it exists
+func (n *Namespaces) Lookup(namespace string) (Storage, bool) {
+	n.lock.RLock()
+	storage, ok := n.storages[normalizeNamespace(namespace)]
+	n.lock.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return storage, true
+}
+
+// List returns sorted names of existing namespaces
+func (n *Namespaces) List() []string {
+	n.lock.RLock()
+	result := make([]string, 0, len(n.storages))
+	for namespace := range n.storages {
+		result = append(result, namespace)
+	}
+	n.lock.RUnlock()
+
+	sort.Strings(result)
+
+	return result
+}
+
+// Drop removes namespace with all its items
+func (n *Namespaces) Drop(namespace string) error {
+	namespace = normalizeNamespace(namespace)
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	storage, ok := n.storages[namespace]
+	if !ok {
+		return namespaceNotFound(namespace)
+	}
+	delete(n.storages, namespace)
+
+	// storage can still be held by operations looked it up before, so it rejects their writes from now on
+	storage.drop(func(item Item) {
+		n.blobs.releaseOwned(item.Ref, blobOwner{namespace: namespace, key: item.K})
+	})
+
+	return nil
+}
+
+func (n *Namespaces) limit(namespace string) int {
+	if limit, ok := n.maxItems[namespace]; ok {
+		return limit
+	}
+	return n.defaultMaxItems
+}
+
+func namespaceNotFound(namespace string) error {
+	return fmt.Errorf("namespace `%s' not found", namespace)
+}
+
+func normalizeNamespace(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
+}
@@ -0,0 +1,110 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestNamespaces(t *testing.T) {
+	cases := map[string]struct {
+		limits             map[string]int
+		scenario           func(namespaces *server.Namespaces) error
+		expectedError      error
+		expectedNamespaces []string
+		expectedItems      map[string][]server.Item
+	}{
+		"Same key in different namespaces": {
+			scenario: func(namespaces *server.Namespaces) error {
+				_ = namespaces.Storage("a").AddItem(server.Item{K: "1", V: "A"})
+				return namespaces.Storage("b").AddItem(server.Item{K: "1", V: "B"})
+			},
+			expectedNamespaces: []string{"a", "b"},
+			expectedItems: map[string][]server.Item{
+				"a": {{K: "1", V: "A"}},
+				"b": {{K: "1", V: "B"}},
+			},
+		},
+		"Empty namespace is a default one": {
+			scenario: func(namespaces *server.Namespaces) error {
+				return namespaces.Storage("").AddItem(server.Item{K: "1", V: "A"})
+			},
+			expectedNamespaces: []string{server.DefaultNamespace},
+			expectedItems: map[string][]server.Item{
+				server.DefaultNamespace: {{K: "1", V: "A"}},
+			},
+		},
+		"Adding item over the limit": {
+			limits: map[string]int{"a": 1},
+			scenario: func(namespaces *server.Namespaces) error {
+				_ = namespaces.Storage("a").AddItem(server.Item{K: "1", V: "A"})
+				return namespaces.Storage("a").AddItem(server.Item{K: "2", V: "B"})
+			},
+			expectedError:      server.ErrLimitExceeded,
+			expectedNamespaces: []string{"a"},
+			expectedItems: map[string][]server.Item{
+				"a": {{K: "1", V: "A"}},
+			},
+		},
+		"Replacing item at the limit": {
+			limits: map[string]int{"a": 1},
+			scenario: func(namespaces *server.Namespaces) error {
+				_ = namespaces.Storage("a").AddItem(server.Item{K: "1", V: "A"})
+				return namespaces.Storage("a").AddItem(server.Item{K: "1", V: "B"})
+			},
+			expectedNamespaces: []string{"a"},
+			expectedItems: map[string][]server.Item{
+				"a": {{K: "1", V: "B"}},
+			},
+		},
+		"Dropping namespace": {
+			scenario: func(namespaces *server.Namespaces) error {
+				_ = namespaces.Storage("a").AddItem(server.Item{K: "1", V: "A"})
+				_ = namespaces.Storage("b").AddItem(server.Item{K: "1", V: "B"})
+				return namespaces.Drop("a")
+			},
+			expectedNamespaces: []string{"b"},
+			expectedItems: map[string][]server.Item{
+				"b": {{K: "1", V: "B"}},
+			},
+		},
+		"Writing to storage of dropped namespace": {
+			scenario: func(namespaces *server.Namespaces) error {
+				storage := namespaces.Storage("a")
+				_ = namespaces.Drop("a")
+				return storage.AddItem(server.Item{K: "1", V: "A"})
+			},
+			expectedError:      server.ErrNamespaceDropped,
+			expectedNamespaces: []string{},
+		},
+		"Dropping non existing namespace": {
+			scenario: func(namespaces *server.Namespaces) error {
+				return namespaces.Drop("a")
+			},
+			expectedError:      errors.New("namespace `a' not found"),
+			expectedNamespaces: []string{},
+			expectedItems:      map[string][]server.Item{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			namespaces := server.NewNamespaces(0, tc.limits)
+			err := tc.scenario(namespaces)
+			if tc.expectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, tc.expectedError, err)
+			}
+			assert.Equal(t, tc.expectedNamespaces, namespaces.List())
+			for namespace, items := range tc.expectedItems {
+				storage, ok := namespaces.Lookup(namespace)
+				if assert.True(t, ok) {
+					assert.Equal(t, items, storage.GetAllItems())
+				}
+			}
+		})
+	}
+}
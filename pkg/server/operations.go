@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// Env gives operation handlers access to storage and collaborators of handler
+type Env struct {
+	Namespaces *Namespaces
+	// Blobs resolve values offloaded by clients, values can't be resolved if it's nil
+	Blobs *Blobs
+	// Keyring decrypts and encrypts values, values are stored as sent if it's nil
+	Keyring *envelope.Keyring
+}
+
+// Lookup returns existing storage of namespace, it fails if namespace doesn't exist
+func (e *Env) Lookup(namespace string) (Storage, error) {
+	namespace = normalizeNamespace(namespace)
+	storage, ok := e.Namespaces.Lookup(namespace)
+	if !ok {
+		return nil, namespaceNotFound(namespace)
+	}
+	return storage, nil
+}
+
+// OperationHandler performs operation requested by message, it logs what it does with logger of
+// processingLogger, values are never logged, since they may contain personal data
+type OperationHandler func(ctx context.Context, env *Env, m *message.Any) (*Result, error)
+
+// ReplayFunc applies journal record of successful operation to storage, it reports whether record modified storage
+type ReplayFunc func(env *Env, record journal.Record) (bool, error)
+
+// OperationSpec describes how server performs operation, messages of operation must be registered
+// with message.RegisterOperation too
+type OperationSpec struct {
+	Operation message.Operation
+	Handler   OperationHandler
+	// Permission is required by policy to perform operation, operation is allowed to everyone if it's empty
+	Permission Permission
+	// Replay restores effect of operation when storage is restored from journal, nil for operations
+	// which don't modify storage
+	Replay ReplayFunc
+}
+
+var operationRegistry = struct {
+	lock  sync.RWMutex
+	specs map[message.Operation]OperationSpec
+}{specs: make(map[message.Operation]OperationSpec)}
+
+// RegisterOperation makes operation available to NewHandler, Policy and Replay; it panics if operation is
+// registered twice or has no handler
+func RegisterOperation(spec OperationSpec) {
+	if spec.Operation == "" || spec.Handler == nil {
+		panic("server: operation and Handler are required")
+	}
+	operationRegistry.lock.Lock()
+	defer operationRegistry.lock.Unlock()
+
+	if _, exists := operationRegistry.specs[spec.Operation]; exists {
+		panic(fmt.Sprintf("server: operation %s is registered twice", spec.Operation))
+	}
+	operationRegistry.specs[spec.Operation] = spec
+}
+
+// CheckOperations checks that every operation known to codecs can be performed by server and every operation
+// of server can be decoded, so that registrations missing in either registry are found on startup
+func CheckOperations() error {
+	operationRegistry.lock.RLock()
+	defer operationRegistry.lock.RUnlock()
+
+	var missing []string
+	for _, operation := range message.Operations(message.ProtocolVersion) {
+		if _, ok := operationRegistry.specs[operation]; !ok {
+			missing = append(missing, fmt.Sprintf("%s has no server.OperationSpec", operation))
+		}
+	}
+	for operation := range operationRegistry.specs {
+		if _, ok := message.LookupOperation(operation); !ok {
+			missing = append(missing, fmt.Sprintf("%s has no message.OperationSpec", operation))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("operations aren't registered: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func lookupOperation(operation message.Operation) (OperationSpec, bool) {
+	operationRegistry.lock.RLock()
+	defer operationRegistry.lock.RUnlock()
+
+	spec, ok := operationRegistry.specs[operation]
+	return spec, ok
+}
+
+func init() {
+	RegisterOperation(OperationSpec{Operation: message.AddOp, Handler: addItem, Permission: PermissionAdd, Replay: replayAdd})
+	RegisterOperation(OperationSpec{Operation: message.RemoveOp, Handler: removeItem, Permission: PermissionRemove, Replay: replayRemove})
+	RegisterOperation(OperationSpec{Operation: message.GetItemOp, Handler: getItem, Permission: PermissionGet})
+	RegisterOperation(OperationSpec{Operation: message.GetAllItemsOp, Handler: getAllItems, Permission: PermissionGetAll})
+	RegisterOperation(OperationSpec{Operation: message.ListNamespacesOp, Handler: listNamespaces, Permission: PermissionAdmin})
+	RegisterOperation(OperationSpec{Operation: message.DropNamespaceOp, Handler: dropNamespace, Permission: PermissionAdmin, Replay: replayDrop})
+	RegisterOperation(OperationSpec{Operation: message.CapabilitiesOp, Handler: capabilities})
+}
+
+func addItem(ctx context.Context, env *Env, m *message.Any) (*Result, error) {
+	logger := processingLogger(ctx, m)
+	result := &Result{Value: m.Add.Data, Ref: m.Add.DataRef}
+	item := Item{
+		K:   m.Add.Key,
+		V:   m.Add.Data,
+		Ref: m.Add.DataRef,
+	}
+	var err error
+	if item.Ref != "" {
+		item.V, err = env.Blobs.Get(ctx, item.Ref)
+		if err != nil {
+			logger.Warn("can't resolve value", "ref", item.Ref, "error", err)
+			return nil, err
+		}
+	}
+	if env.Keyring != nil && envelope.IsEncrypted(item.V) {
+		item.V, err = env.Keyring.Decrypt(item.V, item.K)
+		if err != nil {
+			logger.Warn("can't decrypt value", "error", err)
+			env.Blobs.Release(item.Ref)
+			return nil, err
+		}
+	}
+	storage := env.Namespaces.Storage(m.Namespace)
+	switch m.Add.OnConflict {
+	case message.ConflictSkip, message.ConflictFail:
+		err = storage.AddNewItem(item)
+	default:
+		err = storage.AddItem(item)
+	}
+	switch {
+	case err == ErrKeyExists && m.Add.OnConflict == message.ConflictSkip:
+		result.Status = message.StatusSkipped
+		logger.Info("skipping existing item")
+		env.Blobs.Release(item.Ref)
+	case err != nil:
+		logger.Warn("can't add item", "error", err)
+		env.Blobs.Release(item.Ref)
+		return nil, err
+	case item.Ref != "":
+		logger.Info("adding item", "ref", item.Ref, "size", len(item.V))
+	default:
+		logger.Info("adding item", "size", len(item.V))
+	}
+	return result, nil
+}
+
+func removeItem(ctx context.Context, env *Env, m *message.Any) (*Result, error) {
+	logger := processingLogger(ctx, m)
+	storage, err := env.Lookup(m.Namespace)
+	if err == nil {
+		err = storage.RemoveItem(m.Remove.Key)
+	}
+	if err != nil {
+		logger.Warn("can't remove item", "error", err)
+		return nil, err
+	}
+	logger.Info("removing item")
+	return &Result{}, nil
+}
+
+func getItem(ctx context.Context, env *Env, m *message.Any) (*Result, error) {
+	logger := processingLogger(ctx, m)
+	storage, err := env.Lookup(m.Namespace)
+	var item *Item
+	if err == nil {
+		item, err = storage.GetItem(m.GetItem.Key)
+	}
+	if err != nil {
+		logger.Warn("can't get item", "error", err)
+		return nil, err
+	}
+
+	// value isn't recorded in audit journal, so reads don't copy values there
+	result := &Result{}
+	if item.Ref != "" {
+		logger.Info("getting item", "ref", item.Ref)
+	} else {
+		logger.Info("getting item", "size", len(item.V))
+	}
+	if item.Ref != "" && message.AtLeast(m.Version, message.Version21) {
+		result.Reply.ValueRef = item.Ref
+		return result, nil
+	}
+	value, err := encryptValue(env.Keyring, item.V, item.K)
+	if err != nil {
+		logger.Warn("can't encrypt value", "error", err)
+		return nil, err
+	}
+	result.Reply.Value = &value
+	return result, nil
+}
+
+func getAllItems(ctx context.Context, env *Env, m *message.Any) (*Result, error) {
+	logger := processingLogger(ctx, m)
+	storage, err := env.Lookup(m.Namespace)
+	if err != nil {
+		logger.Warn("can't list items", "error", err)
+		return nil, err
+	}
+	items := storage.GetAllItems()
+	logger.Info("listing all items", "count", len(items))
+	result := &Result{}
+	result.Reply.Items = make([]message.Item, 0, len(items))
+	for _, item := range items {
+		if item.Ref != "" {
+			logger.Info("listing item", "key", item.K, "ref", item.Ref)
+		} else {
+			logger.Info("listing item", "key", item.K, "size", len(item.V))
+		}
+		if item.Ref != "" && message.AtLeast(m.Version, message.Version21) {
+			result.Reply.Items = append(result.Reply.Items, message.Item{Key: item.K, Ref: item.Ref})
+			continue
+		}
+		value, err := encryptValue(env.Keyring, item.V, item.K)
+		if err != nil {
+			logger.Warn("can't encrypt value", "key", item.K, "error", err)
+			return nil, err
+		}
+		result.Reply.Items = append(result.Reply.Items, message.Item{Key: item.K, Value: value})
+	}
+	return result, nil
+}
+
+func listNamespaces(ctx context.Context, env *Env, m *message.Any) (*Result, error) {
+	result := &Result{}
+	result.Reply.Namespaces = env.Namespaces.List()
+	processingLogger(ctx, m).Info("listing namespaces", "namespaces", strings.Join(result.Reply.Namespaces, ","))
+	return result, nil
+}
+
+func dropNamespace(ctx context.Context, env *Env, m *message.Any) (*Result, error) {
+	logger := processingLogger(ctx, m)
+	if err := env.Namespaces.Drop(normalizeNamespace(m.Namespace)); err != nil {
+		logger.Warn("can't drop namespace", "error", err)
+		return nil, err
+	}
+	logger.Info("dropping namespace")
+	return &Result{}, nil
+}
+
+func capabilities(ctx context.Context, env *Env, m *message.Any) (*Result, error) {
+	protocol := message.SupportedProtocol()
+	processingLogger(ctx, m).Info("reporting capabilities", "version", protocol.Version)
+	return &Result{Reply: message.Reply{Protocol: &protocol}}, nil
+}
+
+func replayAdd(env *Env, record journal.Record) (bool, error) {
+	item := Item{K: record.Key, V: record.Value, Ref: record.Ref}
+	if item.Ref != "" {
+		value, err := env.Blobs.Get(context.Background(), item.Ref)
+		if err != nil {
+			return false, fmt.Errorf("can't resolve value %s: %w", item.Ref, err)
+		}
+		item.V = value
+	}
+	if env.Keyring != nil && envelope.IsEncrypted(item.V) {
+		value, err := env.Keyring.Decrypt(item.V, item.K)
+		if err != nil {
+			return false, fmt.Errorf("can't decrypt value: %w", err)
+		}
+		item.V = value
+	}
+	return true, env.Namespaces.Storage(record.Namespace).AddItem(item)
+}
+
+func replayRemove(env *Env, record journal.Record) (bool, error) {
+	storage, err := env.Lookup(record.Namespace)
+	if err != nil {
+		return false, err
+	}
+	return true, storage.RemoveItem(record.Key)
+}
+
+func replayDrop(env *Env, record journal.Record) (bool, error) {
+	return true, env.Namespaces.Drop(record.Namespace)
+}
@@ -0,0 +1,95 @@
+package server_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+	"github.com/yosadchyi/go-client-server/pkg/util"
+)
+
+const countOp = message.Operation("Count")
+
+// count is a custom operation replying with number of items in namespace
+type count struct {
+	message.Base
+}
+
+func (m count) ToJSON() (string, error) {
+	return util.ToJSON(m)
+}
+
+func init() {
+	message.RegisterOperation(message.OperationSpec{
+		Operation: countOp,
+		Decode: func(f message.Fields) message.Message {
+			return count{Base: f.Base}
+		},
+		Encode: func(msg message.Message) message.Fields {
+			return message.Fields{Base: msg.Meta()}
+		},
+	})
+	server.RegisterOperation(server.OperationSpec{
+		Operation: countOp,
+		Handler: func(ctx context.Context, env *server.Env, m *message.Any) (*server.Result, error) {
+			storage, err := env.Lookup(m.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			value := strconv.Itoa(storage.Len())
+			return &server.Result{Reply: message.Reply{Value: &value}}, nil
+		},
+		Permission: server.PermissionGetAll,
+	})
+}
+
+func TestRegisterOperation(t *testing.T) {
+	namespaces := server.NewNamespaces(0, nil)
+	_ = namespaces.Storage("teamA").AddItem(server.Item{K: "1", V: "A"})
+	_ = namespaces.Storage("teamA").AddItem(server.Item{K: "2", V: "B"})
+	handler := server.NewHandler(namespaces, server.HandlerOptions{})
+
+	body, err := message.JSONCodec.Encode(count{Base: message.Base{Version: message.ProtocolVersion, Operation: countOp, Namespace: "teamA"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, err := message.JSONCodec.Decode(body)
+	if !assert.NoError(t, err) {
+		return
+	}
+	result, err := handler(context.Background(), msg)
+	if assert.NoError(t, err) && assert.NotNil(t, result.Reply.Value) {
+		assert.Equal(t, "2", *result.Reply.Value)
+	}
+
+	policy, err := server.ParsePolicy([]byte(`{"grants": [{"principals": ["anonymous"], "permissions": ["getall"], "namespaces": ["teamA"]}]}`))
+	if assert.NoError(t, err) {
+		assert.NoError(t, policy.Authorize(server.AnonymousPrincipal, countOp, "teamA", ""))
+		assert.Error(t, policy.Authorize(server.AnonymousPrincipal, countOp, "teamB", ""))
+		// operations unknown to server require admin permission
+		assert.Error(t, policy.Authorize(server.AnonymousPrincipal, "Unknown", "teamA", ""))
+	}
+
+	_, err = handler(context.Background(), &message.Any{Base: message.Base{Operation: "Unknown"}})
+	assert.Equal(t, message.CodeUnknownOperation, message.CodeOf(err))
+}
+
+// registerOrphan registers server operation without message operation once, since registries can't be cleared
+var registerOrphan sync.Once
+
+func TestCheckOperations(t *testing.T) {
+	registerOrphan.Do(func() {
+		assert.NoError(t, server.CheckOperations())
+		server.RegisterOperation(server.OperationSpec{
+			Operation: "Orphan",
+			Handler: func(ctx context.Context, env *server.Env, m *message.Any) (*server.Result, error) {
+				return &server.Result{}, nil
+			},
+		})
+	})
+	assert.EqualError(t, server.CheckOperations(), "operations aren't registered: Orphan has no message.OperationSpec")
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// Permission is a group of operations granted by policy
+type Permission string
+
+const (
+	PermissionAdd    = Permission("add")
+	PermissionRemove = Permission("remove")
+	PermissionGet    = Permission("get")
+	PermissionGetAll = Permission("getall")
+	// PermissionAdmin grants ListNamespaces and DropNamespace
+	PermissionAdmin = Permission("admin")
+)
+
+const (
+	// AnonymousPrincipal is a principal of messages without credentials
+	AnonymousPrincipal = "anonymous"
+	// AnyPrincipal in grant matches all authenticated principals, but not anonymous one
+	AnyPrincipal = "*"
+)
+
+// Policy defines principals and operations granted to them
+type Policy struct {
+	Principals map[string]PrincipalPolicy `json:"principals"`
+	Grants     []Grant                    `json:"grants"`
+	// apiKeys maps SHA-256 of API keys to principals
+	apiKeys map[string]string
+}
+
+// PrincipalPolicy defines how principal is authenticated
+type PrincipalPolicy struct {
+	// ApiKeySHA256 is hex encoded SHA-256 of principal's API key, so policy file doesn't reveal API keys
+	ApiKeySHA256 string `json:"apiKeySha256,omitempty"`
+	// SigningKeyIds are IDs of signing keys principal's messages may be signed with
+	SigningKeyIds []string `json:"signingKeyIds,omitempty"`
+}
+
+// Grant allows operations to principals in namespaces on keys with prefixes
+type Grant struct {
+	Principals  []string     `json:"principals"`
+	Permissions []Permission `json:"permissions"`
+	// Namespaces limit grant to given namespaces, all namespaces are matched if empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// KeyPrefixes limit grant to keys with given prefixes, all keys are matched if empty; grant with prefixes
+	// doesn't allow operations on all keys of namespace, i.e. getall and admin ones
+	KeyPrefixes []string `json:"keyPrefixes,omitempty"`
+}
+
+// AccessError is returned when message can't be authenticated or operation isn't granted
+type AccessError struct {
+	// Code is message.CodeUnauthenticated or message.CodeForbidden
+	Code      message.ErrorCode
+	Principal string
+	Reason    string
+}
+
+func (e *AccessError) Error() string {
+	if e.Principal == "" {
+		return fmt.Sprintf("%s [%s]", e.Reason, e.Code)
+	}
+	return fmt.Sprintf("%s: %s [%s]", e.Principal, e.Reason, e.Code)
+}
+
+// LoadPolicy reads policy from JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses and checks JSON policy
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+
+	p.apiKeys = make(map[string]string)
+	for name, principal := range p.Principals {
+		if name == AnonymousPrincipal || name == AnyPrincipal {
+			return nil, fmt.Errorf("principal %q is reserved", name)
+		}
+		if principal.ApiKeySHA256 == "" {
+			continue
+		}
+		hash := strings.ToLower(principal.ApiKeySHA256)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("principal %q: apiKeySha256 must be hex encoded SHA-256", name)
+		}
+		if other, ok := p.apiKeys[hash]; ok {
+			return nil, fmt.Errorf("principals %q and %q have the same API key", other, name)
+		}
+		p.apiKeys[hash] = name
+	}
+
+	for i, grant := range p.Grants {
+		if len(grant.Principals) == 0 || len(grant.Permissions) == 0 {
+			return nil, fmt.Errorf("grant %d: principals and permissions are required", i+1)
+		}
+		for _, name := range grant.Principals {
+			if _, ok := p.Principals[name]; !ok && name != AnonymousPrincipal && name != AnyPrincipal {
+				return nil, fmt.Errorf("grant %d: unknown principal %q", i+1, name)
+			}
+		}
+		for _, permission := range grant.Permissions {
+			switch permission {
+			case PermissionAdd, PermissionRemove, PermissionGet, PermissionGetAll, PermissionAdmin:
+			default:
+				return nil, fmt.Errorf("grant %d: unknown permission %q", i+1, permission)
+			}
+		}
+		for j, namespace := range grant.Namespaces {
+			p.Grants[i].Namespaces[j] = normalizeNamespace(namespace)
+		}
+	}
+
+	return &p, nil
+}
+
+// Authenticate returns principal identified by credentials: principal of API key, principal allowed to sign
+// with verified key, or AnonymousPrincipal if there are no credentials
+func (p *Policy) Authenticate(credentials message.Credentials) (string, error) {
+	if credentials.ApiKey != "" {
+		hash := sha256.Sum256([]byte(credentials.ApiKey))
+		principal, ok := p.apiKeys[hex.EncodeToString(hash[:])]
+		if !ok {
+			return "", &AccessError{Code: message.CodeUnauthenticated, Principal: credentials.Principal, Reason: "unknown API key"}
+		}
+		if credentials.Principal != "" && subtle.ConstantTimeCompare([]byte(credentials.Principal), []byte(principal)) != 1 {
+			return "", &AccessError{Code: message.CodeUnauthenticated, Principal: credentials.Principal, Reason: "API key belongs to another principal"}
+		}
+		return principal, nil
+	}
+
+	if credentials.Principal == "" {
+		return AnonymousPrincipal, nil
+	}
+	if credentials.SigningKeyId == "" {
+		return "", &AccessError{Code: message.CodeUnauthenticated, Principal: credentials.Principal, Reason: "principal requires signature or API key"}
+	}
+	if principal, ok := p.Principals[credentials.Principal]; ok {
+		for _, keyId := range principal.SigningKeyIds {
+			if keyId == credentials.SigningKeyId {
+				return credentials.Principal, nil
+			}
+		}
+	}
+	return "", &AccessError{
+		Code:      message.CodeUnauthenticated,
+		Principal: credentials.Principal,
+		Reason:    fmt.Sprintf("principal can't sign messages with key %q", credentials.SigningKeyId),
+	}
+}
+
+// Authorize checks that principal is granted operation in namespace on key, Capabilities is allowed to everyone
+func (p *Policy) Authorize(principal string, operation message.Operation, namespace, key string) error {
+	permission, ok := operationPermission(operation)
+	if !ok {
+		return nil
+	}
+	namespace = normalizeNamespace(namespace)
+	if operation == message.ListNamespacesOp {
+		// names of all namespaces are listed, so grant must not be limited to namespaces
+		namespace = ""
+	}
+	for _, grant := range p.Grants {
+		if grant.matches(principal, permission, namespace, key) {
+			return nil
+		}
+	}
+	return &AccessError{
+		Code:      message.CodeForbidden,
+		Principal: principal,
+		Reason:    fmt.Sprintf("%s of %s isn't granted in namespace %s", permission, key, namespace),
+	}
+}
+
+func (g *Grant) matches(principal string, permission Permission, namespace, key string) bool {
+	if !containsPrincipal(g.Principals, principal) || !containsPermission(g.Permissions, permission) {
+		return false
+	}
+	if len(g.Namespaces) > 0 && (namespace == "" || !contains(g.Namespaces, namespace)) {
+		return false
+	}
+	if len(g.KeyPrefixes) == 0 {
+		return true
+	}
+	if permission == PermissionGetAll || permission == PermissionAdmin {
+		return false
+	}
+	for _, prefix := range g.KeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// operationPermission returns permission required by operation, it reports false for operations allowed to everyone;
+// operations unknown to server require admin permission
+func operationPermission(operation message.Operation) (Permission, bool) {
+	spec, ok := lookupOperation(operation)
+	if !ok {
+		return PermissionAdmin, true
+	}
+	return spec.Permission, spec.Permission != ""
+}
+
+func containsPrincipal(principals []string, principal string) bool {
+	if principal != AnonymousPrincipal && contains(principals, AnyPrincipal) {
+		return true
+	}
+	return contains(principals, principal)
+}
+
+func containsPermission(permissions []Permission, permission Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer checks messages against policy which can be reloaded while messages are processed
+type Authorizer struct {
+	path   string
+	lock   sync.RWMutex
+	policy *Policy
+}
+
+// NewAuthorizer loads policy from file at path
+func NewAuthorizer(path string) (*Authorizer, error) {
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Authorizer{path: path, policy: policy}, nil
+}
+
+// Reload reads policy file again, current policy is kept if the file is invalid
+func (a *Authorizer) Reload() error {
+	policy, err := LoadPolicy(a.path)
+	if err != nil {
+		return err
+	}
+	a.lock.Lock()
+	a.policy = policy
+	a.lock.Unlock()
+	return nil
+}
+
+// Authenticate returns principal identified by credentials according to current policy
+func (a *Authorizer) Authenticate(credentials message.Credentials) (string, error) {
+	return a.currentPolicy().Authenticate(credentials)
+}
+
+// Check authenticates sender of message and authorizes its operation, it returns principal along with
+// *AccessError if access is denied
+func (a *Authorizer) Check(m *message.Any) (string, error) {
+	return a.Allow(m.Credentials, m.Operation, m.Namespace, m.Key())
+}
+
+// Allow authenticates credentials and authorizes operation in namespace on key, it returns principal along with
+// *AccessError if access is denied
+func (a *Authorizer) Allow(credentials message.Credentials, operation message.Operation, namespace, key string) (string, error) {
+	policy := a.currentPolicy()
+	principal, err := policy.Authenticate(credentials)
+	if err != nil {
+		return credentials.Principal, err
+	}
+	return principal, policy.Authorize(principal, operation, namespace, key)
+}
+
+func (a *Authorizer) currentPolicy() *Policy {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.policy
+}
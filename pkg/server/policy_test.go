@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+// API key of teamA is secret-a
+const testPolicy = `{
+	"principals": {
+		"teamA": {"apiKeySha256": "8766b9cb08e6040b704f1e3ee1e186efccf2635b1d2634d6525333007e6aeae1"},
+		"orders": {"signingKeyIds": ["2026-10"]},
+		"ops": {"signingKeyIds": ["ops"]}
+	},
+	"grants": [
+		{"principals": ["teamA"], "permissions": ["add", "remove", "get", "getall"], "namespaces": ["teamA"]},
+		{"principals": ["orders"], "permissions": ["add", "get"], "namespaces": ["teamA"], "keyPrefixes": ["orders/"]},
+		{"principals": ["orders"], "permissions": ["getall"], "keyPrefixes": ["orders/"]},
+		{"principals": ["ops"], "permissions": ["admin"]},
+		{"principals": ["*"], "permissions": ["get"], "namespaces": ["public"]},
+		{"principals": ["anonymous"], "permissions": ["get"], "namespaces": [""]}
+	]
+}`
+
+func TestPolicy(t *testing.T) {
+	policy, err := server.ParsePolicy([]byte(testPolicy))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	teamA := message.Credentials{ApiKey: "secret-a"}
+	orders := message.Credentials{Principal: "orders", SigningKeyId: "2026-10"}
+	ops := message.Credentials{Principal: "ops", SigningKeyId: "ops"}
+	anonymous := message.Credentials{}
+
+	cases := map[string]struct {
+		credentials message.Credentials
+		msg         message.Message
+		code        message.ErrorCode
+	}{
+		"API key":                    {credentials: teamA, msg: message.NewRemove("teamA", "1")},
+		"API key of principal":       {credentials: message.Credentials{Principal: "teamA", ApiKey: "secret-a"}, msg: message.NewGetAll("teamA")},
+		"API key of other principal": {credentials: message.Credentials{Principal: "ops", ApiKey: "secret-a"}, msg: message.NewGet("teamA", "1"), code: message.CodeUnauthenticated},
+		"unknown API key":            {credentials: message.Credentials{ApiKey: "secret-b"}, msg: message.NewGet("teamA", "1"), code: message.CodeUnauthenticated},
+		"other namespace":            {credentials: teamA, msg: message.NewGet("teamB", "1"), code: message.CodeForbidden},
+		"not granted operation":      {credentials: teamA, msg: message.NewDropNamespace("teamA"), code: message.CodeForbidden},
+		"signed principal":           {credentials: orders, msg: message.NewAdd("teamA", "orders/1", "")},
+		"unsigned principal":         {credentials: message.Credentials{Principal: "orders"}, msg: message.NewGet("teamA", "orders/1"), code: message.CodeUnauthenticated},
+		"key of other principal":     {credentials: message.Credentials{Principal: "orders", SigningKeyId: "ops"}, msg: message.NewGet("teamA", "orders/1"), code: message.CodeUnauthenticated},
+		"key prefix":                 {credentials: orders, msg: message.NewAdd("teamA", "users/1", ""), code: message.CodeForbidden},
+		"getall with key prefix":     {credentials: orders, msg: message.NewGetAll("teamA"), code: message.CodeForbidden},
+		"admin":                      {credentials: ops, msg: message.NewDropNamespace("teamA")},
+		"list namespaces":            {credentials: ops, msg: message.NewListNamespaces()},
+		"any principal":              {credentials: orders, msg: message.NewGet("public", "1")},
+		"anonymous isn't any":        {credentials: anonymous, msg: message.NewGet("public", "1"), code: message.CodeForbidden},
+		"anonymous":                  {credentials: anonymous, msg: message.NewGet("", "1")},
+		"capabilities":               {credentials: anonymous, msg: message.NewCapabilities()},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			meta := c.msg.Meta()
+			principal, err := policy.Authenticate(c.credentials)
+			if err == nil {
+				err = policy.Authorize(principal, meta.Operation, meta.Namespace, anyKey(c.msg))
+			}
+			var code message.ErrorCode
+			var accessErr *server.AccessError
+			if errors.As(err, &accessErr) {
+				code = accessErr.Code
+			}
+			assert.Equal(t, c.code, code, "%v", err)
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	cases := map[string]string{
+		"invalid JSON":       `{`,
+		"reserved principal": `{"principals": {"anonymous": {}}}`,
+		"invalid hash":       `{"principals": {"a": {"apiKeySha256": "abc"}}}`,
+		"unknown principal":  `{"grants": [{"principals": ["a"], "permissions": ["get"]}]}`,
+		"unknown permission": `{"grants": [{"principals": ["*"], "permissions": ["read"]}]}`,
+		"no permissions":     `{"grants": [{"principals": ["*"]}]}`,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := server.ParsePolicy([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAuthorizer_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"grants": [{"principals": ["anonymous"], "permissions": ["get"]}]}`), 0600))
+	authorizer, err := server.NewAuthorizer(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	get := &message.Any{Base: message.NewGet("", "1").Base, GetItem: &message.Get{Key: "1"}}
+	principal, err := authorizer.Check(get)
+	assert.Equal(t, server.AnonymousPrincipal, principal)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"grants": [{"principals": ["anonymous"], "permissions": ["add"]}]}`), 0600))
+	assert.NoError(t, authorizer.Reload())
+	_, err = authorizer.Check(get)
+	assert.Error(t, err)
+
+	// invalid policy doesn't replace current one
+	assert.NoError(t, os.WriteFile(path, []byte(`{`), 0600))
+	assert.Error(t, authorizer.Reload())
+	_, err = authorizer.Check(&message.Any{Base: message.NewAdd("", "1", "").Base, Add: &message.Add{Key: "1"}})
+	assert.NoError(t, err)
+}
+
+func anyKey(msg message.Message) string {
+	switch m := msg.(type) {
+	case message.Add:
+		return m.Key
+	case message.Remove:
+		return m.Key
+	case message.Get:
+		return m.Key
+	}
+	return ""
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool runs variable number of workers, e.g. processing or receiving loops; workers are numbered from 1,
+// shrinking pool stops workers with the highest numbers
+type Pool struct {
+	ctx context.Context
+	run func(ctx context.Context, id int)
+
+	lock sync.Mutex
+	// cancels stop workers, worker with number N is stopped by cancels[N-1]
+	cancels []context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewPool creates empty pool of workers running run, all workers are stopped once ctx is done
+func NewPool(ctx context.Context, run func(ctx context.Context, id int)) *Pool {
+	return &Pool{ctx: ctx, run: run}
+}
+
+// Resize starts or stops workers, so size of them are running; stopped workers finish what they are doing first
+func (p *Pool) Resize(size int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for len(p.cancels) < size {
+		ctx, cancel := context.WithCancel(p.ctx)
+		p.cancels = append(p.cancels, cancel)
+		id := len(p.cancels)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run(ctx, id)
+		}()
+	}
+	for len(p.cancels) > size {
+		last := len(p.cancels) - 1
+		p.cancels[last]()
+		p.cancels = p.cancels[:last]
+	}
+}
+
+// Size returns number of workers which aren't stopped
+func (p *Pool) Size() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return len(p.cancels)
+}
+
+// Wait waits until all started workers return
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
@@ -2,14 +2,29 @@ package server
 
 import (
 	"context"
-	"log"
+	"sync/atomic"
+	"time"
 
+	"github.com/yosadchyi/go-client-server/pkg/logging"
 	"github.com/yosadchyi/go-client-server/pkg/message"
 )
 
+// Acknowledger is told about result of every processed message, see Reader.Done
+type Acknowledger interface {
+	// Done is called with error returned by processing function, nil if message is processed successfully
+	Done(msg *message.Any, err error)
+}
+
 // Processor allows to process incoming messages with given processing function
 type Processor struct {
-	messages MessageChan
+	// processed and busy are numbers of processed messages and nanoseconds spent processing them, they are
+	// accessed atomically, so they go first to be aligned on 32-bit platforms
+	processed int64
+	busy      int64
+	messages  MessageChan
+	running   int32
+	// acknowledger is told about processed messages, if set
+	acknowledger Acknowledger
 }
 
 // NewProcessor creates new processor
@@ -19,15 +34,44 @@ func NewProcessor(messages MessageChan) *Processor {
 	}
 }
 
-// Run runs processing, can be stopped with context's cancel function
-func (s *Processor) Run(ctx context.Context, processFn func(*message.Any)) {
+// UseAcknowledger makes processor report result of every message to acknowledger
+func (s *Processor) UseAcknowledger(acknowledger Acknowledger) {
+	s.acknowledger = acknowledger
+}
+
+// Run runs processing, can be stopped with context's cancel function; it also returns once messages channel
+// is closed and all buffered messages are processed, so closing it after receivers stop drains the buffer
+func (s *Processor) Run(ctx context.Context, processFn func(*message.Any) error) {
+	atomic.AddInt32(&s.running, 1)
+	defer atomic.AddInt32(&s.running, -1)
+
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("shutting down processor")
+			logging.Default().Info("shutting down processor")
 			return
-		case msg := <-s.messages:
-			processFn(msg)
+		case msg, ok := <-s.messages:
+			if !ok {
+				logging.Default().Info("messages drained, shutting down processor")
+				return
+			}
+			start := time.Now()
+			err := processFn(msg)
+			atomic.AddInt64(&s.busy, int64(time.Since(start)))
+			atomic.AddInt64(&s.processed, 1)
+			if s.acknowledger != nil {
+				s.acknowledger.Done(msg, err)
+			}
 		}
 	}
 }
+
+// Running returns number of currently running processing loops
+func (s *Processor) Running() int {
+	return int(atomic.LoadInt32(&s.running))
+}
+
+// Processed returns number of messages processed by all loops so far and total time spent processing them
+func (s *Processor) Processed() (int, time.Duration) {
+	return int(atomic.LoadInt64(&s.processed)), time.Duration(atomic.LoadInt64(&s.busy))
+}
@@ -0,0 +1,69 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+type acknowledgements struct {
+	lock sync.Mutex
+	done map[string]error
+	wg   sync.WaitGroup
+}
+
+func (a *acknowledgements) Done(msg *message.Any, err error) {
+	a.lock.Lock()
+	a.done[msg.MessageId] = err
+	a.lock.Unlock()
+	a.wg.Done()
+}
+
+func TestProcessor_Acknowledger(t *testing.T) {
+	messages := make(server.MessageChan, 2)
+	processor := server.NewProcessor(messages)
+	ack := &acknowledgements{done: make(map[string]error)}
+	processor.UseAcknowledger(ack)
+
+	failure := errors.New("failure")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go processor.Run(ctx, func(m *message.Any) error {
+		if m.Key() == "fail" {
+			return failure
+		}
+		return nil
+	})
+
+	ack.wg.Add(2)
+	ok := getMessage("", "ok")
+	ok.MessageId = "1"
+	failed := getMessage("", "fail")
+	failed.MessageId = "2"
+	messages <- ok
+	messages <- failed
+	ack.wg.Wait()
+
+	assert.Equal(t, map[string]error{"1": nil, "2": failure}, ack.done)
+}
+
+func TestProcessor_Drain(t *testing.T) {
+	messages := make(server.MessageChan, 3)
+	processor := server.NewProcessor(messages)
+	for _, key := range []string{"1", "2", "3"} {
+		messages <- getMessage("", key)
+	}
+	close(messages)
+
+	var processed []string
+	processor.Run(context.Background(), func(m *message.Any) error {
+		processed = append(processed, m.Key())
+		return nil
+	})
+	assert.Equal(t, []string{"1", "2", "3"}, processed)
+}
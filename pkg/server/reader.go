@@ -2,11 +2,19 @@ package server
 
 import (
 	"context"
-	"log"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
 	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
 )
 
 // Reader is responsible for reading ordered from SQS and passing it to messages channel
@@ -14,6 +22,30 @@ type Reader struct {
 	sqsClient *sqs.Client
 	queueUrl  string
 	messages  MessageChan
+	ready     int32
+	running   int32
+	// deadLetters receive messages which can't be processed, if set
+	deadLetters *DeadLetters
+	// replier reports invalid messages to clients, if set
+	replier *Replier
+	// verifier checks signatures of messages, if set, unsigned messages are rejected
+	verifier *message.Verifier
+	// limiter accepts messages within limits of their principals and namespaces, if set
+	limiter   *Limiter
+	overLimit OverLimitAction
+	// maxAttempts is a number of receives of message which fails because of panic before it's moved to
+	// dead-letter queue; if it's 0, messages are deleted as soon as they are passed to processors
+	maxAttempts int
+	// pending are messages passed to processors and waiting for Done, mapped by SQS message IDs
+	pending sync.Map
+	// limited counts receives of messages delayed over limit by SQS message IDs, they aren't attempts to process
+	// messages, so they are subtracted from receive counts
+	limitedLock sync.Mutex
+	limited     map[string]limitedReceives
+	// retry defines how failed SQS calls are retried, and delays between failed receives
+	retry retry.Policy
+	// breaker pauses receiving while SQS keeps failing, if set
+	breaker *retry.Breaker
 }
 
 // NewReader creates new reader
@@ -22,51 +54,562 @@ func NewReader(sqsClient *sqs.Client, queueUrl string, messages MessageChan) *Re
 		sqsClient: sqsClient,
 		queueUrl:  queueUrl,
 		messages:  messages,
+		retry:     retry.DefaultPolicy,
+		limited:   make(map[string]limitedReceives),
 	}
 }
 
-// Run runs reading, can be stopped with context's cancel function
+// UseDeadLetters makes reader move invalid messages to dead-letter queue, otherwise they are left in queue
+func (s *Reader) UseDeadLetters(deadLetters *DeadLetters) {
+	s.deadLetters = deadLetters
+}
+
+// UseReplier makes reader reply with error to invalid messages which request reply
+func (s *Reader) UseReplier(replier *Replier) {
+	s.replier = replier
+}
+
+// UseVerifier makes reader reject messages which aren't signed with one of active keys, expired or replayed
+func (s *Reader) UseVerifier(verifier *message.Verifier) {
+	s.verifier = verifier
+}
+
+// UseLimiter makes reader pass to processors only messages within limits, messages over limit are handled
+// according to action
+func (s *Reader) UseLimiter(limiter *Limiter, action OverLimitAction) {
+	s.limiter = limiter
+	s.overLimit = action
+}
+
+// UseAcknowledgements makes reader delete messages only once they are processed, see Done; message failing
+// because of panic is received again up to maxAttempts times and moved to dead-letter queue afterwards.
+// KeepPending must be run too, so messages aren't received again while they wait for processors
+func (s *Reader) UseAcknowledgements(maxAttempts int) {
+	s.maxAttempts = maxAttempts
+}
+
+// UseRetry makes reader retry failed deletions and visibility changes according to policy, and wait between
+// failed receives for policy's delays; retry.DefaultPolicy is used by default
+func (s *Reader) UseRetry(policy retry.Policy) {
+	s.retry = policy
+}
+
+// UseBreaker makes reader pause receiving for breaker's cooldown once receives keep failing, e.g. during outage
+func (s *Reader) UseBreaker(breaker *retry.Breaker) {
+	s.breaker = breaker
+}
+
+// Run runs reading, can be stopped with context's cancel function; failed receives are followed by
+// growing delays, so reader doesn't spin while SQS is unreachable
 func (s *Reader) Run(ctx context.Context, waitTimeSeconds int32) {
+	atomic.AddInt32(&s.running, 1)
+	defer atomic.AddInt32(&s.running, -1)
+
+	failures := 0
 	for {
+		if s.breaker != nil {
+			if wait := s.breaker.Wait(time.Now()); wait > 0 && retry.Sleep(ctx, wait) != nil {
+				logging.Default().Info("stopping SQS reader")
+				return
+			}
+		}
 		select {
 		case <-ctx.Done():
-			log.Printf("stopping SQS reader")
+			logging.Default().Info("stopping SQS reader")
 			return
 		default:
-			s.receiveMessages(waitTimeSeconds)
+		}
+
+		err := s.receiveMessages(ctx, waitTimeSeconds)
+		if ctx.Err() != nil {
+			logging.Default().Info("stopping SQS reader")
+			return
+		}
+		if err == nil {
+			s.received(failures)
+			failures = 0
+			continue
+		}
+		failures++
+		if s.breaker == nil {
+			atomic.StoreInt32(&s.ready, 0)
+		} else if s.breaker.Failure(time.Now()) {
+			atomic.StoreInt32(&s.ready, 0)
+			sqsBreakerOpen.Set(1)
+			logging.Default().Warn("SQS keeps failing, pausing receiving", "failures", failures)
+			continue
+		}
+		delay := s.retry.Delay(failures, retry.Classify(err))
+		logging.Default().Debug("waiting before next receive", "failures", failures, "delay", delay)
+		if retry.Sleep(ctx, delay) != nil {
+			logging.Default().Info("stopping SQS reader")
+			return
 		}
 	}
 }
 
-func (s *Reader) receiveMessages(waitTimeSeconds int32) {
-	out, err := s.sqsClient.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String(s.queueUrl),
-		MaxNumberOfMessages: 10,
-		WaitTimeSeconds:     waitTimeSeconds,
-	})
+// received closes breaker after successful receive, failures is a number of receives failed before it
+func (s *Reader) received(failures int) {
+	if s.breaker == nil || failures == 0 {
+		return
+	}
+	if s.breaker.Open() {
+		sqsBreakerOpen.Set(0)
+		logging.Default().Info("SQS recovered, resuming receiving", "failures", failures)
+	}
+	s.breaker.Success()
+}
+
+// receiveMessages receives messages and passes them to processors; once ctx is done, messages which weren't
+// passed yet are made visible in queue again, so they are received by another server
+func (s *Reader) receiveMessages(ctx context.Context, waitTimeSeconds int32) error {
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(s.queueUrl),
+		MaxNumberOfMessages:   10,
+		WaitTimeSeconds:       waitTimeSeconds,
+		MessageAttributeNames: []string{"All"},
+		AttributeNames:        []types.QueueAttributeName{types.QueueAttributeName(types.MessageSystemAttributeNameApproximateReceiveCount)},
+	}
+	if s.maxAttempts > 0 {
+		input.VisibilityTimeout = int32(pendingVisibility / time.Second)
+	}
+	out, err := s.sqsClient.ReceiveMessage(ctx, input)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
-		log.Printf("error receiving message %s", err)
+		sqsErrors.Inc("ReceiveMessage")
+		logging.Default().Error("error receiving message", "class", retry.Classify(err), "error", err)
+		return err
 	}
+	atomic.StoreInt32(&s.ready, 1)
 
-	for _, m := range out.Messages {
+	for i, m := range out.Messages {
+		readerReceived.Inc()
+		logger := logging.Default().With("messageId", aws.ToString(m.MessageId))
 		if m.Body == nil {
-			log.Print("received message with empty body")
+			readerFailed.Inc()
+			logger.Warn("received message with empty body")
+			continue
+		}
+		attributes := stringAttributes(m)
+		if err := s.verify(m, attributes); err != nil {
+			readerFailed.Inc()
+			readerUnauthenticated.Inc(string(message.CodeOf(err)))
+			logger.Warn("unauthenticated message", "code", message.CodeOf(err), "error", err)
+			s.reject(m, err, logger)
 			continue
 		}
-		msg, err := message.AnyFromJSON(*m.Body)
+		msg, err := decodeMessage(m)
 		if err != nil {
-			log.Printf("error parsing message: %s", err)
+			readerFailed.Inc()
+			if msg != nil {
+				msg.MessageId = aws.ToString(m.MessageId)
+				logger = messageLogger(msg)
+				s.replyInvalid(msg, err, logger)
+			}
+			logger.Warn("invalid message", "code", message.CodeOf(err), "error", err)
+			s.reject(m, err, logger)
 			continue
 		}
-		s.messages <- msg
+		msg.MessageId = aws.ToString(m.MessageId)
+		msg.Credentials = message.CredentialsFromAttributes(attributes)
+		if s.verifier != nil {
+			msg.Credentials.SigningKeyId = attributes[message.SignatureKeyIdAttribute]
+		}
+		readerParsed.Inc()
+		if !s.withinLimits(m, msg) {
+			continue
+		}
+		messageLogger(msg).Debug("message received")
+		if s.maxAttempts > 0 {
+			msg.Retriable = s.attempts(m) < s.maxAttempts
+			s.pending.Store(msg.MessageId, m)
+		}
+		select {
+		case s.messages <- msg:
+		case <-ctx.Done():
+			s.pending.Delete(msg.MessageId)
+			s.release(out.Messages[i:])
+			return ctx.Err()
+		}
+		if s.maxAttempts == 0 {
+			s.deleteMessage(m, messageLogger(msg))
+		}
+	}
+	return nil
+}
 
-		_, err = s.sqsClient.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
-			QueueUrl:      aws.String(s.queueUrl),
-			ReceiptHandle: m.ReceiptHandle,
+// release makes messages visible in queue again instead of waiting for their visibility timeout
+func (s *Reader) release(messages []types.Message) {
+	for _, m := range messages {
+		s.delay(m, 0, logging.Default().With("messageId", aws.ToString(m.MessageId)))
+	}
+}
+
+// retryDelay is a delay before message failed because of panic is received again, multiplied by number of attempts
+const retryDelay = 10 * time.Second
+
+// pendingVisibility is visibility timeout of messages waiting for Done, KeepPending extends it every
+// pendingHeartbeat, so messages waiting in buffer or processed slowly aren't received again
+const (
+	pendingVisibility = 60 * time.Second
+	pendingHeartbeat  = 20 * time.Second
+)
+
+// maxBatchEntries is a maximal number of entries in SQS batch request
+const maxBatchEntries = 10
+
+// KeepPending extends visibility timeout of messages passed to processors until they are Done, it must be run
+// along with UseAcknowledgements and can be stopped with context's cancel function
+func (s *Reader) KeepPending(ctx context.Context) {
+	ticker := time.NewTicker(pendingHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.extendPending(ctx)
+			s.forgetLimited(time.Now())
+		}
+	}
+}
+
+// extendPending resets visibility timeout of pending messages to pendingVisibility
+func (s *Reader) extendPending(ctx context.Context) {
+	var entries []types.ChangeMessageVisibilityBatchRequestEntry
+	s.pending.Range(func(_, value interface{}) bool {
+		entries = append(entries, types.ChangeMessageVisibilityBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(len(entries))),
+			ReceiptHandle:     value.(types.Message).ReceiptHandle,
+			VisibilityTimeout: int32(pendingVisibility / time.Second),
+		})
+		return true
+	})
+
+	for len(entries) > 0 {
+		batch := entries
+		if len(batch) > maxBatchEntries {
+			batch = batch[:maxBatchEntries]
+		}
+		entries = entries[len(batch):]
+
+		var out *sqs.ChangeMessageVisibilityBatchOutput
+		err := callSQS(ctx, s.retry, "ChangeMessageVisibilityBatch", func(ctx context.Context) error {
+			var err error
+			out, err = s.sqsClient.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+				QueueUrl: aws.String(s.queueUrl),
+				Entries:  batch,
+			})
+			return err
 		})
 		if err != nil {
-			log.Printf("error deleting message: %s", err)
+			logging.Default().Error("error extending visibility of pending messages", "count", len(batch), "error", err)
 			continue
 		}
+		// messages which were Done meanwhile fail, since they are deleted already
+		for _, failed := range out.Failed {
+			logging.Default().Debug("visibility of pending message isn't extended", "code", aws.ToString(failed.Code), "reason", aws.ToString(failed.Message))
+		}
+	}
+}
+
+// Done deletes processed message from queue, unless it failed because of panic: such message is left in queue
+// to be received again after delay, and once it's received maxAttempts times it's moved to dead-letter queue,
+// or deleted if dead-letter queue isn't used.
+// Other errors are reported to clients by processors, so messages failed with them are deleted too
+func (s *Reader) Done(msg *message.Any, err error) {
+	value, ok := s.pending.LoadAndDelete(msg.MessageId)
+	if !ok {
+		return
+	}
+	m := value.(types.Message)
+	logger := messageLogger(msg)
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		s.deleteMessage(m, logger)
+		return
+	}
+
+	attempts := s.attempts(m)
+	delay := time.Duration(attempts) * retryDelay
+	if attempts < s.maxAttempts && !s.expiresWhileDelayed(m, delay) {
+		failedMessages.Inc("retry")
+		logger.Warn("message failed, it will be retried", "attempts", attempts, "delay", delay, "error", err)
+		s.delay(m, delay, logger)
+		return
+	}
+
+	reason := "message failed too many times"
+	if attempts < s.maxAttempts {
+		// signature would be rejected as expired once message is received again
+		reason = "message failed, its signature expires before it can be retried"
+	}
+	if s.deadLetters == nil {
+		// without dead-letter queue the message would be received again forever
+		failedMessages.Inc("drop")
+		logger.Error(reason+", deleting it", "attempts", attempts, "error", err)
+		s.deleteMessage(m, logger)
+		return
+	}
+	failedMessages.Inc("dead-letter")
+	logger.Warn(reason, "attempts", attempts, "error", err)
+	s.reject(m, err, logger)
+}
+
+// receiveCount returns number of times message was received, including the current one
+func receiveCount(m types.Message) int {
+	count, _ := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	return count
+}
+
+type limitedReceives struct {
+	count int
+	last  time.Time
+}
+
+// attempts returns number of times message was received to be processed, including the current one;
+// receives after which message was delayed over limit by this reader aren't counted
+func (s *Reader) attempts(m types.Message) int {
+	s.limitedLock.Lock()
+	limited := s.limited[aws.ToString(m.MessageId)].count
+	s.limitedLock.Unlock()
+	if attempts := receiveCount(m) - limited; attempts > 1 {
+		return attempts
+	}
+	return 1
+}
+
+// countLimited records receive of message which is delayed over limit
+func (s *Reader) countLimited(m types.Message) {
+	s.limitedLock.Lock()
+	defer s.limitedLock.Unlock()
+	id := aws.ToString(m.MessageId)
+	s.limited[id] = limitedReceives{count: s.limited[id].count + 1, last: time.Now()}
+}
+
+// forgetLimited forgets receives of messages delayed over limit which can't be received again by now,
+// e.g. because they were received by another server
+func (s *Reader) forgetLimited(now time.Time) {
+	s.limitedLock.Lock()
+	defer s.limitedLock.Unlock()
+	for id, limited := range s.limited {
+		if now.Sub(limited.last) > maxVisibilityTimeout*time.Second+pendingVisibility {
+			delete(s.limited, id)
+		}
+	}
+}
+
+// reject moves invalid message to dead-letter queue if it's used
+func (s *Reader) reject(m types.Message, reason error, logger *logging.Logger) {
+	if s.deadLetters == nil {
+		return
+	}
+	if err := s.deadLetters.Send(context.Background(), m, errorCode(reason), reason.Error()); err != nil {
+		logger.Error("error sending message to dead-letter queue", "error", err)
+		return
+	}
+	readerDeadLettered.Inc()
+	logger.Info("message moved to dead-letter queue", "reason", reason)
+	s.deleteMessage(m, logger)
+}
+
+// replyInvalid sends error to client if message requests reply
+func (s *Reader) replyInvalid(msg *message.Any, reason error, logger *logging.Logger) {
+	if s.replier == nil || msg.ReplyTo == "" {
+		return
+	}
+	reply := message.Reply{
+		CorrelationId: msg.CorrelationId,
+		Operation:     msg.Operation,
+		Namespace:     msg.Namespace,
+		Key:           msg.Key(),
+		Status:        message.StatusError,
+		Error:         reason.Error(),
+		Code:          errorCode(reason),
+	}
+	if err := s.replier.Reply(context.Background(), msg.ReplyTo, reply); err != nil {
+		logger.Error("error sending reply", "replyTo", msg.ReplyTo, "error", err)
+	}
+}
+
+// withinLimits checks message against limiter, message over limit is delayed, rejected or moved to dead-letter queue
+func (s *Reader) withinLimits(m types.Message, msg *message.Any) bool {
+	if s.limiter == nil {
+		return true
+	}
+	err := s.limiter.Check(msg, time.Now())
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		return true
+	}
+	logger := messageLogger(msg)
+	action := s.overLimit
+	if action == OverLimitDelay && s.expiresWhileDelayed(m, limitErr.RetryAfter) {
+		// signature would be rejected as expired once message is received again
+		action = OverLimitReject
+	}
+	readerLimited.Inc(limitErr.Scope, string(limitErr.Code), string(action))
+	logger.Warn("message over limit", "scope", limitErr.Scope, "name", limitErr.Name, "code", limitErr.Code,
+		"retryAfter", limitErr.RetryAfter, "action", action)
+	switch action {
+	case OverLimitReject:
+		s.replyInvalid(msg, err, logger)
+		s.deleteMessage(m, logger)
+	case OverLimitDeadLetter:
+		s.reject(m, err, logger)
+	default:
+		if s.maxAttempts > 0 {
+			s.countLimited(m)
+		}
+		s.delay(m, limitErr.RetryAfter, logger)
+	}
+	return false
+}
+
+// expiresWhileDelayed reports whether signature of message expires before message is received again after delay
+func (s *Reader) expiresWhileDelayed(m types.Message, delay time.Duration) bool {
+	if s.verifier == nil {
+		return false
+	}
+	expires, ok := s.verifier.Expires(stringAttributes(m))
+	return ok && time.Now().Add(delay).After(expires)
+}
+
+// maxVisibilityTimeout is the longest visibility timeout SQS allows, in seconds
+const maxVisibilityTimeout = 12 * 60 * 60
+
+// delay makes message visible in queue again after given time instead of deleting it
+func (s *Reader) delay(m types.Message, after time.Duration, logger *logging.Logger) {
+	seconds := int32(math.Min(math.Max(1, math.Ceil(after.Seconds())), maxVisibilityTimeout))
+	err := callSQS(context.Background(), s.retry, "ChangeMessageVisibility", func(ctx context.Context) error {
+		_, err := s.sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(s.queueUrl),
+			ReceiptHandle:     m.ReceiptHandle,
+			VisibilityTimeout: seconds,
+		})
+		return err
+	})
+	if err != nil {
+		logger.Error("error delaying message", "error", err)
+	}
+}
+
+func (s *Reader) deleteMessage(m types.Message, logger *logging.Logger) {
+	err := callSQS(context.Background(), s.retry, "DeleteMessage", func(ctx context.Context) error {
+		_, err := s.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(s.queueUrl),
+			ReceiptHandle: m.ReceiptHandle,
+		})
+		return err
+	})
+	if err != nil {
+		logger.Error("error deleting message", "error", err)
+		return
+	}
+	readerDeleted.Inc()
+	s.limitedLock.Lock()
+	delete(s.limited, aws.ToString(m.MessageId))
+	s.limitedLock.Unlock()
+}
+
+// verify checks signature of message if verifier is used; message isn't decoded before, so reply isn't sent
+// to address specified by unauthenticated sender
+func (s *Reader) verify(m types.Message, attributes map[string]string) error {
+	if s.verifier == nil {
+		return nil
+	}
+	return s.verifier.Verify(aws.ToString(m.MessageId), attributes, *m.Body, time.Now())
+}
+
+// errorCode returns code of validation, access or limit error, or internal code of panic
+func errorCode(err error) message.ErrorCode {
+	var accessErr *AccessError
+	if errors.As(err, &accessErr) {
+		return accessErr.Code
+	}
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.Code
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return message.CodeInternal
+	}
+	return message.CodeOf(err)
+}
+
+// stringAttributes returns values of message attributes
+func stringAttributes(m types.Message) map[string]string {
+	attributes := make(map[string]string, len(m.MessageAttributes))
+	for name, attr := range m.MessageAttributes {
+		attributes[name] = aws.ToString(attr.StringValue)
+	}
+	return attributes
+}
+
+// decodeMessage decompresses message body according to content-encoding attribute and decodes it
+// with codec identified by content-type attribute
+func decodeMessage(m types.Message) (*message.Any, error) {
+	var contentType string
+	if attr, ok := m.MessageAttributes[message.ContentTypeAttribute]; ok {
+		contentType = aws.ToString(attr.StringValue)
+	}
+	codec, err := message.CodecByContentType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	body := *m.Body
+	if attr, ok := m.MessageAttributes[message.ContentEncodingAttribute]; ok {
+		if body, err = message.DecompressBody(body, aws.ToString(attr.StringValue)); err != nil {
+			return nil, err
+		}
+		compressionBytes.Add(float64(len(*m.Body)), "message", "compressed")
+		compressionBytes.Add(float64(len(body)), "message", "uncompressed")
+	}
+	return codec.Decode(body)
+}
+
+// Ready reports whether reader receives messages from SQS: it's ready after successful receive and isn't after
+// failed one, or once breaker opens if it's used, so that single failures don't make server unready
+func (s *Reader) Ready() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// Running returns number of currently running receiving loops
+func (s *Reader) Running() int {
+	return int(atomic.LoadInt32(&s.running))
+}
+
+// Buffered returns number of messages received but not yet taken by processors, and capacity of the buffer
+func (s *Reader) Buffered() (int, int) {
+	return len(s.messages), cap(s.messages)
+}
+
+// QueueLag returns approximate number of messages waiting in SQS queue and number of messages in flight
+func (s *Reader) QueueLag(ctx context.Context) (int, int, error) {
+	out, err := s.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(s.queueUrl),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		},
+	})
+	if err != nil {
+		sqsErrors.Inc("GetQueueAttributes")
+		return 0, 0, err
+	}
+
+	waiting, err := strconv.Atoi(out.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+	if err != nil {
+		return 0, 0, err
 	}
+	inFlight, err := strconv.Atoi(out.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return waiting, inFlight, nil
 }
@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+// runReader runs reader and processor failing messages with keys in panicking, until test finishes
+func runReader(t *testing.T, reader *server.Reader, messages server.MessageChan, panicking ...string) {
+	processor := server.NewProcessor(messages)
+	processor.UseAcknowledger(reader)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go processor.Run(ctx, func(msg *message.Any) error {
+		for _, key := range panicking {
+			if msg.Key() == key {
+				return &server.PanicError{Value: "failed " + key}
+			}
+		}
+		return nil
+	})
+	go reader.Run(ctx, 0)
+}
+
+func TestReader_Stop(t *testing.T) {
+	fake := &fakeSQS{}
+	fake.queue(`{"operation":"Get","key":"1"}`, `{"operation":"Get","key":"2"}`, `{"operation":"Get","key":"3"}`)
+	sqsClient, sqsUrl := newFakeSQSClient(t, fake)
+
+	// nothing reads messages, so reader blocks once buffer is full
+	messages := make(chan *message.Any, 1)
+	reader := server.NewReader(sqsClient, sqsUrl+"/queue", messages)
+	reader.UseRetry(retry.Policy{MaxAttempts: 1})
+	reader.UseAcknowledgements(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		reader.Run(ctx, 0)
+	}()
+	assert.Eventually(t, func() bool { return len(messages) == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("reader didn't stop")
+	}
+	// messages which weren't passed to processors are visible again
+	assert.Equal(t, []string{"handle-2:1", "handle-3:1"}, fake.changedVisibility())
+	buffered, _ := reader.Buffered()
+	assert.Equal(t, 1, buffered)
+}
+
+func TestReader_RetryExpiringSignature(t *testing.T) {
+	keys := message.SigningKeys{"k1": []byte("0123456789abcdef")}
+	signer, err := message.NewSigner(keys, "k1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	body := `{"operation":"Get","key":"1"}`
+	attributes := map[string]string{message.ContentTypeAttribute: "application/json"}
+	signer.Sign(attributes, body, time.Now())
+
+	fake := &fakeSQS{attributes: attributes}
+	fake.queue(body)
+	sqsClient, sqsUrl := newFakeSQSClient(t, fake)
+	messages := make(chan *message.Any, 1)
+	reader := server.NewReader(sqsClient, sqsUrl+"/queue", messages)
+	reader.UseRetry(retry.Policy{MaxAttempts: 1})
+	// the first retry is delayed by 10 seconds and the second one by 20 seconds, which is over max age
+	reader.UseVerifier(message.NewVerifier(keys, 15*time.Second))
+	reader.UseAcknowledgements(3)
+	runReader(t, reader, messages, "1")
+
+	assert.Eventually(t, func() bool { return len(fake.deletedMessages()) > 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"handle-1:10"}, fake.changedVisibility())
+	assert.Equal(t, []string{"handle-1"}, fake.deletedMessages())
+}
+
+func TestReader_OverLimitAttempts(t *testing.T) {
+	fake := &fakeSQS{}
+	fake.queue(`{"operation":"Get","key":"1"}`, `{"operation":"Get","key":"2"}`)
+	sqsClient, sqsUrl := newFakeSQSClient(t, fake)
+	messages := make(chan *message.Any, 1)
+	reader := server.NewReader(sqsClient, sqsUrl+"/queue", messages)
+	reader.UseRetry(retry.Policy{MaxAttempts: 1})
+	// the second message is delayed over limit, so its first attempt is the second receive
+	reader.UseLimiter(server.NewLimiter(&server.Limits{
+		Namespaces: map[string]server.Limit{server.DefaultLimitName: {Rate: 20, Burst: 1}},
+	}), server.OverLimitDelay)
+	reader.UseAcknowledgements(2)
+	runReader(t, reader, messages, "2")
+
+	assert.Eventually(t, func() bool {
+		for _, change := range fake.changedVisibility() {
+			if change == "handle-2:10" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond, "message delayed over limit should be retried")
+	assert.Contains(t, fake.changedVisibility(), "handle-2:1")
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+)
+
+// ReplayOptions defines point in time replay is stopped at and how values stored in blobs or encrypted are resolved
+type ReplayOptions struct {
+	// Until stops replay before the first record at or after given time, zero time replays all records
+	Until time.Time
+	// UntilEntry stops replay after given number of records, 0 replays all records
+	UntilEntry int
+	// Blobs resolve values of records which reference blobs, such records fail if it's nil; records whose blob is
+	// missing fail only if their item isn't replaced, removed or dropped later, since its blob was deleted then
+	Blobs *Blobs
+	// Keyring decrypts encrypted values of records, they are restored encrypted if it's nil
+	Keyring *envelope.Keyring
+	// AllowTrimmed replays journal whose oldest segments were removed by retention, such journal is refused otherwise
+	AllowTrimmed bool
+}
+
+// ErrJournalTrimmed is returned when oldest segments of replayed journal were removed, so storage can't be fully restored
+var ErrJournalTrimmed = errors.New("journal oldest segments were removed by retention")
+
+// CorruptedRecord describes record which was skipped during replay
+type CorruptedRecord struct {
+	Segment string
+	Line    int
+	Err     error
+	// Trailing is set for corrupted records which are not followed by valid ones, which is expected after crash
+	Trailing bool
+}
+
+// ReplayResult summarizes replay
+type ReplayResult struct {
+	// Entries is a number of valid records read
+	Entries int
+	// Applied is a number of records which modified storage
+	Applied int
+	// Failed is a number of records which could not be applied, e.g. because of namespace item limit
+	Failed int
+	// LastTime is a time of the last record read
+	LastTime  time.Time
+	Corrupted []CorruptedRecord
+}
+
+// Replay reconstructs storages from audit journal at path, including its rotated segments; successful
+// modifications are applied in the order they were recorded, other records are only counted
+func Replay(path string, namespaces *Namespaces, opts ReplayOptions) (ReplayResult, error) {
+	r := replayer{
+		namespaces: namespaces,
+		opts:       opts,
+		missing:    make(map[blobOwner]missingBlob),
+	}
+
+	trimmed, err := journal.Trimmed(path)
+	if err != nil {
+		return r.result, err
+	}
+	if trimmed {
+		if !opts.AllowTrimmed {
+			return r.result, ErrJournalTrimmed
+		}
+		logging.Default().Warn(
+			"journal oldest segments were removed by retention, items added before them are missing",
+			"path", path,
+		)
+	}
+
+	segments, err := journal.Segments(path)
+	if err != nil {
+		return r.result, err
+	}
+
+	for _, segment := range segments {
+		done, err := r.replaySegment(segment)
+		if err != nil {
+			return r.result, err
+		}
+		if done {
+			break
+		}
+	}
+
+	for i := r.trailingFrom; i < len(r.result.Corrupted); i++ {
+		r.result.Corrupted[i].Trailing = true
+	}
+	// blobs of items which were never replaced or removed should exist, so their items are lost
+	for owner, missing := range r.missing {
+		r.fail(missing.segment, missing.line, missing.record, missing.err)
+		delete(r.missing, owner)
+	}
+
+	return r.result, nil
+}
+
+type replayer struct {
+	namespaces *Namespaces
+	opts       ReplayOptions
+	result     ReplayResult
+	// trailingFrom is an index of the first corrupted record which is not followed by a valid one
+	trailingFrom int
+	// missing are Add records whose blobs weren't found; blob of item which was replaced, removed or dropped later
+	// is deleted, so such records fail only if item is never superseded
+	missing map[blobOwner]missingBlob
+}
+
+type missingBlob struct {
+	segment string
+	line    int
+	record  journal.Record
+	err     error
+}
+
+// replaySegment replays single segment, it reports whether replay reached its stop point
+func (r *replayer) replaySegment(segment string) (bool, error) {
+	file, err := journal.OpenSegment(segment)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	reader := journal.NewReader(file)
+	for {
+		record, err := reader.Next()
+		var corrupted *journal.CorruptedRecordError
+		switch {
+		case err == io.EOF:
+			return false, nil
+		case errors.As(err, &corrupted):
+			r.result.Corrupted = append(r.result.Corrupted, CorruptedRecord{
+				Segment: segment,
+				Line:    corrupted.Line,
+				Err:     corrupted.Err,
+			})
+			continue
+		case err != nil:
+			return false, err
+		}
+
+		// corrupted records followed by a valid one are not trailing
+		r.trailingFrom = len(r.result.Corrupted)
+		if !r.opts.Until.IsZero() && !record.Time.Before(r.opts.Until) {
+			return true, nil
+		}
+
+		r.result.Entries++
+		r.result.LastTime = record.Time
+		applied, err := applyRecord(r.namespaces, record, r.opts)
+		switch {
+		case errors.Is(err, blob.ErrNotFound):
+			owner := blobOwner{namespace: normalizeNamespace(record.Namespace), key: record.Key}
+			r.missing[owner] = missingBlob{segment: segment, line: reader.Line(), record: record, err: err}
+		case err != nil:
+			// record modifying item whose blob was missing fails as well, e.g. Remove of item which wasn't added
+			if !r.supersede(record) {
+				r.fail(segment, reader.Line(), record, err)
+			}
+		case applied:
+			r.result.Applied++
+			r.supersede(record)
+		}
+
+		if r.opts.UntilEntry > 0 && r.result.Entries >= r.opts.UntilEntry {
+			return true, nil
+		}
+	}
+}
+
+// supersede forgets missing blobs of items which record replaces, removes or drops, it reports whether there were any
+func (r *replayer) supersede(record journal.Record) bool {
+	namespace := normalizeNamespace(record.Namespace)
+	if record.Key != "" {
+		owner := blobOwner{namespace: namespace, key: record.Key}
+		_, ok := r.missing[owner]
+		delete(r.missing, owner)
+		return ok
+	}
+
+	superseded := false
+	for owner := range r.missing {
+		if owner.namespace == namespace {
+			delete(r.missing, owner)
+			superseded = true
+		}
+	}
+	return superseded
+}
+
+func (r *replayer) fail(segment string, line int, record journal.Record, err error) {
+	r.result.Failed++
+	logging.Default().Warn(
+		"can't apply journal record",
+		"segment", segment,
+		"line", line,
+		"operation", record.Operation,
+		"namespace", record.Namespace,
+		"key", record.Key,
+		"error", err,
+	)
+}
+
+// applyRecord applies successful modification to storage, it reports whether record modified storage
+func applyRecord(namespaces *Namespaces, record journal.Record, opts ReplayOptions) (bool, error) {
+	if record.Result != journal.ResultOk {
+		return false, nil
+	}
+
+	spec, ok := lookupOperation(message.Operation(record.Operation))
+	if !ok || spec.Replay == nil {
+		return false, nil
+	}
+	return spec.Replay(&Env{Namespaces: namespaces, Blobs: opts.Blobs, Keyring: opts.Keyring}, record)
+}
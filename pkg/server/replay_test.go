@@ -0,0 +1,205 @@
+package server_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/blob"
+	"github.com/yosadchyi/go-client-server/pkg/envelope"
+	"github.com/yosadchyi/go-client-server/pkg/journal"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	records := []journal.Record{
+		{Operation: "Add", Namespace: "default", Key: "1", Value: "A", Result: journal.ResultOk},
+		{Operation: "Add", Namespace: "default", Key: "2", Value: "B", Result: journal.ResultOk},
+		{Operation: "Get", Namespace: "default", Key: "2", Value: "B", Result: journal.ResultOk},
+		{Operation: "Remove", Namespace: "default", Key: "3", Result: journal.ResultError, Error: "key `3' not found"},
+		{Operation: "Add", Namespace: "a", Key: "1", Value: "C", Result: journal.ResultOk},
+		{Operation: "Remove", Namespace: "default", Key: "1", Result: journal.ResultOk},
+		{Operation: "DropNamespace", Namespace: "a", Result: journal.ResultOk},
+	}
+
+	cases := map[string]struct {
+		opts              server.ReplayOptions
+		appendRaw         string
+		expectedResult    server.ReplayResult
+		expectedItems     map[string][]server.Item
+		expectedCorrupted []server.CorruptedRecord
+	}{
+		"Replaying whole journal": {
+			expectedResult: server.ReplayResult{Entries: 7, Applied: 5, LastTime: start.Add(6 * time.Second)},
+			expectedItems: map[string][]server.Item{
+				"default": {{K: "2", V: "B"}},
+			},
+		},
+		"Replaying until given entry": {
+			opts:           server.ReplayOptions{UntilEntry: 5},
+			expectedResult: server.ReplayResult{Entries: 5, Applied: 3, LastTime: start.Add(4 * time.Second)},
+			expectedItems: map[string][]server.Item{
+				"default": {{K: "1", V: "A"}, {K: "2", V: "B"}},
+				"a":       {{K: "1", V: "C"}},
+			},
+		},
+		"Replaying until given time": {
+			opts:           server.ReplayOptions{Until: start.Add(2 * time.Second)},
+			expectedResult: server.ReplayResult{Entries: 2, Applied: 2, LastTime: start.Add(time.Second)},
+			expectedItems: map[string][]server.Item{
+				"default": {{K: "1", V: "A"}, {K: "2", V: "B"}},
+			},
+		},
+		"Replaying journal with corrupted trailing record": {
+			appendRaw:      `{"v":1,"operation":"Add","namespace":"default","key":"4","val`,
+			expectedResult: server.ReplayResult{Entries: 7, Applied: 5, LastTime: start.Add(6 * time.Second)},
+			expectedItems: map[string][]server.Item{
+				"default": {{K: "2", V: "B"}},
+			},
+			expectedCorrupted: []server.CorruptedRecord{{Line: 8, Err: journal.ErrTruncated, Trailing: true}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "log.txt")
+			file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+			if !assert.NoError(t, err) {
+				return
+			}
+			w := journal.NewWriter(file, journal.SyncNever, 0)
+			for i, record := range records {
+				record.Time = start.Add(time.Duration(i) * time.Second)
+				assert.NoError(t, w.Write(record))
+			}
+			assert.NoError(t, w.Close())
+			if tc.appendRaw != "" {
+				raw, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+				if assert.NoError(t, err) {
+					_, err = raw.WriteString(tc.appendRaw)
+					assert.NoError(t, err)
+					assert.NoError(t, raw.Close())
+				}
+			}
+
+			namespaces := server.NewNamespaces(0, nil)
+			result, err := server.Replay(path, namespaces, tc.opts)
+			assert.NoError(t, err)
+
+			for i := range result.Corrupted {
+				assert.Equal(t, path, result.Corrupted[i].Segment)
+				result.Corrupted[i].Segment = ""
+			}
+			assert.Equal(t, tc.expectedCorrupted, result.Corrupted)
+			result.Corrupted = nil
+			result.LastTime = result.LastTime.UTC()
+			assert.Equal(t, tc.expectedResult, result)
+
+			assert.Len(t, namespaces.List(), len(tc.expectedItems))
+			for namespace, items := range tc.expectedItems {
+				storage, ok := namespaces.Lookup(namespace)
+				if assert.True(t, ok, namespace) {
+					assert.Equal(t, items, storage.GetAllItems())
+				}
+			}
+		})
+	}
+}
+
+func TestReplay_Keyring(t *testing.T) {
+	keyring, err := envelope.ParseKeyring(strings.NewReader("k1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="))
+	if !assert.NoError(t, err) {
+		return
+	}
+	encrypted, _ := keyring.Encrypt("sent encrypted", "2")
+
+	path := filepath.Join(t.TempDir(), "log.txt")
+	file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := journal.NewWriter(file, journal.SyncNever, 0)
+	w.UseKeyring(keyring)
+	assert.NoError(t, w.Write(journal.Record{Operation: "Add", Namespace: "default", Key: "1", Value: "personal data", Result: journal.ResultOk}))
+	assert.NoError(t, w.Write(journal.Record{Operation: "Add", Namespace: "default", Key: "2", Value: encrypted, Result: journal.ResultOk}))
+	assert.NoError(t, w.Close())
+
+	raw, err := os.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(raw), "personal data")
+		assert.Contains(t, string(raw), encrypted, "encrypted values are written as is")
+	}
+
+	namespaces := server.NewNamespaces(0, nil)
+	_, err = server.Replay(path, namespaces, server.ReplayOptions{Keyring: keyring})
+	assert.NoError(t, err)
+	assert.Equal(t, []server.Item{{K: "1", V: "personal data"}, {K: "2", V: "sent encrypted"}}, namespaces.Storage("default").GetAllItems())
+
+	// values are restored encrypted without keyring
+	namespaces = server.NewNamespaces(0, nil)
+	_, err = server.Replay(path, namespaces, server.ReplayOptions{})
+	assert.NoError(t, err)
+	items := namespaces.Storage("default").GetAllItems()
+	if assert.Len(t, items, 2) {
+		assert.True(t, envelope.IsEncrypted(items[0].V))
+		assert.Equal(t, encrypted, items[1].V)
+	}
+}
+
+func TestReplay_Trimmed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := journal.NewWriter(file, journal.SyncNever, 0)
+	assert.NoError(t, w.Write(journal.Record{Operation: "Add", Namespace: "default", Key: "1", Value: "A", Result: journal.ResultOk}))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, os.WriteFile(path+".trimmed", nil, 0644))
+
+	_, err = server.Replay(path, server.NewNamespaces(0, nil), server.ReplayOptions{})
+	assert.ErrorIs(t, err, server.ErrJournalTrimmed)
+
+	result, err := server.Replay(path, server.NewNamespaces(0, nil), server.ReplayOptions{AllowTrimmed: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Applied)
+}
+
+func TestReplay_MissingBlobs(t *testing.T) {
+	store := blob.NewFileStore(t.TempDir())
+	assert.NoError(t, store.Put(context.Background(), "kept", []byte("K")))
+
+	path := filepath.Join(t.TempDir(), "log.txt")
+	file, err := journal.OpenRotatingFile(path, journal.RotateOptions{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := journal.NewWriter(file, journal.SyncNever, 0)
+	for _, record := range []journal.Record{
+		// blobs of replaced, removed and dropped items are deleted
+		{Operation: "Add", Namespace: "default", Key: "replaced", Ref: "released-1", Result: journal.ResultOk},
+		{Operation: "Add", Namespace: "default", Key: "replaced", Ref: "kept", Result: journal.ResultOk},
+		{Operation: "Add", Namespace: "default", Key: "removed", Ref: "released-2", Result: journal.ResultOk},
+		{Operation: "Remove", Namespace: "default", Key: "removed", Result: journal.ResultOk},
+		{Operation: "Add", Namespace: "a", Key: "dropped", Ref: "released-3", Result: journal.ResultOk},
+		{Operation: "DropNamespace", Namespace: "a", Result: journal.ResultOk},
+		{Operation: "Add", Namespace: "default", Key: "lost", Ref: "lost", Result: journal.ResultOk},
+	} {
+		assert.NoError(t, w.Write(record))
+	}
+	assert.NoError(t, w.Close())
+
+	namespaces := server.NewNamespaces(0, nil)
+	result, err := server.Replay(path, namespaces, server.ReplayOptions{Blobs: server.NewBlobs(store)})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, result.Entries)
+	assert.Equal(t, 1, result.Applied)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, []string{"default"}, namespaces.List())
+	assert.Equal(t, []server.Item{{K: "replaced", V: "K", Ref: "kept"}}, namespaces.Storage("default").GetAllItems())
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+)
+
+// Replier sends replies with results of operations to queues requested by clients
+type Replier struct {
+	sqsClient *sqs.Client
+	retry     retry.Policy
+	// queuePrefixes are prefixes of URLs of queues replies can be sent to, all queues are allowed if it's empty
+	queuePrefixes []string
+}
+
+// NewReplier creates new replier
+func NewReplier(sqsClient *sqs.Client) *Replier {
+	return &Replier{sqsClient: sqsClient, retry: retry.DefaultPolicy}
+}
+
+// UseRetry makes replier retry failed sends according to policy, retry.DefaultPolicy is used by default
+func (r *Replier) UseRetry(policy retry.Policy) {
+	r.retry = policy
+}
+
+// UseQueuePrefixes makes replier send replies only to queues with URLs starting with one of prefixes, since
+// reply queue is named by message which may come from anyone able to send to the queue
+func (r *Replier) UseQueuePrefixes(prefixes []string) {
+	r.queuePrefixes = prefixes
+}
+
+// Reply sends reply to queue at queueUrl, it fails if queue isn't allowed; reply which doesn't fit SQS message,
+// e.g. GetAll of large namespace, is replaced by error reply with message.CodeTooLarge
+func (r *Replier) Reply(ctx context.Context, queueUrl string, reply message.Reply) error {
+	if !r.allowed(queueUrl) {
+		return fmt.Errorf("reply queue %s isn't allowed", queueUrl)
+	}
+	body, err := reply.ToJSON()
+	if err != nil {
+		return err
+	}
+	if len(body) > message.MaxBodySize {
+		logging.Default().Warn("reply is too large, replying with error", "operation", reply.Operation,
+			"namespace", reply.Namespace, "correlationId", reply.CorrelationId, "size", len(body))
+		if body, err = tooLarge(reply, len(body)).ToJSON(); err != nil {
+			return err
+		}
+	}
+	return callSQS(ctx, r.retry, "SendMessage", func(ctx context.Context) error {
+		_, err := r.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:    aws.String(queueUrl),
+			MessageBody: aws.String(body),
+		})
+		return err
+	})
+}
+
+func (r *Replier) allowed(queueUrl string) bool {
+	if len(r.queuePrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range r.queuePrefixes {
+		if strings.HasPrefix(queueUrl, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tooLarge returns error reply replacing reply which is size bytes long
+func tooLarge(reply message.Reply, size int) message.Reply {
+	return message.Reply{
+		CorrelationId: reply.CorrelationId,
+		Operation:     reply.Operation,
+		Namespace:     reply.Namespace,
+		Key:           reply.Key,
+		Status:        message.StatusError,
+		Error:         fmt.Sprintf("reply is %d bytes long, at most %d bytes can be sent", size, message.MaxBodySize),
+		Code:          message.CodeTooLarge,
+	}
+}
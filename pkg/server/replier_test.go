@@ -0,0 +1,53 @@
+package server_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/message"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestReplier_Reply(t *testing.T) {
+	fake := &fakeSQS{}
+	sqsClient, sqsUrl := newFakeSQSClient(t, fake)
+	replier := server.NewReplier(sqsClient)
+	replier.UseRetry(retry.Policy{MaxAttempts: 1})
+	replier.UseQueuePrefixes([]string{sqsUrl + "/000000000000/"})
+	ctx := context.Background()
+	value := "A"
+
+	replyQueue := sqsUrl + "/000000000000/replies"
+	assert.NoError(t, replier.Reply(ctx, replyQueue, message.Reply{CorrelationId: "c1", Operation: message.GetItemOp, Key: "1", Status: message.StatusOk, Value: &value}))
+	// queues of other accounts aren't allowed
+	otherQueue := sqsUrl + "/111111111111/replies"
+	assert.Error(t, replier.Reply(ctx, otherQueue, message.Reply{CorrelationId: "c2", Operation: message.GetItemOp, Status: message.StatusOk}))
+	assert.Empty(t, fake.messages(otherQueue))
+
+	// reply which doesn't fit SQS message is replaced by error
+	items := make([]message.Item, 0, 3)
+	for _, key := range []string{"1", "2", "3"} {
+		items = append(items, message.Item{Key: key, Value: strings.Repeat("x", message.MaxBodySize/2)})
+	}
+	assert.NoError(t, replier.Reply(ctx, replyQueue, message.Reply{CorrelationId: "c3", Operation: message.GetAllItemsOp, Namespace: "teamA", Status: message.StatusOk, Items: items}))
+
+	sent := fake.messages(replyQueue)
+	if assert.Len(t, sent, 2) {
+		reply, err := message.ReplyFromJSON(sent[0])
+		if assert.NoError(t, err) && assert.NotNil(t, reply.Value) {
+			assert.Equal(t, "A", *reply.Value)
+		}
+		reply, err = message.ReplyFromJSON(sent[1])
+		if assert.NoError(t, err) {
+			assert.Equal(t, "c3", reply.CorrelationId)
+			assert.Equal(t, message.GetAllItemsOp, reply.Operation)
+			assert.Equal(t, "teamA", reply.Namespace)
+			assert.Equal(t, message.StatusError, reply.Status)
+			assert.Equal(t, message.CodeTooLarge, reply.Code)
+			assert.Empty(t, reply.Items)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+)
+
+// Thresholds of scaling decisions
+const (
+	// bufferHighWatermark is a fill of messages buffer at which processors are added, and receivers aren't,
+	// since processors don't keep up with them
+	bufferHighWatermark = 0.5
+	// saturatedBusyFraction is a fraction of time processors spend processing above which they are added
+	// if messages wait for them
+	saturatedBusyFraction = 0.9
+	// idleBusyFraction is a fraction of time processors spend processing below which they are removed
+	idleBusyFraction = 0.25
+)
+
+// ScalingOptions bound numbers of processors and receivers run by Scaler
+type ScalingOptions struct {
+	MinProcessors int
+	MaxProcessors int
+	MinReceivers  int
+	MaxReceivers  int
+	// Interval is time between scaling decisions
+	Interval time.Duration
+	// BacklogPerReceiver is number of messages waiting in SQS queue per receiver above which receivers are added
+	BacklogPerReceiver int
+}
+
+// Validate checks that bounds are positive and consistent
+func (o ScalingOptions) Validate() error {
+	switch {
+	case o.MinProcessors < 1 || o.MaxProcessors < o.MinProcessors:
+		return errors.New("processors bounds must satisfy 1 <= min <= max")
+	case o.MinReceivers < 1 || o.MaxReceivers < o.MinReceivers:
+		return errors.New("receivers bounds must satisfy 1 <= min <= max")
+	case o.Interval <= 0:
+		return errors.New("scaling interval must be positive")
+	case o.BacklogPerReceiver < 1:
+		return errors.New("backlog per receiver must be positive")
+	}
+	return nil
+}
+
+// Sample is state of server observed by Scaler since previous sample
+type Sample struct {
+	Processors int
+	Receivers  int
+	// Buffered is a number of received messages waiting for processors, BufferCapacity is capacity of MessageChan
+	Buffered       int
+	BufferCapacity int
+	// Backlog is approximate number of messages waiting in SQS queue, -1 if it's unknown
+	Backlog int
+	// Processed is a number of messages processed since previous sample, Latency is their average processing time
+	Processed int
+	Latency   time.Duration
+	// Elapsed is time since previous sample
+	Elapsed time.Duration
+}
+
+// busy returns fraction of time processors spent processing messages
+func (s Sample) busy() float64 {
+	if s.Processors == 0 || s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Latency) * float64(s.Processed) / (float64(s.Elapsed) * float64(s.Processors))
+}
+
+// fill returns fraction of messages buffer taken by messages waiting for processors
+func (s Sample) fill() float64 {
+	if s.BufferCapacity == 0 {
+		return 0
+	}
+	return float64(s.Buffered) / float64(s.BufferCapacity)
+}
+
+// Scaling is a decision of Scaler, reasons are empty for pools which aren't resized
+type Scaling struct {
+	Processors       int
+	ProcessorsReason string
+	Receivers        int
+	ReceiversReason  string
+}
+
+// Scale decides how many processors and receivers should run: processors are added by half when buffer fills up
+// or they are saturated, and removed one by one when they are idle; receivers are added one by one while SQS backlog
+// exceeds BacklogPerReceiver per receiver and processors keep up with them, and removed when backlog shrinks
+func (o ScalingOptions) Scale(s Sample) Scaling {
+	result := Scaling{Processors: s.Processors, Receivers: s.Receivers}
+	fill, busy := s.fill(), s.busy()
+	switch {
+	case s.Processors < o.MinProcessors || s.Processors > o.MaxProcessors:
+		result.Processors = clamp(s.Processors, o.MinProcessors, o.MaxProcessors)
+		result.ProcessorsReason = "out of bounds"
+	case (fill >= bufferHighWatermark || s.Buffered > 0 && busy >= saturatedBusyFraction) && s.Processors < o.MaxProcessors:
+		step := s.Processors / 2
+		if step < 1 {
+			step = 1
+		}
+		result.Processors = clamp(s.Processors+step, o.MinProcessors, o.MaxProcessors)
+		result.ProcessorsReason = "processors saturated"
+		if fill >= bufferHighWatermark {
+			result.ProcessorsReason = "buffer filling up"
+		}
+	case s.Buffered == 0 && busy < idleBusyFraction && s.Processors > o.MinProcessors:
+		result.Processors = s.Processors - 1
+		result.ProcessorsReason = "processors idle"
+	}
+
+	switch {
+	case s.Receivers < o.MinReceivers || s.Receivers > o.MaxReceivers:
+		result.Receivers = clamp(s.Receivers, o.MinReceivers, o.MaxReceivers)
+		result.ReceiversReason = "out of bounds"
+	case s.Backlog < 0 || fill >= bufferHighWatermark:
+		// backlog is unknown, or processors don't keep up with receivers already
+	case s.Backlog > s.Receivers*o.BacklogPerReceiver && s.Receivers < o.MaxReceivers:
+		result.Receivers = s.Receivers + 1
+		result.ReceiversReason = "queue backlog growing"
+	case s.Backlog < (s.Receivers-1)*o.BacklogPerReceiver/2 && s.Receivers > o.MinReceivers:
+		result.Receivers = s.Receivers - 1
+		result.ReceiversReason = "queue backlog shrinking"
+	}
+	return result
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// Scaler grows and shrinks pools of processors and receivers within bounds, according to depth of messages
+// buffer, processing latency and number of messages waiting in SQS queue; every decision is logged
+type Scaler struct {
+	opts       ScalingOptions
+	reader     *Reader
+	processor  *Processor
+	processors *Pool
+	receivers  *Pool
+}
+
+// NewScaler creates scaler of pools running processor and reader loops, it fails if options are invalid
+func NewScaler(opts ScalingOptions, reader *Reader, processor *Processor, processors, receivers *Pool) (*Scaler, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return &Scaler{
+		opts:       opts,
+		reader:     reader,
+		processor:  processor,
+		processors: processors,
+		receivers:  receivers,
+	}, nil
+}
+
+// Run makes scaling decisions every interval, can be stopped with context's cancel function
+func (s *Scaler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	processed, busy := s.processor.Processed()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sample := Sample{
+				Processors: s.processors.Size(),
+				Receivers:  s.receivers.Size(),
+				Elapsed:    now.Sub(last),
+			}
+			sample.Buffered, sample.BufferCapacity = s.reader.Buffered()
+			sample.Backlog = s.backlog(ctx)
+			total, totalBusy := s.processor.Processed()
+			sample.Processed = total - processed
+			if sample.Processed > 0 {
+				sample.Latency = (totalBusy - busy) / time.Duration(sample.Processed)
+			}
+			processed, busy, last = total, totalBusy, now
+
+			s.apply(sample, s.opts.Scale(sample))
+		}
+	}
+}
+
+// backlog returns approximate number of messages waiting in SQS queue, -1 if it can't be read
+func (s *Scaler) backlog(ctx context.Context) int {
+	waiting, _, err := s.reader.QueueLag(ctx)
+	if err != nil {
+		logging.Default().Warn("can't read queue backlog, receivers aren't scaled", "error", err)
+		return -1
+	}
+	return waiting
+}
+
+// apply resizes pools according to decision and logs it
+func (s *Scaler) apply(sample Sample, scaling Scaling) {
+	logger := logging.Default().With(
+		"buffered", sample.Buffered,
+		"backlog", sample.Backlog,
+		"processed", sample.Processed,
+		"latency", sample.Latency,
+		"busy", math.Round(sample.busy()*100)/100,
+	)
+	resize("processors", s.processors, sample.Processors, scaling.Processors, scaling.ProcessorsReason, logger)
+	resize("receivers", s.receivers, sample.Receivers, scaling.Receivers, scaling.ReceiversReason, logger)
+}
+
+func resize(name string, pool *Pool, from, to int, reason string, logger *logging.Logger) {
+	poolSize.Set(float64(to), name)
+	if from == to {
+		logger.Debug("keeping "+name, "size", from)
+		return
+	}
+	direction := "up"
+	if to < from {
+		direction = "down"
+	}
+	scalingDecisions.Inc(name, direction)
+	logger.Info("scaling "+name, "from", from, "to", to, "reason", reason)
+	pool.Resize(to)
+}
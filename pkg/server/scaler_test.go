@@ -0,0 +1,187 @@
+package server_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yosadchyi/go-client-server/pkg/server"
+)
+
+func TestScalingOptions_Scale(t *testing.T) {
+	opts := server.ScalingOptions{
+		MinProcessors:      2,
+		MaxProcessors:      8,
+		MinReceivers:       1,
+		MaxReceivers:       3,
+		Interval:           10 * time.Second,
+		BacklogPerReceiver: 100,
+	}
+	// steady is a sample which keeps both pools as they are
+	steady := server.Sample{
+		Processors:     4,
+		Receivers:      2,
+		Buffered:       10,
+		BufferCapacity: 128,
+		Backlog:        150,
+		Processed:      200,
+		Latency:        100 * time.Millisecond,
+		Elapsed:        10 * time.Second,
+	}
+	tests := map[string]struct {
+		sample     func(s *server.Sample)
+		processors int
+		receivers  int
+	}{
+		"steady": {
+			sample:     func(s *server.Sample) {},
+			processors: 4,
+			receivers:  2,
+		},
+		"buffer filling up": {
+			sample: func(s *server.Sample) {
+				s.Buffered = 100
+			},
+			processors: 6,
+			receivers:  2,
+		},
+		"processors saturated": {
+			sample: func(s *server.Sample) {
+				s.Processed = 390
+			},
+			processors: 6,
+			receivers:  2,
+		},
+		"processors at max": {
+			sample: func(s *server.Sample) {
+				s.Processors = 8
+				s.Buffered = 100
+			},
+			processors: 8,
+			receivers:  2,
+		},
+		"processors idle": {
+			sample: func(s *server.Sample) {
+				s.Buffered = 0
+				s.Processed = 10
+			},
+			processors: 3,
+			receivers:  2,
+		},
+		"processors at min": {
+			sample: func(s *server.Sample) {
+				s.Processors = 2
+				s.Buffered = 0
+				s.Processed = 0
+			},
+			processors: 2,
+			receivers:  2,
+		},
+		"processors out of bounds": {
+			sample: func(s *server.Sample) {
+				s.Processors = 12
+			},
+			processors: 8,
+			receivers:  2,
+		},
+		"backlog growing": {
+			sample: func(s *server.Sample) {
+				s.Backlog = 1000
+			},
+			processors: 4,
+			receivers:  3,
+		},
+		"backlog growing while buffer fills up": {
+			sample: func(s *server.Sample) {
+				s.Backlog = 1000
+				s.Buffered = 100
+			},
+			processors: 6,
+			receivers:  2,
+		},
+		"backlog shrinking": {
+			sample: func(s *server.Sample) {
+				s.Backlog = 10
+			},
+			processors: 4,
+			receivers:  1,
+		},
+		"backlog unknown": {
+			sample: func(s *server.Sample) {
+				s.Backlog = -1
+			},
+			processors: 4,
+			receivers:  2,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sample := steady
+			tc.sample(&sample)
+			scaling := opts.Scale(sample)
+			assert.Equal(t, tc.processors, scaling.Processors)
+			assert.Equal(t, tc.receivers, scaling.Receivers)
+			assert.Equal(t, tc.processors != sample.Processors, scaling.ProcessorsReason != "")
+			assert.Equal(t, tc.receivers != sample.Receivers, scaling.ReceiversReason != "")
+		})
+	}
+}
+
+func TestScalingOptions_Validate(t *testing.T) {
+	valid := server.ScalingOptions{MinProcessors: 1, MaxProcessors: 4, MinReceivers: 1, MaxReceivers: 2, Interval: time.Second, BacklogPerReceiver: 10}
+	assert.NoError(t, valid.Validate())
+
+	invalid := valid
+	invalid.MaxProcessors = 0
+	assert.Error(t, invalid.Validate())
+	invalid = valid
+	invalid.MinReceivers = 0
+	assert.Error(t, invalid.Validate())
+	invalid = valid
+	invalid.Interval = 0
+	assert.Error(t, invalid.Validate())
+}
+
+func TestPool(t *testing.T) {
+	var lock sync.Mutex
+	running := make(map[int]bool)
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := server.NewPool(ctx, func(ctx context.Context, id int) {
+		lock.Lock()
+		running[id] = true
+		lock.Unlock()
+		<-ctx.Done()
+		lock.Lock()
+		delete(running, id)
+		lock.Unlock()
+	})
+	ids := func() map[int]bool {
+		lock.Lock()
+		defer lock.Unlock()
+		result := make(map[int]bool, len(running))
+		for id := range running {
+			result[id] = true
+		}
+		return result
+	}
+
+	pool.Resize(3)
+	assert.Equal(t, 3, pool.Size())
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(map[int]bool{1: true, 2: true, 3: true}, ids())
+	}, time.Second, time.Millisecond)
+
+	// workers with the highest numbers are stopped first
+	pool.Resize(1)
+	assert.Equal(t, 1, pool.Size())
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(map[int]bool{1: true}, ids())
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	pool.Wait()
+	assert.Empty(t, ids())
+}
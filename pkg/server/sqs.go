@@ -0,0 +1,23 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/yosadchyi/go-client-server/pkg/logging"
+	"github.com/yosadchyi/go-client-server/pkg/retry"
+)
+
+// callSQS calls SQS API retrying transient and throttling errors according to policy, retries and calls
+// failed eventually are counted by name of call
+func callSQS(ctx context.Context, policy retry.Policy, call string, fn func(ctx context.Context) error) error {
+	policy.OnRetry = func(attempt int, class retry.Class, delay time.Duration, err error) {
+		sqsRetries.Inc(call, string(class))
+		logging.Default().Debug("retrying SQS call", "call", call, "attempt", attempt, "class", class, "delay", delay, "error", err)
+	}
+	err := policy.Do(ctx, fn)
+	if err != nil {
+		sqsErrors.Inc(call)
+	}
+	return err
+}
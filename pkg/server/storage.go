@@ -4,18 +4,34 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 )
 
+// ErrLimitExceeded is returned when item can't be added because storage is full
+var ErrLimitExceeded = errors.New("storage item limit exceeded")
+
+// ErrKeyExists is returned when new item can't be added because item with the same key exists
+var ErrKeyExists = errors.New("key already exists")
+
+// ErrNamespaceDropped is returned when item is modified in storage of namespace which was dropped meanwhile
+var ErrNamespaceDropped = errors.New("namespace was dropped")
+
 // Item represents stored item
 type Item struct {
 	K string
 	V string
+	// Ref is a key of blob value was loaded from, blob is deleted when item is removed or replaced
+	Ref string
+	// compressed is set if V is kept compressed with gzip, see NewCompressedStorage
+	compressed bool
 }
 
 // Storage defines interface for ordered storage
 type Storage interface {
-	// AddItem adds Item to storage
-	AddItem(item Item)
+	// AddItem adds Item to storage, replacing existing Item with the same key
+	AddItem(item Item) error
+	// AddNewItem adds Item to storage only if there is no Item with the same key, ErrKeyExists is returned otherwise
+	AddNewItem(item Item) error
 	// RemoveItem removes Item from storage
 	RemoveItem(key string) error
 	// GetItem returns Item with given id from storage
@@ -24,11 +40,17 @@ type Storage interface {
 	GetAllItems() []Item
 	// Iterate allows to iterato over ordered in storage, can be used for processing which does not involve blocking IO
 	Iterate(accept func(Item))
+	// Len returns number of items in storage
+	Len() int
+	// Size returns total size of keys and values in storage in bytes
+	Size() int
 }
 
 type rwLockedStorage struct {
 	rwLock  sync.RWMutex
 	storage Storage
+	// dropped storage rejects modifications, since they would be lost
+	dropped bool
 }
 
 // NewRWLockedStorage returns storage which adds read/write mutex to upstream storage
@@ -39,39 +61,122 @@ func NewRWLockedStorage(storage Storage) *rwLockedStorage {
 	}
 }
 
-func (s *rwLockedStorage) AddItem(item Item) {
-	s.rwLock.Lock()
-	s.storage.AddItem(item)
-	s.rwLock.Unlock()
+func (s *rwLockedStorage) AddItem(item Item) error {
+	s.lock()
+	defer s.rwLock.Unlock()
+	if s.dropped {
+		return ErrNamespaceDropped
+	}
+	return s.storage.AddItem(item)
+}
+
+func (s *rwLockedStorage) AddNewItem(item Item) error {
+	s.lock()
+	defer s.rwLock.Unlock()
+	if s.dropped {
+		return ErrNamespaceDropped
+	}
+	return s.storage.AddNewItem(item)
 }
 
 func (s *rwLockedStorage) RemoveItem(key string) error {
-	s.rwLock.Lock()
-	err := s.storage.RemoveItem(key)
-	s.rwLock.Unlock()
-	return err
+	s.lock()
+	defer s.rwLock.Unlock()
+	if s.dropped {
+		return ErrNamespaceDropped
+	}
+	return s.storage.RemoveItem(key)
 }
 
 func (s *rwLockedStorage) GetItem(key string) (*Item, error) {
-	s.rwLock.RLock()
+	s.rLock()
 	item, err := s.storage.GetItem(key)
 	s.rwLock.RUnlock()
 	return item, err
 }
 
 func (s *rwLockedStorage) GetAllItems() []Item {
-	s.rwLock.RLock()
+	s.rLock()
 	items := s.storage.GetAllItems()
 	s.rwLock.RUnlock()
 	return items
 }
 
 func (s *rwLockedStorage) Iterate(accept func(Item)) {
-	s.rwLock.RLock()
+	s.rLock()
 	s.storage.Iterate(accept)
 	s.rwLock.RUnlock()
 }
 
+func (s *rwLockedStorage) Len() int {
+	s.rLock()
+	n := s.storage.Len()
+	s.rwLock.RUnlock()
+	return n
+}
+
+func (s *rwLockedStorage) Size() int {
+	s.rLock()
+	n := s.storage.Size()
+	s.rwLock.RUnlock()
+	return n
+}
+
+// drop makes storage reject modifications and passes its items to accept, so no item is added after they are iterated
+func (s *rwLockedStorage) drop(accept func(Item)) {
+	s.lock()
+	defer s.rwLock.Unlock()
+	s.dropped = true
+	s.storage.Iterate(accept)
+}
+
+// lock acquires write lock, recording time spent waiting for it
+func (s *rwLockedStorage) lock() {
+	start := time.Now()
+	s.rwLock.Lock()
+	storageLockWait.Observe(time.Since(start).Seconds(), "write")
+}
+
+// rLock acquires read lock, recording time spent waiting for it
+func (s *rwLockedStorage) rLock() {
+	start := time.Now()
+	s.rwLock.RLock()
+	storageLockWait.Observe(time.Since(start).Seconds(), "read")
+}
+
+type limitedStorage struct {
+	Storage
+	maxItems int
+}
+
+// NewLimitedStorage returns storage which refuses to add new keys once upstream storage holds maxItems items,
+// replacing existing keys is always allowed
+func NewLimitedStorage(storage Storage, maxItems int) *limitedStorage {
+	return &limitedStorage{
+		Storage:  storage,
+		maxItems: maxItems,
+	}
+}
+
+func (s *limitedStorage) AddItem(item Item) error {
+	if s.Storage.Len() >= s.maxItems {
+		if _, err := s.Storage.GetItem(item.K); err != nil {
+			return ErrLimitExceeded
+		}
+	}
+	return s.Storage.AddItem(item)
+}
+
+func (s *limitedStorage) AddNewItem(item Item) error {
+	if _, err := s.Storage.GetItem(item.K); err == nil {
+		return ErrKeyExists
+	}
+	if s.Storage.Len() >= s.maxItems {
+		return ErrLimitExceeded
+	}
+	return s.Storage.AddNewItem(item)
+}
+
 type entry struct {
 	prev *entry
 	next *entry
@@ -81,6 +186,7 @@ type entry struct {
 type memoryStorage struct {
 	head    *entry
 	indexed map[string]*entry
+	size    int
 }
 
 // NewMemoryStorage returns storage backed by slice, Item id is an index in slice
@@ -95,7 +201,7 @@ func NewMemoryStorage() *memoryStorage {
 	}
 }
 
-func (s *memoryStorage) AddItem(item Item) {
+func (s *memoryStorage) AddItem(item Item) error {
 	if _, ok := s.indexed[item.K]; ok {
 		// we know that index exists
 		_ = s.RemoveItem(item.K)
@@ -109,6 +215,16 @@ func (s *memoryStorage) AddItem(item Item) {
 	s.head.prev = entry
 
 	s.indexed[item.K] = entry
+	s.size += len(item.K) + len(item.V)
+
+	return nil
+}
+
+func (s *memoryStorage) AddNewItem(item Item) error {
+	if _, ok := s.indexed[item.K]; ok {
+		return ErrKeyExists
+	}
+	return s.AddItem(item)
 }
 
 func (s *memoryStorage) RemoveItem(key string) error {
@@ -119,6 +235,7 @@ func (s *memoryStorage) RemoveItem(key string) error {
 	}
 
 	delete(s.indexed, key)
+	s.size -= len(entry.item.K) + len(entry.item.V)
 	entry.prev.next = entry.next
 	entry.next.prev = entry.prev
 
@@ -156,3 +273,11 @@ func (s *memoryStorage) Iterate(accept func(Item)) {
 		accept(*e.item)
 	}
 }
+
+func (s *memoryStorage) Len() int {
+	return len(s.indexed)
+}
+
+func (s *memoryStorage) Size() int {
+	return s.size
+}
@@ -2,6 +2,7 @@ package server_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -39,6 +40,21 @@ func TestMemoryStorage(t *testing.T) {
 			},
 			expectedItems: []server.Item{{K: "1", V: "B"}},
 		},
+		"Adding new item": {
+			scenario: func(storage server.Storage) (*server.Item, error) {
+				storage.AddItem(server.Item{K: "1", V: "A"})
+				return nil, storage.AddNewItem(server.Item{K: "2", V: "B"})
+			},
+			expectedItems: []server.Item{{K: "1", V: "A"}, {K: "2", V: "B"}},
+		},
+		"Adding new item with existing key": {
+			scenario: func(storage server.Storage) (*server.Item, error) {
+				storage.AddItem(server.Item{K: "1", V: "A"})
+				return nil, storage.AddNewItem(server.Item{K: "1", V: "B"})
+			},
+			expectedError: server.ErrKeyExists,
+			expectedItems: []server.Item{{K: "1", V: "A"}},
+		},
 		"Removing single item": {
 			scenario: func(storage server.Storage) (*server.Item, error) {
 				storage.AddItem(server.Item{K: "1", V: "A"})
@@ -113,3 +129,28 @@ func TestMemoryStorage(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressedStorage(t *testing.T) {
+	memory := server.NewMemoryStorage()
+	storage := server.NewCompressedStorage(memory, 100)
+	large := strings.Repeat(`{"name":"value"}`, 100)
+
+	assert.NoError(t, storage.AddItem(server.Item{K: "1", V: "short"}))
+	assert.NoError(t, storage.AddItem(server.Item{K: "2", V: large}))
+	assert.Equal(t, server.ErrKeyExists, storage.AddNewItem(server.Item{K: "2", V: large}))
+
+	item, err := storage.GetItem("2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &server.Item{K: "2", V: large}, item)
+	}
+	assert.Equal(t, []server.Item{{K: "1", V: "short"}, {K: "2", V: large}}, storage.GetAllItems())
+	var iterated []server.Item
+	storage.Iterate(func(item server.Item) {
+		iterated = append(iterated, item)
+	})
+	assert.Equal(t, []server.Item{{K: "1", V: "short"}, {K: "2", V: large}}, iterated)
+
+	stored, _ := memory.GetItem("2")
+	assert.Less(t, len(stored.V), len(large)/10)
+	assert.Less(t, storage.Size(), len(large))
+}
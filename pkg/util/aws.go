@@ -1,6 +1,9 @@
 package util
 
-import "github.com/aws/aws-sdk-go-v2/aws"
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
 
 // LocalResolver provides resolver which takes in account provided awsEndpoint and routes requests to defined endpoint
 func LocalResolver(awsEndpoint, awsRegion string) aws.EndpointResolverWithOptionsFunc {
@@ -17,3 +20,9 @@ func LocalResolver(awsEndpoint, awsRegion string) aws.EndpointResolverWithOption
 		return aws.Endpoint{}, &aws.EndpointNotFoundError{}
 	}
 }
+
+// WithoutRetries disables retries of SQS client made by SDK, so calls are retried only according to retry.Policy
+// and attempts aren't multiplied
+func WithoutRetries(o *sqs.Options) {
+	o.Retryer = aws.NopRetryer{}
+}
@@ -4,15 +4,14 @@ import "encoding/json"
 
 // JSONEr interface allows return JSON representation
 type JSONEr interface {
-	ToJSON() *string
+	ToJSON() (string, error)
 }
 
-// ToJSON returns json representation of the given value, or nil in case of marshalling error
-func ToJSON[T any](val T) *string {
+// ToJSON returns json representation of the given value
+func ToJSON[T any](val T) (string, error) {
 	bytes, err := json.Marshal(val)
 	if err != nil {
-		return nil
+		return "", err
 	}
-	value := string(bytes)
-	return &value
+	return string(bytes), nil
 }